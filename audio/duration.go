@@ -0,0 +1,239 @@
+// Package audio measures the duration of uploaded audio files, for pricing models billed per minute.
+//
+// The duration is read from the container headers: WAV, MP3 (Xing/Info header or frame scan),
+// FLAC, MP4/M4A and Ogg (Opus, Vorbis). Other formats (e.g. WebM) return ErrUnsupported.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned for formats whose duration can't be read
+var ErrUnsupported = errors.New("unsupported audio format")
+
+var errTruncated = errors.New("truncated audio file")
+
+// Duration returns the playing time of an audio file
+func Duration(data []byte) (time.Duration, error) {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return wavDuration(data)
+	case len(data) >= 4 && string(data[:4]) == "fLaC":
+		return flacDuration(data)
+	case len(data) >= 4 && string(data[:4]) == "OggS":
+		return oggDuration(data)
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return mp4Duration(data)
+	case len(data) >= 3 && string(data[:3]) == "ID3", len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return mp3Duration(data)
+	}
+	return 0, ErrUnsupported
+}
+
+func seconds(n, rate uint64) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(n/rate)*time.Second + time.Duration(n%rate*uint64(time.Second)/rate)
+}
+
+// wavDuration divides the size of the data chunk by the byte rate from the fmt chunk
+func wavDuration(data []byte) (time.Duration, error) {
+	var byteRate uint32
+	for off := 12; off+8 <= len(data); {
+		id, size := string(data[off:off+4]), binary.LittleEndian.Uint32(data[off+4:off+8])
+		body := off + 8
+		switch id {
+		case "fmt ":
+			if body+12 > len(data) {
+				return 0, errTruncated
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("wav: data chunk before fmt chunk")
+			}
+			// Streamed WAVs may leave the size unset
+			if size == 0 || size == 0xFFFFFFFF || int(size) > len(data)-body {
+				size = uint32(len(data) - body)
+			}
+			return seconds(uint64(size), uint64(byteRate)), nil
+		}
+		off = body + int(size) + int(size&1) // chunks are word aligned
+	}
+	return 0, errTruncated
+}
+
+// flacDuration reads the total samples and sample rate from the STREAMINFO block
+func flacDuration(data []byte) (time.Duration, error) {
+	// "fLaC", block header (4 bytes), STREAMINFO: sample rate at bits 80-99, total samples at 108-143
+	if len(data) < 8+18 {
+		return 0, errTruncated
+	}
+	info := data[8:]
+	sampleRate := uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+	total := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+	return seconds(total, sampleRate), nil
+}
+
+// mp4Duration reads the timescale and duration of the movie header (moov/mvhd)
+func mp4Duration(data []byte) (time.Duration, error) {
+	moov, ok := mp4Box(data, "moov")
+	if !ok {
+		return 0, errors.New("mp4: no moov box")
+	}
+	mvhd, ok := mp4Box(moov, "mvhd")
+	if !ok || len(mvhd) < 4 {
+		return 0, errors.New("mp4: no mvhd box")
+	}
+	if mvhd[0] == 1 { // version 1: 64-bit times
+		if len(mvhd) < 32 {
+			return 0, errTruncated
+		}
+		return seconds(binary.BigEndian.Uint64(mvhd[24:32]), uint64(binary.BigEndian.Uint32(mvhd[20:24]))), nil
+	}
+	if len(mvhd) < 20 {
+		return 0, errTruncated
+	}
+	return seconds(uint64(binary.BigEndian.Uint32(mvhd[16:20])), uint64(binary.BigEndian.Uint32(mvhd[12:16]))), nil
+}
+
+// mp4Box returns the body of the first box of the given type in data
+func mp4Box(data []byte, boxType string) ([]byte, bool) {
+	for off := 0; off+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[off : off+4]))
+		header := 8
+		switch size {
+		case 0: // extends to the end
+			size = uint64(len(data) - off)
+		case 1: // 64-bit size
+			if off+16 > len(data) {
+				return nil, false
+			}
+			size, header = binary.BigEndian.Uint64(data[off+8:off+16]), 16
+		}
+		if size < uint64(header) || size > uint64(len(data)-off) {
+			return nil, false
+		}
+		if string(data[off+4:off+8]) == boxType {
+			return data[off+header : off+int(size)], true
+		}
+		off += int(size)
+	}
+	return nil, false
+}
+
+// oggDuration divides the granule position of the last page by the codec's sample rate
+func oggDuration(data []byte) (time.Duration, error) {
+	// The first page holds the codec identification header
+	if len(data) < 28 {
+		return 0, errTruncated
+	}
+	segments := int(data[26])
+	first := 27 + segments
+	if first > len(data) {
+		return 0, errTruncated
+	}
+	var rate, preSkip uint64
+	switch head := data[first:]; {
+	case bytes.HasPrefix(head, []byte("OpusHead")) && len(head) >= 12:
+		rate, preSkip = 48000, uint64(binary.LittleEndian.Uint16(head[10:12])) // Opus granules are always 48 kHz
+	case bytes.HasPrefix(head, []byte("\x01vorbis")) && len(head) >= 16:
+		rate = uint64(binary.LittleEndian.Uint32(head[12:16]))
+	default:
+		return 0, ErrUnsupported
+	}
+
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || last+14 > len(data) {
+		return 0, errTruncated
+	}
+	granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+	if granule < preSkip {
+		return 0, nil
+	}
+	return seconds(granule-preSkip, rate), nil
+}
+
+// MPEG audio layer III tables
+var (
+	mp3Bitrates = [2][16]uint64{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}, // MPEG-1
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},     // MPEG-2/2.5
+	}
+	mp3SampleRates = [4][3]uint64{
+		{11025, 12000, 8000},  // MPEG-2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG-2
+		{44100, 48000, 32000}, // MPEG-1
+	}
+)
+
+type mp3Frame struct {
+	length, samples, sampleRate uint64
+	mpeg1, mono                 bool
+}
+
+// parseMP3Frame decodes a layer III frame header
+func parseMP3Frame(h []byte) (mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	version, layer := (h[1]>>3)&0x03, (h[1]>>1)&0x03
+	bitrateIdx, rateIdx, padding := h[2]>>4, (h[2]>>2)&0x03, uint64(h[2]>>1)&0x01
+	if version == 1 || layer != 1 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return mp3Frame{}, false // reserved, not layer III, free format or bad values
+	}
+	f := mp3Frame{sampleRate: mp3SampleRates[version][rateIdx], mpeg1: version == 3, mono: h[3]>>6 == 3}
+	table, coeff := 1, uint64(72)
+	f.samples = 576
+	if f.mpeg1 {
+		table, coeff, f.samples = 0, 144, 1152
+	}
+	f.length = coeff*mp3Bitrates[table][bitrateIdx]*1000/f.sampleRate + padding
+	return f, true
+}
+
+// mp3Duration uses the Xing/Info frame count when present, otherwise counts the frames
+func mp3Duration(data []byte) (time.Duration, error) {
+	off := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" { // skip the ID3v2 tag (synchsafe size)
+		off = 10 + (int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9]))
+	}
+	for off+4 <= len(data) && data[off] != 0xFF {
+		off++ // padding between the tag and the first frame
+	}
+	first, ok := parseMP3Frame(data[min(off, len(data)):])
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	// Xing/Info header, after the side information of the first frame
+	side := 17
+	if first.mpeg1 && !first.mono {
+		side = 32
+	} else if !first.mpeg1 && first.mono {
+		side = 9
+	}
+	if x := off + 4 + side; x+12 <= len(data) {
+		tag := string(data[x : x+4])
+		if (tag == "Xing" || tag == "Info") && data[x+7]&0x01 != 0 {
+			frames := uint64(binary.BigEndian.Uint32(data[x+8 : x+12]))
+			return seconds(frames*first.samples, first.sampleRate), nil
+		}
+	}
+
+	var samples uint64
+	for off+4 <= len(data) {
+		f, ok := parseMP3Frame(data[off:])
+		if !ok || f.length == 0 {
+			break // trailing tags (ID3v1, APE) or garbage
+		}
+		samples += f.samples
+		off += int(f.length)
+	}
+	return seconds(samples, first.sampleRate), nil
+}
@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func wavFile(sampleRate, channels, seconds int) []byte {
+	var b bytes.Buffer
+	dataSize := sampleRate * channels * 2 * seconds
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+dataSize))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{
+		uint32(16), uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * 2), uint16(channels * 2), uint16(16),
+	} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("LIST")
+	binary.Write(&b, binary.LittleEndian, uint32(3)) // odd sized chunk, padded
+	b.WriteString("abc\x00")
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(dataSize))
+	b.Write(make([]byte, dataSize))
+	return b.Bytes()
+}
+
+func TestDuration_WAV(t *testing.T) {
+	got, err := Duration(wavFile(16000, 1, 3))
+	if err != nil || got != 3*time.Second {
+		t.Errorf("Duration = %v, %v; want 3s", got, err)
+	}
+	got, err = Duration(wavFile(44100, 2, 2))
+	if err != nil || got != 2*time.Second {
+		t.Errorf("Duration = %v, %v; want 2s", got, err)
+	}
+}
+
+// mp3Frames returns n MPEG-1 layer III frames at 128 kbps / 44.1 kHz, stereo
+func mp3Frames(n int) []byte {
+	header := []byte{0xFF, 0xFB, 0x90, 0x00}
+	frame := make([]byte, 417) // 144 * 128000 / 44100
+	copy(frame, header)
+	return bytes.Repeat(frame, n)
+}
+
+func TestDuration_MP3(t *testing.T) {
+	// 100 frames of 1152 samples at 44.1 kHz, after an ID3v2 tag
+	tag := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}
+	data := append(append(tag, make([]byte, 20)...), mp3Frames(100)...)
+	got, err := Duration(data)
+	if want := time.Duration(100 * 1152 * int64(time.Second) / 44100); err != nil || got != want {
+		t.Errorf("Duration = %v, %v; want %v", got, err, want)
+	}
+
+	// Xing header claiming 1000 frames: no need to scan
+	xing := mp3Frames(2)
+	copy(xing[4+32:], "Xing\x00\x00\x00\x01")
+	binary.BigEndian.PutUint32(xing[4+32+8:], 1000)
+	got, err = Duration(xing)
+	if want := time.Duration(1000 * 1152 * int64(time.Second) / 44100); err != nil || got != want {
+		t.Errorf("Duration = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestDuration_FLAC(t *testing.T) {
+	data := []byte("fLaC\x00\x00\x00\x22")
+	info := make([]byte, 34)
+	// 48000 Hz (20 bits), then channels/bps, 480000 total samples (36 bits)
+	info[10], info[11], info[12] = 0x0B, 0xB8, 0x00
+	binary.BigEndian.PutUint32(info[14:18], 480000)
+	got, err := Duration(append(data, info...))
+	if err != nil || got != 10*time.Second {
+		t.Errorf("Duration = %v, %v; want 10s", got, err)
+	}
+}
+
+func box(boxType string, body []byte) []byte {
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], boxType)
+	return append(b, body...)
+}
+
+func TestDuration_MP4(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)  // timescale
+	binary.BigEndian.PutUint32(mvhd[16:], 65500) // duration
+	data := append(box("ftyp", []byte("M4A \x00\x00\x00\x00")), box("mdat", make([]byte, 64))...)
+	data = append(data, box("moov", box("mvhd", mvhd))...)
+	got, err := Duration(data)
+	if err != nil || got != 65500*time.Millisecond {
+		t.Errorf("Duration = %v, %v; want 65.5s", got, err)
+	}
+}
+
+func oggPage(granule uint64, packet []byte) []byte {
+	page := make([]byte, 27, 28+len(packet))
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	page[26] = 1
+	page = append(page, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func TestDuration_Ogg(t *testing.T) {
+	head := []byte("OpusHead\x01\x01\x38\x01\x80\xbb\x00\x00\x00\x00\x00") // pre-skip 312
+	data := append(oggPage(0, head), oggPage(48000*5+312, []byte("audio"))...)
+	got, err := Duration(data)
+	if err != nil || got != 5*time.Second {
+		t.Errorf("Duration = %v, %v; want 5s", got, err)
+	}
+}
+
+func TestDuration_Unsupported(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("\x1a\x45\xdf\xa3 webm"), []byte("plain text")} {
+		if _, err := Duration(data); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("expected ErrUnsupported for %q, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AdminRole is the access level granted by an admin credential
+type AdminRole int
+
+const (
+	RoleNone  AdminRole = iota
+	RoleRead            // GET endpoints (usage, history, metrics, ...)
+	RoleWrite           // everything, including limit and key changes
+)
+
+func (r AdminRole) String() string {
+	switch r {
+	case RoleRead:
+		return "read"
+	case RoleWrite:
+		return "write"
+	default:
+		return "none"
+	}
+}
+
+// AdminCredential grants a role to a bearer token or a basic auth user.
+// Tokens are also accepted as the password of a basic auth login with any username.
+type AdminCredential struct {
+	Role     AdminRole
+	Token    string
+	Username string
+	Password string
+}
+
+// AdminCredentials returns the admin API credentials from --admin-token, --admin-read-token
+// and --admin-auth-file. No credentials means the admin API is unauthenticated.
+func (cfg *Config) AdminCredentials() ([]AdminCredential, error) {
+	var creds []AdminCredential
+	if cfg.AdminToken != "" {
+		creds = append(creds, AdminCredential{Role: RoleWrite, Token: cfg.AdminToken})
+	}
+	if cfg.AdminReadToken != "" {
+		creds = append(creds, AdminCredential{Role: RoleRead, Token: cfg.AdminReadToken})
+	}
+	if cfg.AdminAuthFile != "" {
+		fileCreds, err := LoadAdminAuthFile(cfg.AdminAuthFile)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, fileCreds...)
+	}
+	return creds, nil
+}
+
+// LoadAdminAuthFile reads admin credentials, one per line:
+//
+//	<read|write> bearer <token>
+//	<read|write> basic <username>:<password>
+//
+// Blank lines and lines starting with # are ignored.
+func LoadAdminAuthFile(path string) ([]AdminCredential, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open admin auth file: %w", err)
+	}
+	defer f.Close()
+
+	var creds []AdminCredential
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"<read|write> <bearer|basic> <secret>\"", path, lineNo)
+		}
+
+		var cred AdminCredential
+		switch fields[0] {
+		case "read":
+			cred.Role = RoleRead
+		case "write":
+			cred.Role = RoleWrite
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown role %q (expected read or write)", path, lineNo, fields[0])
+		}
+		switch fields[1] {
+		case "bearer":
+			cred.Token = fields[2]
+		case "basic":
+			user, pass, ok := strings.Cut(fields[2], ":")
+			if !ok || user == "" || pass == "" {
+				return nil, fmt.Errorf("%s:%d: basic credentials must be <username>:<password>", path, lineNo)
+			}
+			cred.Username, cred.Password = user, pass
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown scheme %q (expected bearer or basic)", path, lineNo, fields[1])
+		}
+		creds = append(creds, cred)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read admin auth file: %w", err)
+	}
+	return creds, nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin-auth")
+	content := `# dashboards
+read basic grafana:viewer-pass
+
+write bearer ops-token
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{AdminToken: "rw-token", AdminReadToken: "ro-token", AdminAuthFile: path}
+	creds, err := cfg.AdminCredentials()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []AdminCredential{
+		{Role: RoleWrite, Token: "rw-token"},
+		{Role: RoleRead, Token: "ro-token"},
+		{Role: RoleRead, Username: "grafana", Password: "viewer-pass"},
+		{Role: RoleWrite, Token: "ops-token"},
+	}
+	if len(creds) != len(want) {
+		t.Fatalf("expected %d credentials, got %+v", len(want), creds)
+	}
+	for i := range want {
+		if creds[i] != want[i] {
+			t.Errorf("credential %d: got %+v, want %+v", i, creds[i], want[i])
+		}
+	}
+
+	if creds, err := (&Config{}).AdminCredentials(); err != nil || len(creds) != 0 {
+		t.Errorf("expected no credentials, got %+v (err=%v)", creds, err)
+	}
+}
+
+func TestLoadAdminAuthFile_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"admin bearer token",
+		"read digest token",
+		"read basic no-colon",
+		"read bearer",
+	} {
+		path := filepath.Join(t.TempDir(), "admin-auth")
+		if err := os.WriteFile(path, []byte(line+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadAdminAuthFile(path); err == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+
+	if _, err := LoadAdminAuthFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestConfigStringRedactsSecrets(t *testing.T) {
+	cfg := &Config{Port: 8080, UpstreamAPIKey: "sk-secret", AnthropicAPIKey: "sk-ant-secret", GeminiAPIKey: "gemini-secret", AdminToken: "rw-secret"}
+	s := cfg.String()
+	for _, secret := range []string{"sk-secret", "sk-ant-secret", "gemini-secret", "rw-secret"} {
+		if strings.Contains(s, secret) {
+			t.Errorf("secret %q leaked in %s", secret, s)
+		}
+	}
+	if !strings.Contains(s, "Port:8080") {
+		t.Errorf("expected regular fields in %s", s)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/goverture/goxy/pricing"
 	"github.com/spf13/pflag"
@@ -15,10 +16,30 @@ var (
 
 // Config holds the app configuration.
 type Config struct {
-	OpenAIBaseURL     string
-	Port              int
-	AdminPort         int
-	SpendLimitPerHour float64 // USD per API key per rolling hour (0 or <0 disables)
+	OpenAIBaseURL      string
+	Port               int
+	AdminPort          int
+	SpendLimitPerHour  float64       // USD per API key per rolling hour (0 or <0 disables)
+	PricingFile        string        // Optional YAML pricing file applied on top of the embedded defaults
+	PricingMerge       bool          // Merge PricingFile with the embedded defaults instead of replacing them
+	PricingWatch       time.Duration // How often PricingFile is checked for changes (0 disables)
+	SpendLimitPerDay   float64       // USD per API key per calendar day (<0 disables)
+	SpendLimitPerWeek  float64       // USD per API key per calendar week, starting Monday (<0 disables)
+	SpendLimitPerMonth float64       // USD per API key per calendar month (<0 disables)
+	BudgetTimezone     string        // IANA timezone the calendar budgets are aligned in
+	UpstreamAPIKey     string        // Provider key sent upstream in place of goxy-issued virtual keys
+	AdminToken         string        // Read-write bearer token for the admin API
+	AdminReadToken     string        // Read-only bearer token for the admin API
+	AdminAuthFile      string        // File with additional admin credentials (see LoadAdminAuthFile)
+	TokenizerDir       string        // Directory of tiktoken rank files replacing the bundled ones (o200k_base.tiktoken, cl100k_base.tiktoken)
+	RoutesFile         string        // YAML routing table of additional upstreams (see LoadRoutesFile)
+	Routes             []Route       // Loaded from RoutesFile; tried in order before OpenAIBaseURL
+	Fallbacks          []Fallback    // Loaded from RoutesFile; tried in order when OpenAIBaseURL keeps failing
+	Retry              RetryPolicy   // How failed upstream attempts are retried
+	AnthropicBaseURL   string        // Anthropic API base URL for /v1/messages (empty sends them to OpenAIBaseURL)
+	AnthropicAPIKey    string        // Anthropic key sent upstream in place of goxy-issued virtual keys
+	GeminiBaseURL      string        // Gemini API base URL for /v1beta/... requests (empty sends them to OpenAIBaseURL)
+	GeminiAPIKey       string        // Gemini key sent upstream in place of goxy-issued virtual keys
 }
 
 // ParseConfig parses command-line flags into a Config struct.
@@ -29,6 +50,28 @@ func ParseConfig() *Config {
 	pflag.IntVarP(&cfg.Port, "port", "p", 8080, "Port to listen on")
 	pflag.IntVarP(&cfg.AdminPort, "admin-port", "a", 8081, "Admin API port for usage monitoring and limit updates")
 	pflag.Float64VarP(&cfg.SpendLimitPerHour, "spend-limit-per-hour", "l", 2.0, "Per-API-key spend limit USD per hour ( <0 disable, 0 block all )")
+	pflag.StringVar(&cfg.PricingFile, "pricing-file", "", "YAML pricing file (defaults to the pricing table embedded in the binary)")
+	pflag.BoolVar(&cfg.PricingMerge, "pricing-merge", true, "Merge --pricing-file with the embedded pricing table (false replaces it)")
+	pflag.Float64Var(&cfg.SpendLimitPerDay, "spend-limit-per-day", -1, "Per-API-key spend limit USD per calendar day (<0 disable)")
+	pflag.Float64Var(&cfg.SpendLimitPerWeek, "spend-limit-per-week", -1, "Per-API-key spend limit USD per calendar week (<0 disable)")
+	pflag.Float64Var(&cfg.SpendLimitPerMonth, "spend-limit-per-month", -1, "Per-API-key spend limit USD per calendar month (<0 disable)")
+	pflag.StringVar(&cfg.BudgetTimezone, "budget-timezone", "UTC", "Timezone the day/week/month budgets are aligned in (e.g. Europe/Paris)")
+	pflag.StringVar(&cfg.UpstreamAPIKey, "upstream-api-key", "", "Provider API key used for requests made with goxy virtual keys (defaults to $OPENAI_API_KEY)")
+	pflag.StringVar(&cfg.AdminToken, "admin-token", "", "Read-write bearer token for the admin API (defaults to $GOXY_ADMIN_TOKEN)")
+	pflag.StringVar(&cfg.AdminReadToken, "admin-read-token", "", "Read-only bearer token for the admin API (defaults to $GOXY_ADMIN_READ_TOKEN)")
+	pflag.StringVar(&cfg.AdminAuthFile, "admin-auth-file", "", "File of admin API credentials, one \"<read|write> <bearer|basic> <secret>\" per line (defaults to $GOXY_ADMIN_AUTH_FILE)")
+	pflag.StringVar(&cfg.TokenizerDir, "tokenizer-dir", "", "Directory with o200k_base.tiktoken / cl100k_base.tiktoken replacing the bundled rank files")
+	pflag.StringVar(&cfg.RoutesFile, "routes-file", "", "YAML file routing requests to other upstreams by path prefix or model (defaults to $GOXY_ROUTES_FILE)")
+	pflag.StringVar(&cfg.AnthropicBaseURL, "anthropic-base-url", "https://api.anthropic.com", "Anthropic API base URL for /v1/messages requests")
+	pflag.StringVar(&cfg.AnthropicAPIKey, "anthropic-api-key", "", "Anthropic API key used for /v1/messages requests made with goxy virtual keys (defaults to $ANTHROPIC_API_KEY)")
+	pflag.StringVar(&cfg.GeminiBaseURL, "gemini-base-url", "https://generativelanguage.googleapis.com", "Gemini API base URL for generateContent (/v1beta/models/...) requests")
+	pflag.StringVar(&cfg.GeminiAPIKey, "gemini-api-key", "", "Gemini API key used for requests made with goxy virtual keys (defaults to $GEMINI_API_KEY)")
+	pflag.IntVar(&cfg.Retry.Attempts, "retry-attempts", 1, "Tries per upstream for requests failing with a retried status, an error or a timeout (1 disables retries)")
+	pflag.DurationVar(&cfg.Retry.Backoff, "retry-backoff", 250*time.Millisecond, "Wait before the first retry, doubled on each retry, with jitter")
+	pflag.DurationVar(&cfg.Retry.MaxBackoff, "retry-max-backoff", 5*time.Second, "Longest wait between retries, including the upstream's Retry-After")
+	pflag.IntSliceVar(&cfg.Retry.StatusCodes, "retry-status-codes", []int{429, 500, 502, 503, 504}, "Upstream statuses that are retried, then failed over")
+	pflag.DurationVar(&cfg.Retry.Timeout, "upstream-timeout", 0, "Time each upstream attempt has to return response headers before it is retried (0 disables)")
+	pflag.DurationVar(&cfg.PricingWatch, "pricing-watch-interval", 10*time.Second, "How often --pricing-file is checked for changes and reloaded (0 disables)")
 
 	var showVersion bool
 	pflag.BoolVarP(&showVersion, "version", "v", false, "Show version and exit")
@@ -40,6 +83,29 @@ func ParseConfig() *Config {
 		os.Exit(0)
 	}
 
+	// Read the key from the environment rather than a flag default so it never shows up in --help
+	if cfg.UpstreamAPIKey == "" {
+		cfg.UpstreamAPIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if cfg.AnthropicAPIKey == "" {
+		cfg.AnthropicAPIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if cfg.GeminiAPIKey == "" {
+		cfg.GeminiAPIKey = os.Getenv("GEMINI_API_KEY")
+	}
+	if cfg.AdminToken == "" {
+		cfg.AdminToken = os.Getenv("GOXY_ADMIN_TOKEN")
+	}
+	if cfg.AdminReadToken == "" {
+		cfg.AdminReadToken = os.Getenv("GOXY_ADMIN_READ_TOKEN")
+	}
+	if cfg.AdminAuthFile == "" {
+		cfg.AdminAuthFile = os.Getenv("GOXY_ADMIN_AUTH_FILE")
+	}
+	if cfg.RoutesFile == "" {
+		cfg.RoutesFile = os.Getenv("GOXY_ROUTES_FILE")
+	}
+
 	// Validate spend limit against maximum representable money amount
 	if cfg.SpendLimitPerHour > 0 && cfg.SpendLimitPerHour > pricing.MaxMoneyUSD() {
 		fmt.Fprintf(os.Stderr, "Error: spend-limit-per-hour (%.2f) exceeds maximum representable amount (%.2f USD)\n",
@@ -54,5 +120,81 @@ func ParseConfig() *Config {
 		os.Exit(1)
 	}
 
+	// Validate calendar budgets and their timezone
+	if _, _, err := cfg.Budgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Validate admin credentials
+	if _, err := cfg.AdminCredentials(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Validate the retry policy
+	if err := cfg.Retry.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Load the upstream routing table
+	if cfg.RoutesFile != "" {
+		table, err := LoadRoutesFile(cfg.RoutesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.Routes, cfg.Fallbacks = table.Routes, table.Fallbacks
+	}
+
 	return cfg
 }
+
+// String formats the config for logging, with secrets redacted
+func (cfg *Config) String() string {
+	redacted := *cfg
+	for _, secret := range []*string{&redacted.UpstreamAPIKey, &redacted.AnthropicAPIKey, &redacted.GeminiAPIKey, &redacted.AdminToken, &redacted.AdminReadToken} {
+		if *secret != "" {
+			*secret = "[redacted]"
+		}
+	}
+	redacted.Routes = make([]Route, len(cfg.Routes))
+	for i, rt := range cfg.Routes {
+		if rt.APIKey != "" {
+			rt.APIKey = "[redacted]"
+		}
+		redacted.Routes[i] = rt
+	}
+	type plain Config // avoid recursing into String
+	return fmt.Sprintf("%+v", plain(redacted))
+}
+
+// Budgets returns the configured calendar budgets (day/week/month) and the timezone they are aligned in
+func (cfg *Config) Budgets() ([]pricing.Budget, *time.Location, error) {
+	loc, err := time.LoadLocation(cfg.BudgetTimezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid budget-timezone %q: %w", cfg.BudgetTimezone, err)
+	}
+
+	var budgets []pricing.Budget
+	limits := []struct {
+		period   pricing.BudgetPeriod
+		limitUSD float64
+	}{
+		{pricing.PeriodDay, cfg.SpendLimitPerDay},
+		{pricing.PeriodWeek, cfg.SpendLimitPerWeek},
+		{pricing.PeriodMonth, cfg.SpendLimitPerMonth},
+	}
+	for _, l := range limits {
+		if l.limitUSD < 0 {
+			continue // disabled
+		}
+		if l.limitUSD > pricing.MaxMoneyUSD() {
+			return nil, nil, fmt.Errorf("spend-limit-per-%s (%.2f) exceeds maximum representable amount (%.2f USD)",
+				l.period, l.limitUSD, pricing.MaxMoneyUSD())
+		}
+		budgets = append(budgets, pricing.Budget{Period: l.period, Limit: pricing.NewMoneyFromUSD(l.limitUSD)})
+	}
+	return budgets, loc, nil
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RetryPolicy is how a failed upstream attempt is retried before the upstream's fallbacks are tried
+type RetryPolicy struct {
+	Attempts    int           // tries per upstream, including the first (1 disables retries)
+	Backoff     time.Duration // wait before the first retry, doubled on each retry, with jitter
+	MaxBackoff  time.Duration // cap of the wait, including Retry-After from the upstream
+	StatusCodes []int         // upstream statuses that are retried, e.g. 429 and 5xx
+	Timeout     time.Duration // time each attempt has to get response headers (0 disables)
+}
+
+// RetriesStatus reports whether an upstream response status is retried
+func (p RetryPolicy) RetriesStatus(status int) bool {
+	return slices.Contains(p.StatusCodes, status)
+}
+
+// BackoffFor returns the wait before retry n (1 for the first retry), without jitter
+func (p RetryPolicy) BackoffFor(n int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < n && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+func (p RetryPolicy) validate() error {
+	if p.Attempts < 1 {
+		return fmt.Errorf("retry-attempts must be at least 1, got %d", p.Attempts)
+	}
+	if p.Backoff < 0 || p.MaxBackoff < 0 || p.Timeout < 0 {
+		return fmt.Errorf("retry durations can't be negative")
+	}
+	for _, code := range p.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retry status code %d", code)
+		}
+	}
+	return nil
+}
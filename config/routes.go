@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Upstream authentication schemes of a route
+const (
+	AuthBearer = "bearer"  // Authorization: Bearer <key> (OpenAI, OpenRouter, most compatible servers)
+	AuthAPIKey = "api-key" // api-key: <key> (Azure OpenAI)
+	AuthNone   = "none"    // no credentials sent upstream (local servers)
+)
+
+// Route sends the requests it matches to another upstream than --openai-base-url.
+// A route matches by path prefix, by model name, or both.
+type Route struct {
+	Name       string   `yaml:"name"`
+	PathPrefix string   `yaml:"path_prefix,omitempty"` // e.g. /openrouter; removed before forwarding
+	Models     []string `yaml:"models,omitempty"`      // model names; a trailing * matches by prefix
+	BaseURL    string   `yaml:"base_url"`
+	Auth       string   `yaml:"auth,omitempty"`    // bearer (default), api-key or none
+	APIKey     string   `yaml:"api_key,omitempty"` // sent instead of the client's key; $VARS are expanded
+	// Azure OpenAI: /v1/... paths become /openai/deployments/{deployment}/...?api-version=
+	APIVersion  string            `yaml:"api_version,omitempty"`
+	Deployments map[string]string `yaml:"deployments,omitempty"` // model -> deployment, defaults to the model
+	// PricingNamespace prices models as "<namespace>/<model>" when the pricing table has that name
+	PricingNamespace string `yaml:"pricing_namespace,omitempty"`
+	// Fallbacks are tried in order once the route's upstream keeps failing
+	Fallbacks []Fallback `yaml:"fallbacks,omitempty"`
+}
+
+// Fallback is an upstream a request fails over to, optionally with another model
+type Fallback struct {
+	Route  string            `yaml:"route"`            // name of a route of the table
+	Models map[string]string `yaml:"models,omitempty"` // model substitutions, e.g. gpt-4o: gpt-4o-mini
+}
+
+// Model returns the model requested from the fallback in place of model
+func (fb *Fallback) Model(model string) string {
+	if sub, ok := fb.Models[model]; ok {
+		return sub
+	}
+	return model
+}
+
+// RoutingTable is the content of a routes file
+type RoutingTable struct {
+	Routes []Route `yaml:"routes"`
+	// Fallbacks of --openai-base-url
+	Fallbacks []Fallback `yaml:"fallbacks,omitempty"`
+}
+
+// FallbackOnly reports whether the route only serves as a fallback of other upstreams
+func (rt *Route) FallbackOnly() bool {
+	return rt.PathPrefix == "" && len(rt.Models) == 0
+}
+
+// MatchesPath reports whether path is under the route's path prefix
+func (rt *Route) MatchesPath(path string) bool {
+	if rt.PathPrefix == "" {
+		return false
+	}
+	rest, ok := strings.CutPrefix(path, rt.PathPrefix)
+	return ok && (rest == "" || strings.HasPrefix(rest, "/"))
+}
+
+// MatchesModel reports whether the route serves model
+func (rt *Route) MatchesModel(model string) bool {
+	for _, m := range rt.Models {
+		if prefix, ok := strings.CutSuffix(m, "*"); (ok && strings.HasPrefix(model, prefix)) || m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// Deployment returns the Azure deployment serving model
+func (rt *Route) Deployment(model string) string {
+	if d, ok := rt.Deployments[model]; ok {
+		return d
+	}
+	return model
+}
+
+// IsAzure reports whether the route rewrites paths to Azure OpenAI deployments
+func (rt *Route) IsAzure() bool {
+	return rt.APIVersion != ""
+}
+
+func (rt *Route) validate(fallback bool) error {
+	if rt.FallbackOnly() && !fallback {
+		return fmt.Errorf("needs a path_prefix or models, or to be a fallback")
+	}
+	if rt.PathPrefix != "" && (!strings.HasPrefix(rt.PathPrefix, "/") || strings.HasSuffix(rt.PathPrefix, "/")) {
+		return fmt.Errorf("path_prefix %q must start with / and not end with one", rt.PathPrefix)
+	}
+	u, err := url.Parse(rt.BaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid base_url %q", rt.BaseURL)
+	}
+	switch rt.Auth {
+	case AuthBearer, AuthAPIKey, AuthNone:
+	default:
+		return fmt.Errorf("unknown auth %q (expected bearer, api-key or none)", rt.Auth)
+	}
+	return nil
+}
+
+// LoadRoutesFile reads the upstream routing table, a YAML list of routes and the fallbacks of
+// --openai-base-url:
+//
+//	fallbacks:
+//	  - route: azure
+//	    models: {gpt-4o: gpt-4o-mini}
+//	routes:
+//	  - name: azure
+//	    path_prefix: /azure
+//	    base_url: https://my-resource.openai.azure.com
+//	    auth: api-key
+//	    api_key: ${AZURE_OPENAI_API_KEY}
+//	    api_version: 2024-10-21
+//	  - name: local
+//	    models: [llama3*]
+//	    base_url: http://localhost:11434
+//	    auth: none
+//
+// Routes are tried in order; requests no route matches go to --openai-base-url. Routes without
+// path_prefix and models are only used as fallbacks.
+func LoadRoutesFile(path string) (RoutingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RoutingTable{}, fmt.Errorf("failed to read routes file: %w", err)
+	}
+	var table RoutingTable
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return RoutingTable{}, fmt.Errorf("failed to parse routes file %s: %w", path, err)
+	}
+
+	names := make(map[string]bool, len(table.Routes))
+	for i := range table.Routes {
+		rt := &table.Routes[i]
+		if rt.Name == "" {
+			rt.Name = fmt.Sprintf("route-%d", i+1)
+		}
+		if names[rt.Name] {
+			return RoutingTable{}, fmt.Errorf("%s: duplicate route name %q", path, rt.Name)
+		}
+		names[rt.Name] = true
+	}
+
+	// Fallbacks must name other routes
+	fallbacks := make(map[string]bool)
+	checkFallbacks := func(owner string, fbs []Fallback) error {
+		for _, fb := range fbs {
+			if !names[fb.Route] {
+				return fmt.Errorf("%s: fallbacks of %s: unknown route %q", path, owner, fb.Route)
+			}
+			if fb.Route == owner {
+				return fmt.Errorf("%s: route %q can't be its own fallback", path, owner)
+			}
+			fallbacks[fb.Route] = true
+		}
+		return nil
+	}
+	if err := checkFallbacks("--openai-base-url", table.Fallbacks); err != nil {
+		return RoutingTable{}, err
+	}
+	for _, rt := range table.Routes {
+		if err := checkFallbacks(rt.Name, rt.Fallbacks); err != nil {
+			return RoutingTable{}, err
+		}
+	}
+
+	for i := range table.Routes {
+		rt := &table.Routes[i]
+		if rt.Auth == "" {
+			rt.Auth = AuthBearer
+		}
+		rt.APIKey = os.ExpandEnv(rt.APIKey)
+		if err := rt.validate(fallbacks[rt.Name]); err != nil {
+			return RoutingTable{}, fmt.Errorf("%s: route %q: %w", path, rt.Name, err)
+		}
+	}
+	return table, nil
+}
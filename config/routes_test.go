@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRoutesFile(t *testing.T) {
+	t.Setenv("TEST_AZURE_KEY", "azure-secret")
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	content := `routes:
+  - name: azure
+    path_prefix: /azure
+    base_url: https://my-resource.openai.azure.com
+    auth: api-key
+    api_key: ${TEST_AZURE_KEY}
+    api_version: 2024-10-21
+    deployments: {gpt-4o: prod-4o}
+  - models: [llama3*, mistral]
+    base_url: http://localhost:11434
+    pricing_namespace: local
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := LoadRoutesFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	routes := table.Routes
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %+v", routes)
+	}
+	azure, local := routes[0], routes[1]
+	if azure.APIKey != "azure-secret" || !azure.IsAzure() || azure.Deployment("gpt-4o") != "prod-4o" || azure.Deployment("gpt-4.1") != "gpt-4.1" {
+		t.Errorf("unexpected azure route %+v", azure)
+	}
+	if !azure.MatchesPath("/azure/v1/chat/completions") || azure.MatchesPath("/azurex/v1") || azure.MatchesPath("/v1/chat/completions") {
+		t.Error("unexpected path matching")
+	}
+	if local.Name != "route-2" || local.Auth != AuthBearer {
+		t.Errorf("expected defaults to be applied, got %+v", local)
+	}
+	if !local.MatchesModel("llama3.1:8b") || !local.MatchesModel("mistral") || local.MatchesModel("mistral-large") {
+		t.Error("unexpected model matching")
+	}
+
+	if s := (&Config{Routes: routes}).String(); strings.Contains(s, "azure-secret") {
+		t.Errorf("expected route keys to be redacted, got %s", s)
+	}
+}
+
+func TestLoadRoutesFile_Invalid(t *testing.T) {
+	for _, route := range []string{
+		"{base_url: http://localhost:11434}",
+		"{path_prefix: azure, base_url: http://localhost:11434}",
+		"{path_prefix: /azure, base_url: not-a-url}",
+		"{path_prefix: /azure, base_url: http://localhost:11434, auth: digest}",
+	} {
+		path := filepath.Join(t.TempDir(), "routes.yaml")
+		if err := os.WriteFile(path, []byte("routes: ["+route+"]"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRoutesFile(path); err == nil {
+			t.Errorf("expected an error for %s", route)
+		}
+	}
+}
+
+func TestLoadRoutesFile_Fallbacks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	content := `fallbacks:
+  - route: azure
+    models: {gpt-4o: gpt-4o-mini}
+routes:
+  - name: azure
+    base_url: https://my-resource.openai.azure.com
+    auth: api-key
+    api_version: 2024-10-21
+    fallbacks: [{route: backup}]
+  - name: backup
+    base_url: https://backup.example.com
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	table, err := LoadRoutesFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(table.Fallbacks) != 1 || table.Fallbacks[0].Model("gpt-4o") != "gpt-4o-mini" || table.Fallbacks[0].Model("gpt-4.1") != "gpt-4.1" {
+		t.Errorf("unexpected fallbacks %+v", table.Fallbacks)
+	}
+	if !table.Routes[0].FallbackOnly() || len(table.Routes[0].Fallbacks) != 1 {
+		t.Errorf("unexpected azure route %+v", table.Routes[0])
+	}
+
+	for _, content := range []string{
+		"fallbacks: [{route: missing}]\nroutes: [{path_prefix: /a, base_url: http://a}]",
+		"routes: [{name: a, path_prefix: /a, base_url: http://a, fallbacks: [{route: a}]}]",
+		"routes: [{name: a, path_prefix: /a, base_url: http://a}, {name: a, path_prefix: /b, base_url: http://b}]",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRoutesFile(path); err == nil {
+			t.Errorf("expected an error for %s", content)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{Attempts: 4, Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, StatusCodes: []int{429, 503}}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 10: 300 * time.Millisecond} {
+		if got := p.BackoffFor(n); got != want {
+			t.Errorf("BackoffFor(%d) = %v, want %v", n, got, want)
+		}
+	}
+	if !p.RetriesStatus(503) || p.RetriesStatus(500) {
+		t.Error("unexpected retried statuses")
+	}
+	if err := p.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (RetryPolicy{Attempts: 0}).validate(); err == nil {
+		t.Error("expected an error for 0 attempts")
+	}
+}
@@ -1,3 +0,0 @@
-module fake-openai
-
-go 1.21
\ No newline at end of file
@@ -5,7 +5,7 @@ import (
 	"net/http"
 	"os"
 
-	"fake-openai/handlers"
+	"github.com/goverture/goxy/internal/testutil"
 )
 
 func main() {
@@ -13,8 +13,12 @@ func main() {
 }
 
 func startFakeServer() {
-	http.HandleFunc("/v1/chat/completions", handlers.HandleChatCompletions)
-	http.HandleFunc("/v1/responses", handlers.HandleResponses)
+	// FAIL_TIMES=N answers the first N requests with FAIL_STATUS (default 503)
+	failures := testutil.FailFirstFromEnv()
+
+	http.HandleFunc("/v1/chat/completions", failures.Wrap(testutil.HandleChatCompletions))
+	http.HandleFunc("/v1/responses", failures.Wrap(testutil.HandleResponses))
+	http.HandleFunc("/v1/embeddings", failures.Wrap(testutil.HandleEmbeddings))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -27,5 +31,9 @@ func startFakeServer() {
 	log.Printf("Available endpoints:")
 	log.Printf("  POST %s/v1/chat/completions", port)
 	log.Printf("  POST %s/v1/responses", port)
+	log.Printf("  POST %s/v1/embeddings", port)
+	if failures.N > 0 {
+		log.Printf("Failing the first %d requests with status %d", failures.N, failures.Status)
+	}
 	log.Fatal(http.ListenAndServe(port, nil))
 }
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/goverture/goxy/config"
+	"github.com/goverture/goxy/utils"
+)
+
+// requiredRole returns the role needed for an admin request: reads need RoleRead,
+// anything that changes state needs RoleWrite. /health is always open.
+func requiredRole(r *http.Request) config.AdminRole {
+	if r.URL.Path == "/health" || r.Method == http.MethodOptions {
+		return config.RoleNone
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return config.RoleRead
+	}
+	if r.URL.Path == "/estimate" { // POST, but changes nothing
+		return config.RoleRead
+	}
+	return config.RoleWrite
+}
+
+// authenticate returns the highest role granted by the request's credentials, and who
+// presented them (the basic auth username or the masked token)
+func (ah *AdminHandler) authenticate(r *http.Request) (config.AdminRole, string) {
+	role, principal := config.RoleNone, ""
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return role, principal
+	}
+	token, isBearer := strings.CutPrefix(auth, "Bearer ")
+	user, pass, isBasic := r.BasicAuth()
+
+	for _, cred := range ah.credentials {
+		var ok bool
+		var name string
+		switch {
+		case cred.Token != "" && isBearer:
+			ok, name = secretEqual(token, cred.Token), utils.MaskAPIKeyForStorage(token)
+		case cred.Token != "" && isBasic:
+			ok, name = secretEqual(pass, cred.Token), user // any username
+		case cred.Username != "" && isBasic:
+			ok, name = secretEqual(user, cred.Username) && secretEqual(pass, cred.Password), user
+		}
+		if ok && cred.Role > role {
+			role, principal = cred.Role, name
+		}
+	}
+	return role, principal
+}
+
+// authorize checks the request against the configured credentials and writes the
+// 401/403 response when access is denied. Allowed requests carry who made them in their context.
+func (ah *AdminHandler) authorize(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	required := requiredRole(r)
+	if len(ah.credentials) == 0 || required == config.RoleNone {
+		return withAdminPrincipal(r, ""), true
+	}
+
+	role, principal := ah.authenticate(r)
+	if role == config.RoleNone {
+		w.Header().Add("WWW-Authenticate", `Bearer realm="goxy-admin"`)
+		w.Header().Add("WWW-Authenticate", `Basic realm="goxy-admin"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "authentication required"})
+		return r, false
+	}
+	if role < required {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "read-only credentials cannot " + r.Method + " " + r.URL.Path})
+		return r, false
+	}
+	return withAdminPrincipal(r, principal), true
+}
+
+type adminPrincipalKey struct{}
+
+// withAdminPrincipal records who made an admin request, as "<principal> (<remote host>)"
+func withAdminPrincipal(r *http.Request, principal string) *http.Request {
+	if principal == "" {
+		principal = "anonymous"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return r.WithContext(context.WithValue(r.Context(), adminPrincipalKey{}, principal+" ("+host+")"))
+}
+
+// adminPrincipal returns who made an admin request, for audit metadata
+func adminPrincipal(r *http.Request) string {
+	if p, ok := r.Context().Value(adminPrincipalKey{}).(string); ok {
+		return p
+	}
+	return "anonymous"
+}
+
+// secretEqual compares secrets in constant time
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
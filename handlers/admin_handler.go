@@ -3,13 +3,18 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/goverture/goxy/config"
+	"github.com/goverture/goxy/metrics"
 	"github.com/goverture/goxy/pricing"
 )
 
 // AdminHandler provides endpoints for monitoring usage and updating limits
 type AdminHandler struct {
-	manager pricing.PersistentLimitManager
+	manager     pricing.PersistentLimitManager
+	credentials []config.AdminCredential
 }
 
 // NewAdminHandler creates a new admin handler with the given persistent limit manager
@@ -17,6 +22,13 @@ func NewAdminHandler(manager pricing.PersistentLimitManager) *AdminHandler {
 	return &AdminHandler{manager: manager}
 }
 
+// NewAdminHandlerWithAuth creates an admin handler that requires one of the given credentials.
+// GET requests need a read or write credential, other methods a write credential; /health stays open.
+// With no credentials the handler is unauthenticated, like NewAdminHandler.
+func NewAdminHandlerWithAuth(manager pricing.PersistentLimitManager, credentials []config.AdminCredential) *AdminHandler {
+	return &AdminHandler{manager: manager, credentials: credentials}
+}
+
 // UsageResponse represents the response for usage queries
 type UsageResponse struct {
 	Usage []pricing.UsageInfoMoney `json:"usage"`
@@ -26,11 +38,92 @@ type LimitUpdateRequest struct {
 	LimitUSD float64 `json:"limit_usd"`
 }
 
+// KeyLimitResponse describes the limit that applies to a single key
+type KeyLimitResponse struct {
+	Key             string  `json:"key"`
+	MaskedKey       string  `json:"masked_key,omitempty"`
+	LimitUSD        float64 `json:"limit_usd"`
+	Override        bool    `json:"override"`
+	DefaultLimitUSD float64 `json:"default_limit_usd"`
+}
+
 // LimitUpdateResponse represents the response after updating limits
 type LimitUpdateResponse struct {
-	Message     string  `json:"message"`
-	OldLimitUSD float64 `json:"old_limit_usd"`
-	NewLimitUSD float64 `json:"new_limit_usd"`
+	Message     string    `json:"message"`
+	OldLimitUSD float64   `json:"old_limit_usd"`
+	NewLimitUSD float64   `json:"new_limit_usd"`
+	UpdatedBy   string    `json:"updated_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// VirtualKeyCreateRequest represents the request to issue a virtual key
+type VirtualKeyCreateRequest struct {
+	Name          string     `json:"name"`
+	LimitUSD      *float64   `json:"limit_usd,omitempty"` // per-hour budget; omitted uses the default limit
+	AllowedModels []string   `json:"allowed_models,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// VirtualKeyResponse describes a virtual key. Token is only set when the key is created.
+type VirtualKeyResponse struct {
+	pricing.VirtualKey
+	Token    string  `json:"token,omitempty"`
+	Active   bool    `json:"active"`
+	LimitUSD float64 `json:"limit_usd"`
+}
+
+// VirtualKeysResponse represents the response listing virtual keys
+type VirtualKeysResponse struct {
+	Keys  []VirtualKeyResponse `json:"keys"`
+	Total int                  `json:"total"`
+}
+
+// UsageHistoryResponse represents the response for ledger queries
+type UsageHistoryResponse struct {
+	GroupBy       pricing.HistoryGroup    `json:"group_by"`
+	Key           string                  `json:"key,omitempty"`
+	Model         string                  `json:"model,omitempty"`
+	From          *time.Time              `json:"from,omitempty"`
+	To            *time.Time              `json:"to,omitempty"`
+	Buckets       []pricing.HistoryBucket `json:"buckets"`
+	TotalRequests int                     `json:"total_requests"`
+	TotalCostUSD  float64                 `json:"total_cost_usd"`
+}
+
+// EstimateResponse represents the pre-flight cost estimate of a request. Budget fields are
+// only set when a key was given.
+type EstimateResponse struct {
+	CostEstimate
+	PromptCostUSD float64               `json:"prompt_cost_usd"`
+	MaxCostUSD    float64               `json:"max_cost_usd"` // prompt + max output tokens; the prompt alone when uncapped
+	ReservedUSD   float64               `json:"reserved_usd"` // held while the request is in flight
+	Key           string                `json:"key,omitempty"`
+	Budget        *pricing.BudgetStatus `json:"budget,omitempty"`
+	RemainingUSD  *float64              `json:"remaining_usd,omitempty"` // nil when the budget is unlimited
+	WouldAllow    *bool                 `json:"would_allow,omitempty"`
+}
+
+// BatchResponse describes a tracked batch job
+type BatchResponse struct {
+	pricing.Batch
+	Pending          bool    `json:"pending"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"` // 0 when the input file wasn't uploaded through the proxy
+	ChargedCostUSD   float64 `json:"charged_cost_usd"`
+}
+
+// BatchesResponse represents the response listing batch jobs
+type BatchesResponse struct {
+	Batches     []BatchResponse `json:"batches"`
+	Total       int             `json:"total"`
+	ExposureUSD float64         `json:"exposure_usd"` // estimated cost of the pending batches
+}
+
+// PricingReloadResponse represents the response after reloading the pricing configuration
+type PricingReloadResponse struct {
+	Message  string             `json:"message"`
+	Changed  bool               `json:"changed"`
+	Previous pricing.ConfigInfo `json:"previous"`
+	Active   pricing.ConfigInfo `json:"active"`
 }
 
 // ServeHTTP handles admin requests
@@ -41,8 +134,8 @@ func (ah *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if origin := r.Header.Get("Origin"); origin != "" {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Vary", "Origin")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,PUT,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
 	}
 
 	if r.Method == http.MethodOptions {
@@ -50,18 +143,45 @@ func (ah *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r, ok := ah.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	// Per-key routes: /keys/{masked-or-hash}/...
+	if strings.HasPrefix(r.URL.Path, "/keys/") {
+		ah.handleKeyRoutes(w, r)
+		return
+	}
+
 	switch r.URL.Path {
+	case "/keys":
+		ah.handleVirtualKeys(w, r)
 	case "/usage":
 		ah.handleUsage(w, r)
+	case "/usage/history":
+		ah.handleUsageHistory(w, r)
 	case "/limit":
 		ah.handleLimit(w, r)
+	case "/estimate":
+		ah.handleEstimate(w, r)
+	case "/batches":
+		ah.handleBatches(w, r)
+	case "/pricing":
+		ah.handlePricingInfo(w, r)
+	case "/pricing/reload":
+		ah.handlePricingReload(w, r)
+	case "/pricing/resolve":
+		ah.handlePricingResolve(w, r)
+	case "/metrics":
+		ah.handleMetrics(w, r)
 	case "/health":
 		ah.HealthCheck(w, r)
 	default:
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(map[string]string{
 			"error":               "endpoint not found",
-			"available_endpoints": "/usage, /limit, /health",
+			"available_endpoints": "/usage, /usage/history, /limit, /keys, /keys/{id}, /keys/{key}/limit, /estimate, /batches, /pricing, /pricing/reload, /pricing/resolve, /metrics, /health",
 		})
 	}
 }
@@ -84,6 +204,131 @@ func (ah *AdminHandler) handleUsage(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleUsageHistory handles GET requests querying the spend ledger.
+// Query parameters: key (masked or hash), model, from/to (RFC 3339 or YYYY-MM-DD, to is exclusive)
+// and group_by (hour, day or model; defaults to day).
+func (ah *AdminHandler) handleUsageHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	params := r.URL.Query()
+	groupBy, err := pricing.ParseHistoryGroup(params.Get("group_by"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	q := pricing.HistoryQuery{Model: params.Get("model"), GroupBy: groupBy}
+	response := UsageHistoryResponse{GroupBy: groupBy, Model: q.Model}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+		out  **time.Time
+	}{{"from", &q.From, &response.From}, {"to", &q.To, &response.To}} {
+		raw := params.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseHistoryTime(raw)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid " + p.name + ": expected RFC 3339 time or YYYY-MM-DD date"})
+			return
+		}
+		*p.dst, *p.out = t, &t
+	}
+
+	if ident := params.Get("key"); ident != "" {
+		key, _, err := ah.manager.ResolveKey(ident)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		q.Key, response.Key = key, key
+	}
+
+	buckets, err := ah.manager.UsageHistory(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "failed to query usage history: " + err.Error()})
+		return
+	}
+
+	var total pricing.Money
+	for _, b := range buckets {
+		response.TotalRequests += b.Requests
+		total = total.Add(b.Cost)
+	}
+	response.Buckets = buckets
+	response.TotalCostUSD = total.ToUSD()
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseHistoryTime accepts an RFC 3339 timestamp or a UTC date
+func parseHistoryTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
+
+// handleEstimate handles POST requests estimating the cost of a chat completions or responses
+// payload. An optional "key" (masked or hashed) checks it against that key's remaining budget.
+func (ah *AdminHandler) handleEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	payload, err := readJSONBody(r)
+	if err != nil || payload == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON: expected a request payload"})
+		return
+	}
+	est, err := estimatePayload(payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "cannot estimate request: " + err.Error()})
+		return
+	}
+	response := EstimateResponse{
+		CostEstimate:  est,
+		PromptCostUSD: est.PromptCost.ToUSD(),
+		MaxCostUSD:    est.MaxCost.ToUSD(),
+		ReservedUSD:   est.Hold.ToUSD(),
+	}
+
+	if ident, _ := payload["key"].(string); ident != "" {
+		key, _, err := ah.manager.ResolveKey(ident)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		// Nothing is held: this only runs the proxy's admission check
+		reservation, allowed, status := ah.manager.ReserveWithin(key, 0, est.MaxCost)
+		reservation.Release()
+		response.Key, response.Budget, response.WouldAllow = key, &status, &allowed
+		if !status.Limit.IsNegative() {
+			remaining := pricing.Money(int64(status.Limit) - int64(status.Spent.Add(status.Reserved)))
+			if remaining.IsNegative() {
+				remaining = 0
+			}
+			remainingUSD := remaining.ToUSD()
+			response.RemainingUSD = &remainingUSD
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleLimit handles PUT requests for updating spending limits
 func (ah *AdminHandler) handleLimit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
@@ -99,29 +344,304 @@ func (ah *AdminHandler) handleLimit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get current limit for response
-	allUsage := ah.manager.GetAllUsage()
-	var oldLimit float64
-	if len(allUsage) > 0 {
-		oldLimit = allUsage[0].Limit.ToUSD()
-	} else {
-		// If no keys tracked yet, get limit from a dummy call
-		dummy := ah.manager.GetUsage("dummy")
-		oldLimit = dummy.Limit.ToUSD()
-	}
+	// Get current limit for response (keys with an override don't reflect the global limit)
+	oldLimit := ah.manager.DefaultLimit().ToUSD()
 
-	// Update the limit using the Money-based API
-	ah.manager.UpdateLimitFromUSD(req.LimitUSD)
+	// Update and persist the limit, recording who changed it
+	newLimit := pricing.Money(-1) // disabled
+	if req.LimitUSD >= 0 {
+		newLimit = pricing.NewMoneyFromUSD(req.LimitUSD)
+	}
+	updatedBy := adminPrincipal(r)
+	if err := ah.manager.UpdateLimitBy(newLimit, updatedBy); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "failed to save limit: " + err.Error()})
+		return
+	}
 
 	response := LimitUpdateResponse{
 		Message:     "Spending limit updated successfully",
 		OldLimitUSD: oldLimit,
 		NewLimitUSD: req.LimitUSD,
+		UpdatedBy:   updatedBy,
+		UpdatedAt:   time.Now().UTC(),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleKeyRoutes dispatches /keys/{masked-or-hash}/... requests
+func (ah *AdminHandler) handleKeyRoutes(w http.ResponseWriter, r *http.Request) {
+	ident, action, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/keys/"), "/")
+	if !found && ident != "" {
+		ah.handleVirtualKey(w, r, ident)
+		return
+	}
+	if action != "limit" || ident == "" {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "endpoint not found"})
+		return
+	}
+
+	key, maskedKey, err := ah.manager.ResolveKey(ident)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ah.handleKeyLimit(w, r, key, maskedKey)
+}
+
+// handleKeyLimit handles GET/PUT/DELETE requests for a single key's limit override
+func (ah *AdminHandler) handleKeyLimit(w http.ResponseWriter, r *http.Request, key, maskedKey string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req LimitUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		if req.LimitUSD > pricing.MaxMoneyUSD() {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "limit_usd exceeds maximum representable amount"})
+			return
+		}
+		limit := pricing.Money(-1) // disabled
+		if req.LimitUSD >= 0 {
+			limit = pricing.NewMoneyFromUSD(req.LimitUSD)
+		}
+		ah.manager.SetKeyLimit(key, limit)
+	case http.MethodDelete:
+		ah.manager.ClearKeyLimit(key)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	defaultLimit := ah.manager.DefaultLimit()
+	limit, override := ah.manager.GetKeyLimit(key)
+	if !override {
+		limit = defaultLimit
+	}
+	json.NewEncoder(w).Encode(KeyLimitResponse{
+		Key:             key,
+		MaskedKey:       maskedKey,
+		LimitUSD:        limitToUSD(limit),
+		Override:        override,
+		DefaultLimitUSD: limitToUSD(defaultLimit),
+	})
+}
+
+// handleBatches handles GET requests listing batch jobs created through the proxy.
+// Only pending batches (output not charged yet) are listed unless status=all.
+func (ah *AdminHandler) handleBatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var pendingOnly bool
+	switch status := r.URL.Query().Get("status"); status {
+	case "", "pending":
+		pendingOnly = true
+	case "all":
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid status " + status + " (expected pending or all)"})
+		return
+	}
+
+	batches := ah.manager.ListBatches(pendingOnly)
+	response := BatchesResponse{Batches: make([]BatchResponse, 0, len(batches)), Total: len(batches)}
+	var exposure pricing.Money
+	for _, b := range batches {
+		if b.Pending() {
+			exposure = exposure.Add(b.EstimatedCost)
+		}
+		response.Batches = append(response.Batches, BatchResponse{
+			Batch:            b,
+			Pending:          b.Pending(),
+			EstimatedCostUSD: b.EstimatedCost.ToUSD(),
+			ChargedCostUSD:   b.ChargedCost.ToUSD(),
+		})
+	}
+	response.ExposureUSD = exposure.ToUSD()
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleVirtualKeys handles GET (list) and POST (issue) requests for virtual keys
+func (ah *AdminHandler) handleVirtualKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys := ah.manager.ListVirtualKeys()
+		response := VirtualKeysResponse{Keys: make([]VirtualKeyResponse, 0, len(keys)), Total: len(keys)}
+		for _, vk := range keys {
+			response.Keys = append(response.Keys, ah.virtualKeyResponse(vk))
+		}
+		json.NewEncoder(w).Encode(response)
+	case http.MethodPost:
+		var req VirtualKeyCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		if req.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "name is required"})
+			return
+		}
+		if req.LimitUSD != nil && *req.LimitUSD > pricing.MaxMoneyUSD() {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "limit_usd exceeds maximum representable amount"})
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "expires_at must be in the future"})
+			return
+		}
+
+		token, vk, err := ah.manager.CreateVirtualKey(req.Name, req.AllowedModels, req.ExpiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "failed to create key: " + err.Error()})
+			return
+		}
+		if req.LimitUSD != nil {
+			limit := pricing.Money(-1) // disabled
+			if *req.LimitUSD >= 0 {
+				limit = pricing.NewMoneyFromUSD(*req.LimitUSD)
+			}
+			ah.manager.SetKeyLimit(vk.KeyHash, limit)
+		}
+
+		response := ah.virtualKeyResponse(vk)
+		response.Token = token
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+	}
+}
+
+// handleVirtualKey handles DELETE requests revoking a virtual key by ID
+func (ah *AdminHandler) handleVirtualKey(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	vk, err := ah.manager.RevokeVirtualKey(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(ah.virtualKeyResponse(vk))
+}
+
+// virtualKeyResponse adds the key's current state and effective limit
+func (ah *AdminHandler) virtualKeyResponse(vk pricing.VirtualKey) VirtualKeyResponse {
+	limit, override := ah.manager.GetKeyLimit(vk.KeyHash)
+	if !override {
+		limit = ah.manager.DefaultLimit()
+	}
+	return VirtualKeyResponse{
+		VirtualKey: vk,
+		Active:     vk.Active(time.Now()),
+		LimitUSD:   limitToUSD(limit),
+	}
+}
+
+// limitToUSD converts a limit for display, reporting disabled limits as -1
+func limitToUSD(limit pricing.Money) float64 {
+	if limit.IsNegative() {
+		return -1
+	}
+	return limit.ToUSD()
+}
+
+// handlePricingInfo handles GET requests reporting the active pricing configuration
+func (ah *AdminHandler) handlePricingInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(pricing.CurrentConfigInfo())
+}
+
+// handlePricingReload handles POST requests reloading the pricing configuration from its sources.
+// The new table is validated first; on failure the active table stays in place.
+func (ah *AdminHandler) handlePricingReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	previous := pricing.CurrentConfigInfo()
+	info, err := pricing.ReloadConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  "pricing reload failed: " + err.Error(),
+			"active": previous,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(PricingReloadResponse{
+		Message:  "Pricing configuration reloaded",
+		Changed:  info.Hash != previous.Hash,
+		Previous: previous,
+		Active:   info,
+	})
+}
+
+// handlePricingResolve handles GET requests showing which pricing entry a model name resolves to
+func (ah *AdminHandler) handlePricingResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "model query parameter is required"})
+		return
+	}
+	res, err := pricing.ResolveModel(model)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "failed to load pricing config: " + err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleMetrics serves the proxy metrics in the Prometheus text format
+func (ah *AdminHandler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	metrics.Default.Handler().ServeHTTP(w, r)
+}
+
 // HealthCheck provides a simple health check endpoint
 func (ah *AdminHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/goverture/goxy/config"
 	"github.com/goverture/goxy/persistence"
 	"github.com/goverture/goxy/pricing"
+	"github.com/goverture/goxy/utils"
 )
 
 // createTestManager creates a persistent limit manager for testing
@@ -341,3 +346,401 @@ func TestAdminHandler_ServeHTTP_CORSHeaders(t *testing.T) {
 		t.Errorf("expected Vary header, got %s", rr.Header().Get("Vary"))
 	}
 }
+
+func TestAdminHandler_PricingReload(t *testing.T) {
+	defer pricing.ResetConfig()
+
+	mgr := createTestManager(t, 2.0)
+	defer mgr.Close()
+	adminHandler := NewAdminHandler(mgr)
+
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	if err := os.WriteFile(path, []byte("models:\n  my-model:\n    prompt: 1.0\n"), 0o644); err != nil {
+		t.Fatalf("failed to write pricing file: %v", err)
+	}
+	if err := pricing.InitConfig(path, false); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+
+	// Active version is reported
+	rr := httptest.NewRecorder()
+	adminHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/pricing", nil))
+	var info pricing.ConfigInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to parse JSON response: %v", err)
+	}
+	if info.Hash == "" || info.Version == 0 || info.Source != path {
+		t.Fatalf("unexpected pricing info: %+v", info)
+	}
+
+	// Change the file and reload through the admin API
+	if err := os.WriteFile(path, []byte("models:\n  my-model:\n    prompt: 2.0\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite pricing file: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	adminHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/pricing/reload", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var response PricingReloadResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse JSON response: %v", err)
+	}
+	if !response.Changed || response.Active.Hash == info.Hash {
+		t.Fatalf("expected a changed configuration, got %+v", response)
+	}
+
+	// A broken file is rejected and the active table stays
+	if err := os.WriteFile(path, []byte("models: {}"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite pricing file: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	adminHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/pricing/reload", nil))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rr.Code)
+	}
+	if pricing.CurrentConfigInfo().Hash != response.Active.Hash {
+		t.Fatal("active pricing changed after a failed reload")
+	}
+
+	// Wrong method
+	rr = httptest.NewRecorder()
+	adminHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/pricing/reload", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestAdminHandler_KeyLimit(t *testing.T) {
+	mgr := createTestManager(t, 1.0)
+	defer mgr.Close()
+	adminHandler := NewAdminHandler(mgr)
+
+	hashedKey := utils.HashAuthKey("Bearer sk-batch1234567890")
+	maskedKey := utils.MaskAPIKeyForStorage("Bearer sk-batch1234567890")
+	mgr.AddCostWithMaskedKey(hashedKey, maskedKey, pricing.NewMoneyFromUSD(0.1))
+
+	do := func(method, path, body string) (*httptest.ResponseRecorder, KeyLimitResponse) {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		adminHandler.ServeHTTP(rr, req)
+		var response KeyLimitResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response
+	}
+
+	// Set an override through the masked key (URL-escaped)
+	rr, response := do(http.MethodPut, "/keys/"+url.PathEscape(maskedKey)+"/limit", `{"limit_usd": 50}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if response.Key != hashedKey || !response.Override || response.LimitUSD != 50 || response.DefaultLimitUSD != 1 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	if usage := mgr.GetUsage(hashedKey); usage.Limit.ToUSD() != 50 {
+		t.Fatalf("override not applied, limit %f", usage.Limit.ToUSD())
+	}
+
+	// Read it back through the hash
+	if rr, response = do(http.MethodGet, "/keys/"+hashedKey+"/limit", ""); !response.Override || response.MaskedKey != maskedKey {
+		t.Fatalf("unexpected response: %d %+v", rr.Code, response)
+	}
+
+	// Changing the global limit does not affect the override
+	limitReq := httptest.NewRequest(http.MethodPut, "/limit", bytes.NewBufferString(`{"limit_usd": 2}`))
+	limitRR := httptest.NewRecorder()
+	adminHandler.ServeHTTP(limitRR, limitReq)
+	var limitResponse LimitUpdateResponse
+	json.Unmarshal(limitRR.Body.Bytes(), &limitResponse)
+	if limitResponse.OldLimitUSD != 1 {
+		t.Fatalf("expected old global limit 1, got %f", limitResponse.OldLimitUSD)
+	}
+	if usage := mgr.GetUsage(hashedKey); usage.Limit.ToUSD() != 50 {
+		t.Fatalf("override lost after global update, limit %f", usage.Limit.ToUSD())
+	}
+
+	// Delete the override
+	if rr, response = do(http.MethodDelete, "/keys/"+hashedKey+"/limit", ""); response.Override || response.LimitUSD != 2 {
+		t.Fatalf("unexpected response after delete: %d %+v", rr.Code, response)
+	}
+
+	// Unknown masked key
+	if rr, _ = do(http.MethodGet, "/keys/sk-none...none/limit", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+	// Invalid JSON
+	if rr, _ = do(http.MethodPut, "/keys/"+hashedKey+"/limit", "{bad"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestAdminHandler_UsageHistory(t *testing.T) {
+	mgr := createTestManager(t, 2.0)
+	defer mgr.Close()
+	adminHandler := NewAdminHandler(mgr)
+
+	hashedKey := utils.HashAuthKey("Bearer sk-history1234567890")
+	maskedKey := utils.MaskAPIKeyForStorage("Bearer sk-history1234567890")
+	mgr.AddCostWithMaskedKey(hashedKey, maskedKey, pricing.NewMoneyFromUSD(0.5))
+	now := time.Now()
+	for _, model := range []string{"gpt-4o", "gpt-4o", "gpt-4o-mini"} {
+		mgr.RecordSpend(pricing.LedgerEntry{Timestamp: now, Key: hashedKey, Model: model, ServiceTier: "standard", PromptTokens: 10, Cost: pricing.NewMoneyFromUSD(0.25)})
+	}
+	mgr.RecordSpend(pricing.LedgerEntry{Timestamp: now, Key: "other", Model: "gpt-4o", Cost: pricing.NewMoneyFromUSD(1)})
+
+	do := func(query string) (*httptest.ResponseRecorder, UsageHistoryResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/usage/history?"+query, nil)
+		rr := httptest.NewRecorder()
+		adminHandler.ServeHTTP(rr, req)
+		var response UsageHistoryResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response
+	}
+
+	rr, response := do("key=" + url.QueryEscape(maskedKey) + "&group_by=model")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if response.Key != hashedKey || response.TotalRequests != 3 || response.TotalCostUSD != 0.75 || len(response.Buckets) != 2 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	if response.Buckets[0].Bucket != "gpt-4o" || response.Buckets[0].Requests != 2 {
+		t.Errorf("unexpected first bucket: %+v", response.Buckets[0])
+	}
+
+	// Default grouping is by day, across all keys
+	if _, response = do("model=gpt-4o&from=" + now.Add(-time.Hour).UTC().Format(time.RFC3339)); response.GroupBy != pricing.GroupByDay || response.TotalRequests != 3 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	// Empty range
+	if _, response = do("to=2000-01-01"); response.TotalRequests != 0 || response.Buckets == nil {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+
+	if rr, _ = do("group_by=week"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rr.Code)
+	}
+	if rr, _ = do("from=yesterday"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rr.Code)
+	}
+	if rr, _ = do("key=sk-none...none"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestAdminHandler_Estimate(t *testing.T) {
+	setupTestPricingConfig()
+	mgr := createTestManager(t, 0.01)
+	defer mgr.Close()
+	adminHandler := NewAdminHandler(mgr)
+
+	hashedKey := utils.HashAuthKey("Bearer sk-estimate1234567890")
+	maskedKey := utils.MaskAPIKeyForStorage("Bearer sk-estimate1234567890")
+	mgr.AddCostWithMaskedKey(hashedKey, maskedKey, pricing.NewMoneyFromUSD(0.004))
+
+	do := func(body string) (*httptest.ResponseRecorder, EstimateResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/estimate", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		adminHandler.ServeHTTP(rr, req)
+		var response EstimateResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response
+	}
+
+	// "Hello there": 3 + 1 + 2 + 3 = 9 prompt tokens, plus 100 output tokens
+	rr, response := do(`{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Hello there"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if response.PromptTokens != 9 || response.Encoding != "o200k_base" || response.MaxCostUSD != pricing.NewMoneyFromUSD(9*5.0/1e6+100*15.0/1e6).ToUSD() {
+		t.Fatalf("unexpected estimate: %+v", response)
+	}
+	if response.WouldAllow != nil || response.Budget != nil {
+		t.Errorf("budget fields need a key: %+v", response)
+	}
+
+	// $0.006 left: 100 output tokens fit, 1000 don't
+	_, response = do(`{"model":"gpt-4o","max_tokens":100,"key":"` + maskedKey + `","messages":[{"role":"user","content":"Hello there"}]}`)
+	if response.Key != hashedKey || response.WouldAllow == nil || !*response.WouldAllow || response.RemainingUSD == nil || *response.RemainingUSD != 0.006 {
+		t.Fatalf("unexpected estimate: %+v", response)
+	}
+	_, response = do(`{"model":"gpt-4o","max_tokens":1000,"key":"` + hashedKey + `","messages":[{"role":"user","content":"Hello there"}]}`)
+	if response.WouldAllow == nil || *response.WouldAllow || response.Budget.Period != pricing.PeriodHour {
+		t.Fatalf("unexpected estimate: %+v", response)
+	}
+	if usage := mgr.GetUsage(hashedKey); !usage.Reserved.IsZero() {
+		t.Errorf("estimates must not hold spend, got %v reserved", usage.Reserved)
+	}
+
+	if rr, _ = do(`{"messages":[]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a model, got %d", rr.Code)
+	}
+	if rr, _ = do(`not json`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid JSON, got %d", rr.Code)
+	}
+	if rr, _ = do(`{"model":"gpt-4o","key":"sk-none...none"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown key, got %d", rr.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/estimate", nil)
+	rr = httptest.NewRecorder()
+	adminHandler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestAdminHandler_Auth(t *testing.T) {
+	mgr := createTestManager(t, 2.0)
+	defer mgr.Close()
+	adminHandler := NewAdminHandlerWithAuth(mgr, []config.AdminCredential{
+		{Role: config.RoleWrite, Token: "rw-token"},
+		{Role: config.RoleRead, Token: "ro-token"},
+		{Role: config.RoleRead, Username: "grafana", Password: "viewer-pass"},
+	})
+
+	do := func(method, path, body string, setAuth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if setAuth != nil {
+			setAuth(req)
+		}
+		rr := httptest.NewRecorder()
+		adminHandler.ServeHTTP(rr, req)
+		return rr
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(user, pass string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, pass) }
+	}
+
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		auth       func(*http.Request)
+		wantStatus int
+	}{
+		{"health stays open", http.MethodGet, "/health", nil, http.StatusOK},
+		{"usage needs credentials", http.MethodGet, "/usage", nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/usage", bearer("nope"), http.StatusUnauthorized},
+		{"read token reads usage", http.MethodGet, "/usage", bearer("ro-token"), http.StatusOK},
+		{"basic user reads metrics", http.MethodGet, "/metrics", basic("grafana", "viewer-pass"), http.StatusOK},
+		{"basic wrong password", http.MethodGet, "/usage", basic("grafana", "nope"), http.StatusUnauthorized},
+		{"token as basic password", http.MethodGet, "/usage", basic("anyone", "ro-token"), http.StatusOK},
+		{"read token cannot update limit", http.MethodPut, "/limit", bearer("ro-token"), http.StatusForbidden},
+		{"read basic user cannot update limit", http.MethodPut, "/limit", basic("grafana", "viewer-pass"), http.StatusForbidden},
+		{"write token updates limit", http.MethodPut, "/limit", bearer("rw-token"), http.StatusOK},
+		{"write token reads usage", http.MethodGet, "/usage", bearer("rw-token"), http.StatusOK},
+		{"read token can estimate", http.MethodPost, "/estimate", bearer("ro-token"), http.StatusBadRequest}, // no model in the body
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := do(tc.method, tc.path, `{"limit_usd": 3}`, tc.auth)
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d body=%s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tc.wantStatus == http.StatusUnauthorized && len(rr.Header().Values("WWW-Authenticate")) != 2 {
+				t.Errorf("expected bearer and basic challenges, got %v", rr.Header().Values("WWW-Authenticate"))
+			}
+		})
+	}
+
+	// Only the write token changed the limit
+	if limit := mgr.DefaultLimit().ToUSD(); limit != 3 {
+		t.Errorf("expected limit 3, got %f", limit)
+	}
+
+	// Limit changes record who made them
+	rr := do(http.MethodPut, "/limit", `{"limit_usd": 4}`, basic("anyone", "rw-token"))
+	var response LimitUpdateResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.UpdatedBy != "anyone (192.0.2.1)" || response.UpdatedAt.IsZero() {
+		t.Errorf("unexpected audit metadata: %+v", response)
+	}
+}
+
+func TestAdminHandler_Batches(t *testing.T) {
+	mgr := createTestManager(t, 2.0)
+	defer mgr.Close()
+	adminHandler := NewAdminHandler(mgr)
+
+	mgr.RecordBatchFile(pricing.BatchFile{ID: "file-a", Requests: 10, EstimatedCost: pricing.NewMoneyFromUSD(0.3)})
+	mgr.RecordBatchFile(pricing.BatchFile{ID: "file-b", Requests: 5, EstimatedCost: pricing.NewMoneyFromUSD(0.2)})
+	for _, b := range []pricing.Batch{{ID: "batch_a", Key: "k", InputFileID: "file-a"}, {ID: "batch_b", Key: "k", InputFileID: "file-b"}} {
+		if _, err := mgr.RecordBatch(b); err != nil {
+			t.Fatalf("RecordBatch failed: %v", err)
+		}
+	}
+	mgr.MarkBatchCharged("batch_b", pricing.NewMoneyFromUSD(0.1))
+
+	do := func(query string) (*httptest.ResponseRecorder, BatchesResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/batches"+query, nil)
+		rr := httptest.NewRecorder()
+		adminHandler.ServeHTTP(rr, req)
+		var response BatchesResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response
+	}
+
+	rr, response := do("")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if response.Total != 1 || response.Batches[0].ID != "batch_a" || response.Batches[0].EstimatedCostUSD != 0.3 || response.ExposureUSD != 0.3 {
+		t.Errorf("unexpected pending batches: %+v", response)
+	}
+
+	_, response = do("?status=all")
+	if response.Total != 2 || response.ExposureUSD != 0.3 {
+		t.Errorf("unexpected batches: %+v", response)
+	}
+	for _, b := range response.Batches {
+		if b.ID == "batch_b" && (b.Pending || b.ChargedCostUSD != 0.1) {
+			t.Errorf("unexpected charged batch: %+v", b)
+		}
+	}
+
+	if rr, _ := do("?status=failed"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown status, got %d", rr.Code)
+	}
+}
+
+func TestAdminHandler_PricingResolve(t *testing.T) {
+	pricing.SetConfig(&pricing.PricingConfig{
+		Models: map[string]pricing.ModelPricing{
+			"gpt-4o-mini": {Prompt: 0.15, Completion: 0.6, Aliases: []string{"mini"}},
+		},
+	})
+	defer pricing.ResetConfig()
+
+	mgr := createTestManager(t, 2.0)
+	defer mgr.Close()
+	adminHandler := NewAdminHandler(mgr)
+
+	cases := map[string]pricing.ModelResolution{
+		"mini":                   {Model: "mini", Resolved: "gpt-4o-mini", Match: pricing.MatchAlias},
+		"gpt-4o-mini-2024-07-18": {Model: "gpt-4o-mini-2024-07-18", Resolved: "gpt-4o-mini", Match: pricing.MatchSnapshot},
+		"unknown":                {Model: "unknown", Match: pricing.MatchNone},
+	}
+	for model, want := range cases {
+		rr := httptest.NewRecorder()
+		adminHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/pricing/resolve?model="+model, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d body=%s", rr.Code, rr.Body.String())
+		}
+		var got pricing.ModelResolution
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse JSON response: %v", err)
+		}
+		if got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	adminHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/pricing/resolve", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a model, got %d", rr.Code)
+	}
+}
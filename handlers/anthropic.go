@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/goverture/goxy/config"
+)
+
+// isAnthropicRequest reports whether a request is for the Anthropic Messages API
+func isAnthropicRequest(r *http.Request) bool {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v1/messages")
+	return ok && (rest == "" || strings.HasPrefix(rest, "/"))
+}
+
+// anthropicAuth returns the caller's credentials as an Authorization header value. Anthropic
+// clients send their key in x-api-key, which is tracked as if it were a bearer token.
+func anthropicAuth(r *http.Request) string {
+	if key := r.Header.Get("x-api-key"); key != "" && r.Header.Get("Authorization") == "" {
+		return "Bearer " + key
+	}
+	return r.Header.Get("Authorization")
+}
+
+// injectAnthropicKey sends the Anthropic key of --anthropic-api-key upstream in place of a
+// virtual key. It returns false when no key is configured.
+func injectAnthropicKey(r *http.Request) bool {
+	key := config.Cfg.AnthropicAPIKey
+	if key == "" {
+		return false
+	}
+	r.Header.Del("Authorization")
+	r.Header.Set("x-api-key", key)
+	return true
+}
+
+// anthropicStreamPayload folds a streamed Messages API event into the message being built:
+// message_start carries the message with its input usage, and each message_delta the updated
+// (cumulative) usage. ok is false for events of other APIs.
+func anthropicStreamPayload(last, event map[string]interface{}) (payload map[string]interface{}, ok bool) {
+	switch event["type"] {
+	case "message_start":
+		msg, _ := event["message"].(map[string]interface{})
+		if _, hasUsage := msg["usage"].(map[string]interface{}); !hasUsage {
+			return last, true
+		}
+		return msg, true
+	case "message_delta":
+		delta, _ := event["usage"].(map[string]interface{})
+		if last == nil || delta == nil {
+			return last, true
+		}
+		usage, _ := last["usage"].(map[string]interface{})
+		if usage == nil {
+			usage = map[string]interface{}{}
+			last["usage"] = usage
+		}
+		for k, v := range delta {
+			if _, isNumber := v.(float64); isNumber {
+				usage[k] = v
+			}
+		}
+		return last, true
+	}
+	return last, false
+}
+
+// anthropicCountedOutput raises the output tokens of a Messages API stream cut short, of which
+// only message_start reported usage, to the tokens counted from its deltas
+func anthropicCountedOutput(payload map[string]interface{}, tokens int) {
+	if payload["type"] != "message" {
+		return
+	}
+	usage, _ := payload["usage"].(map[string]interface{})
+	if reported, _ := usage["output_tokens"].(float64); usage != nil && float64(tokens) > reported {
+		usage["output_tokens"] = float64(tokens)
+	}
+}
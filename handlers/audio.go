@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goverture/goxy/audio"
+	"github.com/goverture/goxy/pricing"
+)
+
+// fallbackAudioBitrate is the bitrate assumed for uploads whose duration can't be read (e.g. WebM).
+// It is low on purpose: compressed speech is rarely below it, so the duration errs high.
+const fallbackAudioBitrate = 32000 // bits per second
+
+// audioRequest holds what audio API calls are billed by when the response doesn't say:
+// the duration of the uploaded audio (transcriptions, translations) or the length of the
+// input text (speech, whose response is the audio itself)
+type audioRequest struct {
+	model      string
+	duration   time.Duration
+	characters int
+}
+
+type audioRequestContextKey struct{}
+
+// isAudioUploadPath reports whether the path is a transcription or translation endpoint
+func isAudioUploadPath(path string) bool {
+	return strings.HasSuffix(path, "/audio/transcriptions") || strings.HasSuffix(path, "/audio/translations")
+}
+
+// withAudioRequest attaches the billing parameters of an audio API request to its context.
+// Other requests are returned unchanged. The body is restored for forwarding.
+func withAudioRequest(r *http.Request) (*http.Request, error) {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return r, nil
+	}
+
+	var ar audioRequest
+	switch {
+	case isAudioUploadPath(r.URL.Path):
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return r, err
+		}
+		setRequestBody(r, body)
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		ar.model = multipartFields(body, params["boundary"])["model"]
+		file := multipartFile(body, params["boundary"], "file")
+		ar.duration, err = audio.Duration(file)
+		if err != nil {
+			ar.duration = time.Duration(int64(len(file)) * 8 * int64(time.Second) / fallbackAudioBitrate)
+			fmt.Printf("[proxy] Warning: can't read the audio duration (%v); estimated %s from the file size\n", err, ar.duration)
+		}
+	case strings.HasSuffix(r.URL.Path, "/audio/speech"):
+		payload, err := readJSONBody(r)
+		if err != nil {
+			return r, err
+		}
+		ar.model, _ = payload["model"].(string)
+		input, _ := payload["input"].(string)
+		ar.characters = utf8.RuneCountInString(input)
+	default:
+		return r, nil
+	}
+	return r.WithContext(context.WithValue(r.Context(), audioRequestContextKey{}, ar)), nil
+}
+
+// multipartFile returns the content of the named file part of a multipart/form-data body
+func multipartFile(body []byte, boundary, name string) []byte {
+	if boundary == "" {
+		return nil
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return nil
+		}
+		if part.FormName() == name && part.FileName() != "" {
+			data, err := io.ReadAll(part)
+			part.Close()
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil
+			}
+			return data
+		}
+		part.Close()
+	}
+}
+
+// cueEnd matches the end time of an SRT (00:01:02,500) or WebVTT (00:01:02.500, 01:02.500) cue
+var cueEnd = regexp.MustCompile(`-->\s*(?:(\d+):)?(\d{2}):(\d{2})[,.](\d{3})`)
+
+// subtitleDuration returns the end of the last cue of an SRT or WebVTT transcript response: the
+// audio lasts at least that long, whatever the uploaded file's header claims. It is 0 for other
+// responses. The body is restored for forwarding.
+func subtitleDuration(resp *http.Response) time.Duration {
+	if resp.Body == nil || !isAudioUploadPath(resp.Request.URL.Path) || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/") {
+		return 0
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0
+	}
+	cues := cueEnd.FindAllSubmatch(body, -1)
+	if len(cues) == 0 {
+		return 0
+	}
+	var d time.Duration
+	last := cues[len(cues)-1]
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second, time.Millisecond} {
+		n, _ := strconv.Atoi(string(last[i+1])) // hours are optional in WebVTT
+		d += time.Duration(n) * unit
+	}
+	return d
+}
+
+// audioRequestFrom returns the audio API parameters attached by withAudioRequest
+func audioRequestFrom(r *http.Request) (audioRequest, bool) {
+	ar, ok := r.Context().Value(audioRequestContextKey{}).(audioRequest)
+	return ar, ok
+}
+
+// priceAudioRequest prices an audio request by its measured duration or input characters
+func priceAudioRequest(ar audioRequest) (pricing.PriceResultMoney, bool) {
+	pr, err := pricing.ComputeAudioPriceMoney(ar.model, ar.duration, ar.characters)
+	return pr, err == nil
+}
+
+// estimateAudioRequest prices an audio request up front from its measured duration or input characters
+func estimateAudioRequest(ar audioRequest) (CostEstimate, bool) {
+	pr, ok := priceAudioRequest(ar)
+	if !ok {
+		return CostEstimate{}, false
+	}
+	return CostEstimate{Model: ar.model, ServiceTier: "standard", MaxCost: pr.TotalCost, Hold: pr.TotalCost}, true
+}
+
+// priceAudioResponse prices a JSON audio API response: by tokens or duration when the response
+// reports them, otherwise by the measured duration. Responses without a transcript (e.g. errors)
+// are not priced.
+func priceAudioResponse(ar audioRequest, parsed map[string]interface{}) (pricing.Usage, pricing.PriceResultMoney, bool) {
+	if usage, duration, ok := pricing.ParseAudioUsage(parsed); ok {
+		if duration == 0 {
+			pr, err := pricing.CalculatePrice(ar.model, usage)
+			return usage, pr, err == nil
+		}
+		ar.duration = duration
+	} else if _, ok := parsed["text"]; !ok {
+		return pricing.Usage{}, pricing.PriceResultMoney{}, false
+	}
+	pr, ok := priceAudioRequest(ar)
+	return pricing.Usage{}, pr, ok
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goverture/goxy/pricing"
+)
+
+// batchFileEstimate is the worst-case cost of the requests of a batch input file, at the batch tier
+type batchFileEstimate struct {
+	requests int
+	cost     pricing.Money
+}
+
+type batchFileContextKey struct{}
+
+// withBatchFile estimates a batch input file upload (POST /files with purpose=batch) and attaches
+// the estimate to the request's context. Other requests are returned unchanged. The body is
+// restored for forwarding.
+func withBatchFile(r *http.Request) (*http.Request, error) {
+	if r.Method != http.MethodPost || r.Body == nil || !strings.HasSuffix(r.URL.Path, "/files") {
+		return r, nil
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return r, err
+	}
+	setRequestBody(r, body)
+	if multipartFields(body, params["boundary"])["purpose"] != "batch" {
+		return r, nil
+	}
+	est := estimateBatchInput(multipartFile(body, params["boundary"], "file"))
+	return r.WithContext(context.WithValue(r.Context(), batchFileContextKey{}, est)), nil
+}
+
+// estimateBatchInput adds up the estimates of the requests of a batch input file (JSONL).
+// Requests without an output cap are estimated like in-flight requests, see EstimateMaxCost.
+func estimateBatchInput(data []byte) batchFileEstimate {
+	var est batchFileEstimate
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var req struct {
+			Body map[string]interface{} `json:"body"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil || req.Body == nil {
+			continue
+		}
+		est.requests++
+		req.Body["service_tier"] = "batch"
+		if ce, err := estimatePayload(req.Body); err == nil {
+			est.cost = est.cost.Add(ce.Hold)
+		}
+	}
+	return est
+}
+
+// batchFileFrom returns the estimate attached by withBatchFile
+func batchFileFrom(r *http.Request) (batchFileEstimate, bool) {
+	est, ok := r.Context().Value(batchFileContextKey{}).(batchFileEstimate)
+	return est, ok
+}
+
+// trackBatches records the batch input files and batch jobs in an upstream JSON response:
+// uploads, batch creation, and batch retrievals, cancellations and lists, which report the
+// status and the output file
+func trackBatches(mgr pricing.BatchStore, r *http.Request, parsed map[string]interface{}) {
+	switch parsed["object"] {
+	case "file":
+		id, _ := parsed["id"].(string)
+		est, ok := batchFileFrom(r)
+		if !ok || id == "" {
+			return
+		}
+		file := pricing.BatchFile{ID: id, Requests: est.requests, EstimatedCost: est.cost, CreatedAt: time.Now()}
+		if err := mgr.RecordBatchFile(file); err != nil {
+			fmt.Println("[proxy] Warning: failed to record batch file:", err)
+		}
+	case "batch":
+		trackBatch(mgr, r, parsed)
+	case "list":
+		data, _ := parsed["data"].([]interface{})
+		for _, item := range data {
+			if b, ok := item.(map[string]interface{}); ok && b["object"] == "batch" {
+				trackBatch(mgr, r, b)
+			}
+		}
+	}
+}
+
+// trackBatch records a batch created by the caller, or updates a tracked one
+func trackBatch(mgr pricing.BatchStore, r *http.Request, b map[string]interface{}) {
+	id, _ := b["id"].(string)
+	status, _ := b["status"].(string)
+	outputFileID, _ := b["output_file_id"].(string) // null until the batch completes
+	if id == "" {
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/batches") {
+		caller := identityFromRequest(r)
+		endpoint, _ := b["endpoint"].(string)
+		inputFileID, _ := b["input_file_id"].(string)
+		_, err = mgr.RecordBatch(pricing.Batch{
+			ID:           id,
+			Key:          caller.key,
+			MaskedKey:    caller.maskedKey,
+			Endpoint:     endpoint,
+			InputFileID:  inputFileID,
+			OutputFileID: outputFileID,
+			Status:       status,
+		})
+	} else {
+		err = mgr.UpdateBatch(id, status, outputFileID)
+	}
+	if err != nil {
+		fmt.Println("[proxy] Warning: failed to track batch:", err)
+	}
+}
+
+// fileContentID returns the file ID of a file content download (GET /files/{id}/content)
+func fileContentID(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet {
+		return "", false
+	}
+	rest, ok := strings.CutSuffix(r.URL.Path, "/content")
+	if !ok {
+		return "", false
+	}
+	i := strings.LastIndex(rest, "/files/")
+	if i < 0 || strings.Contains(rest[i+len("/files/"):], "/") {
+		return "", false
+	}
+	return rest[i+len("/files/"):], true
+}
+
+// batchLine is a request of a batch output file that was priced
+type batchLine struct {
+	usage pricing.Usage
+	pr    pricing.PriceResultMoney
+}
+
+// batchOutput is the priced requests of a batch output file
+type batchOutput struct {
+	lines []batchLine
+	total pricing.Money
+}
+
+// add prices a line of a batch output file (JSONL) at the batch tier. Failed requests aren't billed.
+func (o *batchOutput) add(raw []byte) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return
+	}
+	var line struct {
+		Response *struct {
+			StatusCode int                    `json:"status_code"`
+			Body       map[string]interface{} `json:"body"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(raw, &line); err != nil || line.Response == nil || line.Response.StatusCode != http.StatusOK {
+		return
+	}
+	model, _ := line.Response.Body["model"].(string)
+	usage, ok := pricing.ParseUsageFromResponse(line.Response.Body)
+	if !ok {
+		return
+	}
+	pr, err := pricing.CalculatePriceWithTier(model, usage, "batch")
+	if err != nil {
+		return
+	}
+	o.lines = append(o.lines, batchLine{usage: usage, pr: pr})
+	o.total = o.total.Add(pr.TotalCost)
+}
+
+// batchOutputReader forwards a batch output file download while pricing its lines as they pass,
+// so the file is never held in memory. onDone is called once the whole file went through; a
+// download cut short leaves the batch uncharged.
+type batchOutputReader struct {
+	body   io.ReadCloser
+	batch  string
+	line   []byte
+	out    batchOutput
+	onDone func(out *batchOutput)
+	once   sync.Once
+}
+
+func (b *batchOutputReader) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	chunk := p[:n]
+	for len(chunk) > 0 {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			b.line = append(b.line, chunk...)
+			break
+		}
+		b.line = append(b.line, chunk[:i]...)
+		b.out.add(b.line)
+		b.line = b.line[:0]
+		chunk = chunk[i+1:]
+	}
+	if err == io.EOF {
+		b.once.Do(func() {
+			b.out.add(b.line) // last line without a trailing newline
+			b.onDone(&b.out)
+		})
+	}
+	return n, err
+}
+
+func (b *batchOutputReader) Close() error {
+	b.once.Do(func() {
+		fmt.Printf("[proxy] Download of the output of batch %s ended early; batch not charged yet\n", b.batch)
+	})
+	return b.body.Close()
+}
+
+// chargeBatchOutput charges the priced requests of a batch output file to the key that created
+// the batch. A batch is only charged once, however many times its output is downloaded.
+func chargeBatchOutput(mgr pricing.PersistentLimitManager, r *http.Request, b pricing.Batch, out *batchOutput) {
+	lines, total := out.lines, out.total
+	charged, err := mgr.MarkBatchCharged(b.ID, total)
+	if err != nil {
+		fmt.Println("[proxy] Warning: failed to charge batch:", err)
+		return
+	}
+	if !charged {
+		fmt.Printf("[proxy] Batch %s was already charged\n", b.ID)
+		return
+	}
+
+	owner := withIdentity(r, requestIdentity{key: b.Key, maskedKey: b.MaskedKey})
+	for _, l := range lines {
+		recordPricedUsage(owner, l.usage, l.pr)
+		if err := mgr.RecordSpend(pricing.NewLedgerEntry(b.Key, l.usage, l.pr)); err != nil {
+			fmt.Println("[proxy] Warning: failed to record spend:", err)
+		}
+	}
+	mgr.AddCostWithMaskedKey(b.Key, b.MaskedKey, total)
+	fmt.Printf("[proxy] Batch %s charged: %d request(s), total=%s (estimated %s)\n", b.ID, len(lines), total, b.EstimatedCost)
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"time"
+
+	"github.com/goverture/goxy/config"
+)
+
+// errUpstreamTimeout is returned when no attempt got response headers in time
+var errUpstreamTimeout = errors.New("upstream timed out")
+
+// fallbackUpstream is an upstream a request fails over to
+type fallbackUpstream struct {
+	route    *config.Route
+	fallback config.Fallback
+	proxy    *httputil.ReverseProxy // its Director rewrites requests for the upstream
+}
+
+// replayPlan is what retries and failovers of a request need: the request as handed to the
+// proxy, its buffered body and the upstreams to try after the first one
+type replayPlan struct {
+	inbound   *http.Request
+	body      []byte
+	model     string
+	fallbacks []fallbackUpstream
+}
+
+type replayContextKey struct{}
+
+// callerFallbacks leaves out the fallbacks that can't serve the caller. Virtual keys can't fail
+// over to routes passing the client's key on, which would send the key of --upstream-api-key to
+// another upstream; other callers can't fail over to routes with their own key, only lent to
+// virtual keys.
+func callerFallbacks(fallbacks []fallbackUpstream, virtual bool) []fallbackUpstream {
+	var usable []fallbackUpstream
+	for _, fb := range fallbacks {
+		if virtual && (fb.route.APIKey != "" || fb.route.Auth == config.AuthNone) ||
+			!virtual && fb.route.APIKey == "" {
+			usable = append(usable, fb)
+		}
+	}
+	return usable
+}
+
+// withReplayPlan buffers the request body so the request can be replayed, and attaches the plan
+func withReplayPlan(r *http.Request, fallbacks []fallbackUpstream) (*http.Request, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return r, err
+		}
+		r.Body.Close()
+		setRequestBody(r, body)
+	}
+	model := ""
+	if len(fallbacks) > 0 {
+		model = requestModel(r)
+	}
+	plan := &replayPlan{inbound: r, body: body, model: model, fallbacks: fallbacks}
+	r = r.WithContext(context.WithValue(r.Context(), replayContextKey{}, plan))
+	plan.inbound = r
+	return r, nil
+}
+
+// replayPlanFrom returns the plan attached by the proxy handler
+func replayPlanFrom(r *http.Request) (*replayPlan, bool) {
+	plan, ok := r.Context().Value(replayContextKey{}).(*replayPlan)
+	return plan, ok
+}
+
+// hopHeaders are the hop-by-hop headers the reverse proxy leaves out of outbound requests
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// setBody gives a replayed request a fresh copy of the buffered body
+func (p *replayPlan) setBody(r *http.Request, body []byte) {
+	if body == nil {
+		r.Body, r.ContentLength = http.NoBody, 0
+		return
+	}
+	setRequestBody(r, body)
+}
+
+// retry returns a copy of an outbound request with a fresh body
+func (p *replayPlan) retry(out *http.Request) *http.Request {
+	next := out.Clone(out.Context())
+	p.setBody(next, p.body)
+	return next
+}
+
+// failover builds the outbound request for a fallback upstream from the inbound request, with
+// the fallback's model substituted in JSON bodies
+func (p *replayPlan) failover(ctx context.Context, fb fallbackUpstream) *http.Request {
+	out := p.inbound.Clone(ctx)
+	out.RequestURI = ""
+	body, model := p.body, p.model
+	if sub := fb.fallback.Model(model); sub != model {
+		// UseNumber keeps large integers (e.g. seed) intact when re-encoding
+		var payload map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err == nil && payload != nil {
+			payload["model"] = sub
+			if rewritten, err := json.Marshal(payload); err == nil {
+				body, model = rewritten, sub
+			}
+		}
+	}
+	p.setBody(out, body)
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	out = withRoute(out, fb.route, model)
+	fb.proxy.Director(out)
+	return out
+}
+
+// retryTransport retries failed upstream attempts (errors, timeouts and retried statuses) with
+// backoff, then fails over to the fallback upstreams of the request. Only the response it returns
+// reaches ModifyResponse, so only the attempt that succeeded is priced.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy config.RetryPolicy
+}
+
+func (t retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	plan, ok := replayPlanFrom(r)
+	if !ok {
+		return t.attempt(r) // not replayable, e.g. realtime sessions
+	}
+
+	attempts := max(t.policy.Attempts, 1)
+	out := r
+	for target := 0; ; target++ {
+		if target > 0 {
+			fb := plan.fallbacks[target-1]
+			fmt.Printf("[proxy] Failing over %s to route %s\n", r.URL.Path, fb.route.Name)
+			out = plan.failover(r.Context(), fb)
+		}
+		for n := 1; ; n++ {
+			resp, err := t.attempt(out)
+			if !t.retryable(r, resp, err) || (n == attempts && target == len(plan.fallbacks)) {
+				return resp, err
+			}
+			if n == attempts {
+				discardResponse(resp)
+				break // next upstream
+			}
+
+			wait := t.backoff(n, resp)
+			fmt.Printf("[proxy] Retrying %s in %v (attempt %d of %d): %s\n", out.URL.Path, wait, n+1, attempts, attemptOutcome(resp, err))
+			discardResponse(resp)
+			select {
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			}
+			out = plan.retry(out)
+		}
+	}
+}
+
+// attempt sends one request upstream, giving it the policy's timeout to return response headers
+func (t retryTransport) attempt(r *http.Request) (*http.Response, error) {
+	if t.policy.Timeout <= 0 {
+		return t.base.RoundTrip(r)
+	}
+	ctx, cancel := context.WithCancelCause(r.Context())
+	timer := time.AfterFunc(t.policy.Timeout, func() { cancel(errUpstreamTimeout) })
+	resp, err := t.base.RoundTrip(r.WithContext(ctx))
+	if !timer.Stop() && errors.Is(context.Cause(ctx), errUpstreamTimeout) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel(nil)
+		return nil, errUpstreamTimeout
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, nil // the upgraded connection is the body; released with the request
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+// retryable reports whether an attempt failed in a way worth trying again. Requests the client
+// gave up on are not.
+func (t retryTransport) retryable(r *http.Request, resp *http.Response, err error) bool {
+	if r.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return t.policy.RetriesStatus(resp.StatusCode)
+}
+
+// backoff returns the wait before retry n: the policy's exponential backoff with jitter, or the
+// upstream's Retry-After when longer, up to the policy's maximum
+func (t retryTransport) backoff(n int, resp *http.Response) time.Duration {
+	d := t.policy.BackoffFor(n)
+	if d > 0 {
+		d = d/2 + rand.N(d/2+1) // jitter in [d/2, d]
+	}
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(secs)*time.Second > d {
+			d = time.Duration(secs) * time.Second
+		}
+	}
+	if t.policy.MaxBackoff > 0 && d > t.policy.MaxBackoff {
+		d = t.policy.MaxBackoff
+	}
+	return d
+}
+
+// attemptOutcome describes a failed attempt for the logs
+func attemptOutcome(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+// discardResponse drains and closes the body of a response that won't be forwarded
+func discardResponse(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// cancelOnClose releases the context of an attempt once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/goverture/goxy/config"
+)
+
+// geminiModelPath matches Gemini model methods: /v1beta/models/gemini-2.5-pro:generateContent
+var geminiModelPath = regexp.MustCompile(`^/v1(?:beta|alpha)?/models/([^/:]+):(\w+)$`)
+
+// isGeminiRequest reports whether a request is for the Gemini API: anything under its versioned
+// paths, and model methods (OpenAI paths have no colon)
+func isGeminiRequest(r *http.Request) bool {
+	path := r.URL.Path
+	return strings.HasPrefix(path, "/v1beta/") || strings.HasPrefix(path, "/v1alpha/") || geminiModelPath.MatchString(path)
+}
+
+// geminiPathModel returns the model of a Gemini model method path, which is not in the body
+func geminiPathModel(r *http.Request) (string, bool) {
+	m := geminiModelPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// geminiAuth returns the caller's credentials as an Authorization header value. Gemini clients
+// send their key in x-goog-api-key or the key query parameter, which are tracked as bearer tokens.
+func geminiAuth(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	if key := r.Header.Get("x-goog-api-key"); key != "" {
+		return "Bearer " + key
+	}
+	if key := r.URL.Query().Get("key"); key != "" {
+		return "Bearer " + key
+	}
+	return ""
+}
+
+// injectGeminiKey sends the Gemini key of --gemini-api-key upstream in place of a virtual key.
+// It returns false when no key is configured.
+func injectGeminiKey(r *http.Request) bool {
+	key := config.Cfg.GeminiAPIKey
+	if key == "" {
+		return false
+	}
+	r.Header.Del("Authorization")
+	r.Header.Set("x-goog-api-key", key)
+	if q := r.URL.Query(); q.Has("key") {
+		q.Del("key")
+		r.URL.RawQuery = q.Encode()
+	}
+	return true
+}
+
+// geminiResponseModel returns the model a Gemini response is priced as: the model of the request
+// path, else the response's modelVersion
+func geminiResponseModel(r *http.Request, parsed map[string]interface{}) string {
+	if model, ok := geminiPathModel(r); ok {
+		return model
+	}
+	model, _ := parsed["modelVersion"].(string)
+	return model
+}
+
+// geminiStreamArrayPayload returns the last chunk carrying usage of a streamGenerateContent
+// response sent without alt=sse, which is a JSON array of chunks rather than events
+func geminiStreamArrayPayload(body []byte) (map[string]interface{}, bool) {
+	var chunks []map[string]interface{}
+	if err := json.Unmarshal(body, &chunks); err != nil {
+		return nil, false
+	}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		if _, ok := chunks[i]["usageMetadata"].(map[string]interface{}); ok {
+			return chunks[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/goverture/goxy/pricing"
+)
+
+// imageRequest holds the request parameters images API calls are billed by.
+// They are only in the request: the response has neither the model nor the size.
+type imageRequest struct {
+	model   string
+	n       int
+	size    string
+	quality string
+}
+
+type imageRequestContextKey struct{}
+
+// isImagesPath reports whether the path is an image generation, edit or variation endpoint
+func isImagesPath(path string) bool {
+	for _, suffix := range []string{"/images/generations", "/images/edits", "/images/variations"} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withImageRequest attaches the billing parameters of an images API request to its context.
+// Other requests are returned unchanged. The body is restored for forwarding.
+func withImageRequest(r *http.Request) (*http.Request, error) {
+	if r.Method != http.MethodPost || r.Body == nil || !isImagesPath(r.URL.Path) {
+		return r, nil
+	}
+
+	fields := map[string]string{}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" { // edits and variations upload images
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return r, err
+		}
+		setRequestBody(r, body)
+		fields = multipartFields(body, params["boundary"])
+	} else {
+		payload, err := readJSONBody(r)
+		if err != nil {
+			return r, err
+		}
+		for name, v := range payload {
+			switch v := v.(type) {
+			case string:
+				fields[name] = v
+			case interface{ String() string }: // json.Number
+				fields[name] = v.String()
+			}
+		}
+	}
+
+	ir := imageRequest{model: fields["model"], n: 1, size: fields["size"], quality: fields["quality"]}
+	if ir.model == "" {
+		ir.model = "dall-e-2" // the API default
+	}
+	if n, err := strconv.Atoi(fields["n"]); err == nil && n > 0 {
+		ir.n = n
+	}
+	return r.WithContext(context.WithValue(r.Context(), imageRequestContextKey{}, ir)), nil
+}
+
+// multipartFields returns the non-file fields of a multipart/form-data body
+func multipartFields(body []byte, boundary string) map[string]string {
+	fields := map[string]string{}
+	if boundary == "" {
+		return fields
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return fields
+		}
+		if part.FileName() == "" {
+			value, _ := io.ReadAll(io.LimitReader(part, 1024))
+			fields[part.FormName()] = string(value)
+		}
+		part.Close()
+	}
+}
+
+// imageRequestFrom returns the images API parameters attached by withImageRequest
+func imageRequestFrom(r *http.Request) (imageRequest, bool) {
+	ir, ok := r.Context().Value(imageRequestContextKey{}).(imageRequest)
+	return ir, ok
+}
+
+// estimateImageRequest prices the requested images up front from the per-image prices
+func estimateImageRequest(ir imageRequest) (CostEstimate, bool) {
+	pr, err := pricing.ComputeImagePriceMoney(ir.model, ir.n, ir.size, ir.quality)
+	if err != nil {
+		return CostEstimate{}, false
+	}
+	return CostEstimate{Model: ir.model, ServiceTier: "standard", MaxCost: pr.TotalCost, Hold: pr.TotalCost}, true
+}
+
+// priceImageResponse prices an images API response: by tokens when the model reports usage
+// (gpt-image-1), otherwise per returned image
+func priceImageResponse(ir imageRequest, parsed map[string]interface{}) (pricing.Usage, pricing.PriceResultMoney, bool) {
+	if usage, ok := pricing.ParseImageUsage(parsed); ok {
+		pr, err := pricing.CalculatePrice(ir.model, usage)
+		return usage, pr, err == nil
+	}
+
+	data, ok := parsed["data"].([]interface{})
+	if !ok || len(data) == 0 { // e.g. an error response
+		return pricing.Usage{}, pricing.PriceResultMoney{}, false
+	}
+	pr, err := pricing.ComputeImagePriceMoney(ir.model, len(data), ir.size, ir.quality)
+	return pricing.Usage{}, pr, err == nil
+}
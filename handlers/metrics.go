@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goverture/goxy/metrics"
+	"github.com/goverture/goxy/pricing"
+)
+
+type startContextKey struct{}
+
+type endpointContextKey struct{}
+
+// withStartTime records when the request was handed to the upstream, with the endpoint label of
+// the path the client requested: the Director rewrites the path for route prefixes, Azure
+// deployments and upstream base paths
+func withStartTime(r *http.Request) *http.Request {
+	path := r.URL.Path
+	if rr, ok := routeFrom(r); ok && rr.route.PathPrefix != "" {
+		path = strings.TrimPrefix(path, rr.route.PathPrefix)
+	}
+	ctx := context.WithValue(r.Context(), startContextKey{}, time.Now())
+	ctx = context.WithValue(ctx, endpointContextKey{}, endpointLabel(path))
+	return r.WithContext(ctx)
+}
+
+// requestEndpoint returns the endpoint label recorded by withStartTime
+func requestEndpoint(r *http.Request) string {
+	if endpoint, ok := r.Context().Value(endpointContextKey{}).(string); ok {
+		return endpoint
+	}
+	return endpointLabel(r.URL.Path)
+}
+
+// observeUpstreamLatency records the time until the upstream response headers arrived
+func observeUpstreamLatency(r *http.Request) {
+	if start, ok := r.Context().Value(startContextKey{}).(time.Time); ok {
+		metrics.UpstreamLatency.Observe(time.Since(start).Seconds(), requestEndpoint(r))
+	}
+}
+
+// recordRequest counts a proxied request once its model (if any) is known
+func recordRequest(r *http.Request, status int, model string) {
+	if model == "" {
+		model = "unknown"
+	}
+	metrics.Requests.Inc(requestEndpoint(r), model, strconv.Itoa(status), keyLabel(identityFromRequest(r).maskedKey))
+}
+
+// recordPricedUsage feeds the token and spend counters from a priced response
+func recordPricedUsage(r *http.Request, usage pricing.Usage, pr pricing.PriceResultMoney) {
+	model, key := string(pr.Model), keyLabel(identityFromRequest(r).maskedKey)
+	cached := usage.PromptCachedTokens
+	if cached > usage.PromptTokens {
+		cached = usage.PromptTokens
+	}
+	metrics.Tokens.Add(float64(usage.PromptTokens), model, key, "prompt")
+	metrics.Tokens.Add(float64(cached), model, key, "cached_prompt")
+	metrics.Tokens.Add(float64(usage.CompletionTokens), model, key, "completion")
+	// Token classes only reported by some models; their series appear once they are used
+	for tokenType, n := range map[string]int{
+		"reasoning":        usage.ReasoningTokens,
+		"audio_prompt":     usage.PromptAudioTokens,
+		"image_prompt":     usage.PromptImageTokens,
+		"audio_completion": usage.CompletionAudioTokens,
+		"image_completion": usage.CompletionImageTokens,
+	} {
+		if n > 0 {
+			metrics.Tokens.Add(float64(n), model, key, tokenType)
+		}
+	}
+	metrics.SpendUSD.Add(pr.TotalCost.ToUSD(), model, key)
+}
+
+// keyLabel is the key label value for a masked key
+func keyLabel(maskedKey string) string {
+	if maskedKey == "" {
+		return "none"
+	}
+	return maskedKey
+}
+
+// endpointLabel reduces a request path to a low-cardinality endpoint label by cutting it at the
+// first segment that looks like an ID, e.g. "/v1/responses/resp_123" becomes "/v1/responses".
+// Gemini model methods keep their method: "/v1beta/models/gemini-2.5-pro:generateContent"
+// becomes "/v1beta/models:generateContent".
+func endpointLabel(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	kept := make([]string, 0, len(segments))
+	method := ""
+	for i, seg := range segments {
+		isVersion := i == 0 && strings.HasPrefix(seg, "v")
+		if i == len(segments)-1 {
+			if id, m, ok := strings.Cut(seg, ":"); ok {
+				seg, method = id, ":"+m
+			}
+		}
+		if seg == "" || (!isVersion && strings.ContainsAny(seg, "0123456789_")) {
+			break
+		}
+		kept = append(kept, seg)
+	}
+	return "/" + strings.Join(kept, "/") + method
+}
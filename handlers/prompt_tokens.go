@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/goverture/goxy/tokenizer"
+)
+
+// Chat format overhead, as documented for the gpt-4o and gpt-4 generation models
+const (
+	tokensPerMessage = 3 // <|start|>{role}\n{content}<|end|>
+	tokensPerName    = 1
+	tokensPerReply   = 3 // every reply is primed with <|start|>assistant<|message|>
+)
+
+// imageInputTokens is charged per image: a 1024x1024 high detail image on gpt-4o
+// (85 base + 4 tiles * 170). Larger images cost more; this is an estimate, not a bound.
+const imageInputTokens = 765
+
+// countPromptTokens estimates the prompt tokens of a chat completions (messages) or
+// responses (input, instructions) payload, including tool definitions
+func countPromptTokens(enc tokenizer.Encoding, payload map[string]interface{}) int {
+	n := 0
+	if messages, ok := payload["messages"].([]interface{}); ok {
+		for _, m := range messages {
+			n += countMessageTokens(enc, m)
+		}
+		n += tokensPerReply
+	}
+
+	if instructions, ok := payload["instructions"].(string); ok && instructions != "" {
+		n += tokensPerMessage + enc.Count("system") + enc.Count(instructions)
+	}
+	// Anthropic Messages API: the system prompt is a top-level string or list of text blocks
+	switch system := payload["system"].(type) {
+	case string:
+		n += tokensPerMessage + enc.Count("system") + enc.Count(system)
+	case []interface{}:
+		n += tokensPerMessage + enc.Count("system") + countJSONTokens(enc, system)
+	}
+	// Gemini: contents and the system instruction are lists of parts
+	if contents, ok := payload["contents"]; ok {
+		n += countJSONTokens(enc, contents)
+	}
+	if instruction, ok := payload["systemInstruction"]; ok {
+		n += countJSONTokens(enc, instruction)
+	}
+	switch input := payload["input"].(type) {
+	case string:
+		n += tokensPerMessage + enc.Count("user") + enc.Count(input) + tokensPerReply
+	case []interface{}:
+		for _, item := range input {
+			n += countMessageTokens(enc, item)
+		}
+		n += tokensPerReply
+	}
+
+	if tools, ok := payload["tools"]; ok {
+		n += countJSONTokens(enc, tools)
+	}
+	return n
+}
+
+// countMessageTokens counts a chat message or responses input item. Items that aren't
+// messages (function call outputs, reasoning items, ...) are counted as their JSON.
+func countMessageTokens(enc tokenizer.Encoding, item interface{}) int {
+	msg, ok := item.(map[string]interface{})
+	if !ok {
+		return countJSONTokens(enc, item)
+	}
+	role, _ := msg["role"].(string)
+	if role == "" {
+		return countJSONTokens(enc, item)
+	}
+
+	n := tokensPerMessage + enc.Count(role)
+	if name, ok := msg["name"].(string); ok {
+		n += tokensPerName + enc.Count(name)
+	}
+	n += countContentTokens(enc, msg["content"])
+	if toolCalls, ok := msg["tool_calls"]; ok {
+		n += countJSONTokens(enc, toolCalls)
+	}
+	return n
+}
+
+// countContentTokens counts message content: a string or a list of text and image parts
+func countContentTokens(enc tokenizer.Encoding, content interface{}) int {
+	switch c := content.(type) {
+	case nil:
+		return 0
+	case string:
+		return enc.Count(c)
+	case []interface{}:
+		n := 0
+		for _, part := range c {
+			p, ok := part.(map[string]interface{})
+			if !ok {
+				n += countJSONTokens(enc, part)
+				continue
+			}
+			switch p["type"] {
+			case "text", "input_text", "output_text":
+				text, _ := p["text"].(string)
+				n += enc.Count(text)
+			case "image_url", "input_image":
+				n += imageInputTokens
+			default:
+				n += countJSONTokens(enc, part)
+			}
+		}
+		return n
+	default:
+		return countJSONTokens(enc, content)
+	}
+}
+
+func countJSONTokens(enc tokenizer.Encoding, v interface{}) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return enc.Count(string(b))
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,8 +15,9 @@ import (
 	"time"
 
 	"github.com/goverture/goxy/config"
+	"github.com/goverture/goxy/metrics"
 	"github.com/goverture/goxy/pricing"
-	"github.com/goverture/goxy/utils"
+	"github.com/goverture/goxy/tokenizer"
 )
 
 // stripForwardingHeaders removes X-Forwarded-* and similar before the upstream call.
@@ -31,18 +33,16 @@ func (t stripForwardingHeaders) RoundTrip(r *http.Request) (*http.Response, erro
 	return t.base.RoundTrip(r)
 }
 
-func NewProxyHandler(mgr pricing.PersistentLimitManager) http.Handler {
-	upstreamURL := config.Cfg.OpenAIBaseURL
-	upstream, err := url.Parse(upstreamURL)
-	if err != nil {
-		panic("invalid upstream URL: " + err.Error())
-	}
+// newUpstreamProxy builds the reverse proxy of one upstream. Requests matched to a route of the
+// routing table are rewritten for it (path, credentials) around the upstream URL being applied.
+func newUpstreamProxy(upstream *url.URL) *httputil.ReverseProxy {
 	proxy := httputil.NewSingleHostReverseProxy(upstream)
 	upHost := upstream.Host
 
 	// Rewrite outbound request
 	orig := proxy.Director
 	proxy.Director = func(r *http.Request) {
+		rewriteForRoute(r)
 		orig(r)
 
 		// Ensure correct Host/SNI for upstream/WAF
@@ -76,7 +76,20 @@ func NewProxyHandler(mgr pricing.PersistentLimitManager) http.Handler {
 		if proj := os.Getenv("OPENAI_PROJECT"); proj != "" && r.Header.Get("OpenAI-Project") == "" {
 			r.Header.Set("OpenAI-Project", proj)
 		}
+
+		// Routes may send their own key, or the client's in another header
+		injectRouteAuth(r)
+	}
+	return proxy
+}
+
+func NewProxyHandler(mgr pricing.PersistentLimitManager) http.Handler {
+	upstreamURL := config.Cfg.OpenAIBaseURL
+	upstream, err := url.Parse(upstreamURL)
+	if err != nil {
+		panic("invalid upstream URL: " + err.Error())
 	}
+	proxy := newUpstreamProxy(upstream)
 
 	// Transport configuration
 	baseTransport := &http.Transport{
@@ -86,11 +99,14 @@ func NewProxyHandler(mgr pricing.PersistentLimitManager) http.Handler {
 		IdleConnTimeout:     90 * time.Second,
 		TLSHandshakeTimeout: 10 * time.Second,
 	}
-	proxy.Transport = stripForwardingHeaders{base: baseTransport}
+	// Failed attempts are retried, then failed over to the upstream's fallbacks
+	proxy.Transport = retryTransport{base: stripForwardingHeaders{base: baseTransport}, policy: config.Cfg.Retry}
 
 	// Add CORS on the way out (useful for browsers) + disable buffering on some proxies
 	// Additionally, intercept JSON responses to log their contents before forwarding.
 	proxy.ModifyResponse = func(resp *http.Response) error {
+		observeUpstreamLatency(resp.Request)
+
 		// CORS headers
 		if origin := resp.Request.Header.Get("Origin"); origin != "" {
 			h := resp.Header
@@ -99,13 +115,64 @@ func NewProxyHandler(mgr pricing.PersistentLimitManager) http.Handler {
 			h.Set("Access-Control-Expose-Headers", "Content-Type, OpenAI-Processing-Ms")
 		}
 
+		// Realtime sessions: meter the events of the upgraded connection
+		if resp.StatusCode == http.StatusSwitchingProtocols && isRealtimeUpgrade(resp.Request) {
+			if conn, ok := resp.Body.(io.ReadWriteCloser); ok {
+				meter := newRealtimeMeter(mgr, resp.Request, conn)
+				recordRequest(resp.Request, resp.StatusCode, meter.model)
+				resp.Body = meter
+				return nil
+			}
+		}
+
+		// Batch output files: charge the batch's requests to the key that created it
+		if fileID, ok := fileContentID(resp.Request); ok && resp.StatusCode == http.StatusOK && resp.Body != nil {
+			if b, ok := mgr.BatchForOutputFile(fileID); ok {
+				req := resp.Request
+				recordRequest(req, resp.StatusCode, "")
+				resp.Body = &batchOutputReader{
+					body:   resp.Body,
+					batch:  b.ID,
+					onDone: func(out *batchOutput) { chargeBatchOutput(mgr, req, b, out) },
+				}
+				return nil
+			}
+		}
+
 		ct := resp.Header.Get("Content-Type")
+		// Streaming: forward chunks as they arrive and charge once the final usage event is seen
+		if strings.Contains(ct, "text/event-stream") && resp.Body != nil {
+			req, status := resp.Request, resp.StatusCode
+			resp.Body = &sseUsageReader{
+				body: resp.Body,
+				onDone: func(payload map[string]interface{}) {
+					if ar, ok := audioRequestFrom(req); ok && payload == nil {
+						recordRequest(req, status, ar.model)
+						chargeAudioRequest(mgr, req, status, ar)
+						return
+					}
+					if payload == nil {
+						recordRequest(req, status, "")
+						fmt.Println("[proxy] Warning: stream ended without usage; request not charged")
+						return
+					}
+					recordRequest(req, status, responseModel(req, payload))
+					chargeUsage(mgr, req, payload)
+				},
+				onAbort: func(payload map[string]interface{}, generated string) {
+					chargeAbortedStream(mgr, req, status, payload, generated)
+				},
+			}
+			return nil
+		}
+
 		// JSON full-body logging
 		if strings.Contains(ct, "application/json") && resp.Body != nil {
 			bodyBytes, err := io.ReadAll(resp.Body)
 			if err != nil {
 				// Restore an empty body so downstream doesn't panic
 				resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+				recordRequest(resp.Request, resp.StatusCode, "")
 				return nil // best-effort logging; don't fail the response
 			}
 
@@ -117,50 +184,207 @@ func NewProxyHandler(mgr pricing.PersistentLimitManager) http.Handler {
 			if err := json.Unmarshal(bodyBytes, &parsed); err == nil {
 				pretty, _ := json.MarshalIndent(parsed, "", "  ")
 				fmt.Println("[proxy] Upstream JSON response:\n" + string(pretty))
-				// Attempt pricing if usage + model present
-				modelName, _ := parsed["model"].(string)
-				// Service tier - default to "standard" if not present or not a string
-				serviceTier := "standard"
-				if tierRaw, ok := parsed["service_tier"].(string); ok && tierRaw != "" {
-					serviceTier = tierRaw
+				model := responseModel(resp.Request, parsed)
+				if ir, ok := imageRequestFrom(resp.Request); ok {
+					model = ir.model // not in images API responses
 				}
-
-				if usage, ok := pricing.ParseUsageFromResponse(parsed); ok {
-					// Use the new Money-based pricing for precision
-					if pr, err := pricing.CalculatePriceWithTier(modelName, usage, serviceTier); err == nil {
-						fmt.Println(pr.String())
-						// accumulate cost toward spend limit (use hashed Authorization header for privacy)
-						auth := resp.Request.Header.Get("Authorization")
-						hashedAuth := utils.HashAuthKey(auth)
-						maskedAuth := utils.MaskAPIKeyForStorage(auth)
-
-						// Use AddCostWithMaskedKey with hashed and masked keys
-						mgr.AddCostWithMaskedKey(hashedAuth, maskedAuth, pr.TotalCost)
-					}
+				if ar, ok := audioRequestFrom(resp.Request); ok {
+					model = ar.model
 				}
+				recordRequest(resp.Request, resp.StatusCode, model)
+				// Attempt pricing if usage + model present
+				chargeUsage(mgr, resp.Request, parsed)
+				trackBatches(mgr, resp.Request, parsed)
+			} else if chunk, ok := geminiStreamArrayPayload(bodyBytes); ok {
+				// Gemini streams requested without alt=sse arrive as one JSON array
+				recordRequest(resp.Request, resp.StatusCode, responseModel(resp.Request, chunk))
+				chargeUsage(mgr, resp.Request, chunk)
 			} else {
+				recordRequest(resp.Request, resp.StatusCode, "")
 				fmt.Println("[proxy] Failed to parse JSON response:", err)
 			}
+			return nil
 		}
+
+		// Audio API responses that aren't JSON (text transcripts, speech audio) are charged
+		// by the measured duration or input characters. Subtitle transcripts report how long
+		// the audio lasts at least.
+		if ar, ok := audioRequestFrom(resp.Request); ok {
+			ar.duration = max(ar.duration, subtitleDuration(resp))
+			recordRequest(resp.Request, resp.StatusCode, ar.model)
+			chargeAudioRequest(mgr, resp.Request, resp.StatusCode, ar)
+			return nil
+		}
+
+		recordRequest(resp.Request, resp.StatusCode, "")
 		return nil
 	}
 
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		http.Error(w, "upstream error: "+err.Error(), http.StatusBadGateway)
+		status := http.StatusBadGateway
+		if errors.Is(err, errUpstreamTimeout) {
+			status = http.StatusGatewayTimeout
+		}
+		recordRequest(r, status, "")
+		http.Error(w, "upstream error: "+err.Error(), status)
+	}
+
+	// Upstreams of the routing table share the transport and response handling
+	routes := config.Cfg.Routes
+	routeProxies := make([]*httputil.ReverseProxy, len(routes))
+	for i, rt := range routes {
+		routeUpstream, err := url.Parse(rt.BaseURL)
+		if err != nil {
+			panic("invalid upstream URL for route " + rt.Name + ": " + err.Error())
+		}
+		rp := newUpstreamProxy(routeUpstream)
+		rp.Transport, rp.ModifyResponse, rp.ErrorHandler = proxy.Transport, proxy.ModifyResponse, proxy.ErrorHandler
+		routeProxies[i] = rp
+	}
+
+	// Fallbacks of --openai-base-url and of each route, resolved to their upstreams
+	routeIndex := make(map[string]int, len(routes))
+	for i, rt := range routes {
+		routeIndex[rt.Name] = i
+	}
+	fallbackUpstreams := func(fbs []config.Fallback) []fallbackUpstream {
+		var ups []fallbackUpstream
+		for _, fb := range fbs {
+			if i, ok := routeIndex[fb.Route]; ok {
+				ups = append(ups, fallbackUpstream{route: &routes[i], fallback: fb, proxy: routeProxies[i]})
+			}
+		}
+		return ups
+	}
+	defaultFallbacks := fallbackUpstreams(config.Cfg.Fallbacks)
+	routeFallbacks := make([][]fallbackUpstream, len(routes))
+	for i := range routes {
+		routeFallbacks[i] = fallbackUpstreams(routes[i].Fallbacks)
 	}
 
+	// Anthropic Messages API and Gemini API calls go to their own upstreams
+	providerProxy := func(name, baseURL string) *httputil.ReverseProxy {
+		if baseURL == "" {
+			return proxy
+		}
+		providerUpstream, err := url.Parse(baseURL)
+		if err != nil {
+			panic("invalid " + name + " upstream URL: " + err.Error())
+		}
+		pp := newUpstreamProxy(providerUpstream)
+		pp.Transport, pp.ModifyResponse, pp.ErrorHandler = proxy.Transport, proxy.ModifyResponse, proxy.ErrorHandler
+		return pp
+	}
+	anthropicProxy := providerProxy("Anthropic", config.Cfg.AnthropicBaseURL)
+	geminiProxy := providerProxy("Gemini", config.Cfg.GeminiBaseURL)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract the authorization header as-is
+		// Extract the authorization header as-is (Anthropic and Gemini clients send their own headers instead)
 		auth := r.Header.Get("Authorization")
-		hashedAuth := utils.HashAuthKey(auth)
+		switch {
+		case isAnthropicRequest(r):
+			auth = anthropicAuth(r)
+		case isGeminiRequest(r):
+			auth = geminiAuth(r)
+		}
+		id := identityFromAuth(auth)
 
 		// Just warn if no auth header, don't block the request
 		if auth == "" {
 			fmt.Println("Warning: No Authorization header provided")
 		}
 
-		// Spend limit check BEFORE proxy (use hashed auth key for privacy)
-		if allowed, windowEnd, spent, lim := mgr.Allow(hashedAuth); !allowed {
+		// Spend limit check BEFORE proxy (use hashed auth key for privacy). The request's estimated
+		// maximum cost is held against the key until it has been priced, so parallel requests
+		// can't all pass while the spend is still under the limit. Requests whose worst-case cost
+		// doesn't fit in what is left of the budget are rejected up front.
+		// Images API calls are billed by request parameters (n, size, quality) missing from the response.
+		// Audio API calls are billed by the uploaded audio's duration or the input text's length.
+		// Batch input files are estimated on upload, to report the exposure of pending batches.
+		// Attached before virtual keys are checked, which needs the model of multipart uploads.
+		for _, attach := range []func(*http.Request) (*http.Request, error){withImageRequest, withAudioRequest, withBatchFile} {
+			var err error
+			if r, err = attach(r); err != nil {
+				http.Error(w, "failed to read request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// goxy-issued keys are checked here, and replaced by the real provider key below
+		token, virtual := virtualKeyToken(auth)
+		if virtual {
+			vk, status, msg := authorizeVirtualKey(mgr, r, token)
+			if status != 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]string{"error": msg})
+				return
+			}
+			id = requestIdentity{key: vk.KeyHash, maskedKey: vk.MaskedKey, virtual: true}
+		}
+		hashedAuth := id.key
+		r = withIdentity(r, id)
+
+		// Pick the upstream: the first route of the routing table serving the request, else
+		// --anthropic-base-url for the Messages API, --gemini-base-url for the Gemini API and
+		// --openai-base-url for the rest
+		target, fallbacks := proxy, defaultFallbacks
+		if len(routes) > 0 {
+			model := requestModel(r)
+			if i := matchRoute(routes, r, model); i >= 0 {
+				if !virtual && routes[i].APIKey != "" {
+					// The route's key is only lent to callers goxy authenticated
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(map[string]string{"error": "route " + routes[i].Name + " requires a goxy virtual key"})
+					return
+				}
+				if virtual && routes[i].APIKey == "" && routes[i].Auth != config.AuthNone {
+					// The upstream key of --upstream-api-key belongs to the default upstream
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(map[string]string{"error": "no upstream API key configured for route " + routes[i].Name})
+					return
+				}
+				r = withRoute(r, &routes[i], model)
+				target, fallbacks = routeProxies[i], routeFallbacks[i]
+			}
+		}
+		if target == proxy {
+			// Virtual keys are replaced by the key of the provider the request goes to
+			provider, providerTarget, injectKey := "upstream", proxy, injectUpstreamKey
+			switch {
+			case isAnthropicRequest(r):
+				provider, providerTarget, injectKey = "Anthropic", anthropicProxy, injectAnthropicKey
+			case isGeminiRequest(r):
+				provider, providerTarget, injectKey = "Gemini", geminiProxy, injectGeminiKey
+			}
+			if virtual && !injectKey(r) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "no " + provider + " API key configured for virtual keys"})
+				return
+			}
+			if providerTarget != proxy {
+				target, fallbacks = providerTarget, nil
+			}
+		}
+
+		est, estimated, err := estimateRequest(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if estimated {
+			r = withEstimate(r, est)
+		}
+		reservation, allowed, budget := mgr.ReserveWithin(hashedAuth, est.Hold, est.MaxCost)
+		defer reservation.Release() // after ServeHTTP, once the actual cost was added
+		if !allowed {
+			metrics.Rejections.Inc(keyLabel(id.maskedKey), string(budget.Period))
+			windowEnd, spent, lim := budget.WindowEnd, budget.Spent, budget.Limit
 			// Compute seconds until reset (window end)
 			secUntil := int(time.Until(windowEnd).Seconds())
 			if secUntil < 0 {
@@ -177,10 +401,150 @@ func NewProxyHandler(mgr pricing.PersistentLimitManager) http.Handler {
 			w.Header().Set("RateLimit-Reset", strconv.Itoa(secUntil))
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusTooManyRequests)
-			fmt.Fprintf(w, `{"error":"spend limit exceeded","limit_per_hour":%.2f,"spent_this_window":%.4f,"window_ends_at":"%s","retry_after_seconds":%d}`, lim.ToUSD(), spent.ToUSD(), windowEnd.UTC().Format(time.RFC3339), secUntil)
+			if budget.Spent.Add(budget.Reserved).LessThan(lim) { // not exhausted, the request is too expensive
+				fmt.Fprintf(w, `{"error":"estimated cost exceeds remaining budget","budget":"%s","limit":%.4f,"spent_this_window":%.4f,"estimated_cost":%.4f,"prompt_tokens":%d,"window_ends_at":"%s","retry_after_seconds":%d}`, budget.Period, lim.ToUSD(), spent.ToUSD(), est.MaxCost.ToUSD(), est.PromptTokens, windowEnd.UTC().Format(time.RFC3339), secUntil)
+				return
+			}
+			// limit_per_hour is kept for clients written before calendar budgets existed
+			fmt.Fprintf(w, `{"error":"spend limit exceeded","budget":"%s","limit":%.4f,"limit_per_hour":%.2f,"spent_this_window":%.4f,"window_ends_at":"%s","retry_after_seconds":%d}`, budget.Period, lim.ToUSD(), mgr.GetUsage(hashedAuth).Limit.ToUSD(), spent.ToUSD(), windowEnd.UTC().Format(time.RFC3339), secUntil)
+			return
+		}
+
+		// Realtime events are inspected as they pass: compressed frames (permessage-deflate) couldn't be
+		if isRealtimeUpgrade(r) {
+			r.Header.Del("Sec-WebSocket-Extensions")
+		}
+
+		// Streamed chat completions must report usage, otherwise they could not be charged
+		if err := injectStreamUsageOption(r); err != nil {
+			http.Error(w, "failed to read request body: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		proxy.ServeHTTP(w, r)
+		// Buffer the body so failed attempts can be replayed, on the same upstream or its fallbacks
+		if !isRealtimeUpgrade(r) {
+			fallbacks = callerFallbacks(fallbacks, virtual)
+			var err error
+			if r, err = withReplayPlan(r, fallbacks); err != nil {
+				http.Error(w, "failed to read request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		target.ServeHTTP(w, withStartTime(r))
 	})
 }
+
+// chargeUsage prices a parsed upstream payload (model + usage) and adds the cost
+// to the caller's spend window. Payloads without usable usage are ignored.
+func chargeUsage(mgr pricing.PersistentLimitManager, r *http.Request, parsed map[string]interface{}) {
+	if ir, ok := imageRequestFrom(r); ok {
+		if usage, pr, ok := priceImageResponse(ir, parsed); ok {
+			chargePrice(mgr, r, usage, pr)
+		}
+		return
+	}
+	if ar, ok := audioRequestFrom(r); ok {
+		if usage, pr, ok := priceAudioResponse(ar, parsed); ok {
+			chargePrice(mgr, r, usage, pr)
+		}
+		return
+	}
+
+	modelName := pricingModel(r, responseModel(r, parsed))
+	// Service tier - default to "standard" if not present or not a string
+	serviceTier := "standard"
+	if tierRaw, ok := parsed["service_tier"].(string); ok && tierRaw != "" {
+		serviceTier = tierRaw
+	}
+
+	usage, ok := pricing.ParseUsageFromResponse(parsed)
+	if !ok {
+		return
+	}
+
+	// Use the new Money-based pricing for precision
+	pr, err := pricing.CalculatePriceWithTier(modelName, usage, serviceTier)
+	if err != nil {
+		return
+	}
+	// Hosted tools of the Responses API (web search, file search, ...) are billed on top of the tokens
+	pr = pricing.AddToolCosts(pr, pricing.ParseToolUsage(parsed))
+	chargePrice(mgr, r, usage, pr)
+}
+
+// responseModel returns the model an upstream payload is for. Gemini responses have none but
+// a modelVersion; their model is in the request path.
+func responseModel(r *http.Request, parsed map[string]interface{}) string {
+	if _, ok := parsed["usageMetadata"]; ok {
+		return geminiResponseModel(r, parsed)
+	}
+	model, _ := parsed["model"].(string)
+	return model
+}
+
+// chargeAbortedStream charges a stream the client closed before its end, which has no final
+// usage: the usage reported so far (Anthropic, Gemini), else the pre-flight prompt estimate, with
+// the output counted from the text generated so far
+func chargeAbortedStream(mgr pricing.PersistentLimitManager, r *http.Request, status int, payload map[string]interface{}, generated string) {
+	if ar, ok := audioRequestFrom(r); ok && payload == nil {
+		recordRequest(r, status, ar.model)
+		chargeAudioRequest(mgr, r, status, ar)
+		return
+	}
+	if payload != nil {
+		model := responseModel(r, payload)
+		anthropicCountedOutput(payload, tokenizer.ForModel(model).Count(generated))
+		recordRequest(r, status, model)
+		chargeUsage(mgr, r, payload)
+		return
+	}
+
+	est, ok := estimateFrom(r)
+	if !ok {
+		recordRequest(r, status, "")
+		fmt.Println("[proxy] Warning: stream closed before usage for an unpriced model; request not charged")
+		return
+	}
+	model := est.Model
+	if rr, ok := routeFrom(r); ok && rr.model != "" {
+		model = pricingModel(r, rr.model) // a fallback may have swapped the model
+	}
+	completion := tokenizer.ForModel(model).Count(generated)
+	usage := pricing.Usage{PromptTokens: est.PromptTokens, CompletionTokens: completion, TotalTokens: est.PromptTokens + completion}
+	recordRequest(r, status, model)
+	pr, err := pricing.CalculatePriceWithTier(model, usage, est.ServiceTier)
+	if err != nil {
+		return
+	}
+	fmt.Println("[proxy] Stream closed before usage; charging the estimated prompt and the output so far")
+	chargePrice(mgr, r, usage, pr)
+}
+
+// chargeAudioRequest charges a successful audio API call by its measured duration or input characters
+func chargeAudioRequest(mgr pricing.PersistentLimitManager, r *http.Request, status int, ar audioRequest) {
+	if status < 200 || status >= 300 {
+		return
+	}
+	if pr, ok := priceAudioRequest(ar); ok {
+		chargePrice(mgr, r, pricing.Usage{}, pr)
+	}
+}
+
+// chargePrice adds a priced request to the caller's spend, the metrics and the ledger
+func chargePrice(mgr pricing.PersistentLimitManager, r *http.Request, usage pricing.Usage, pr pricing.PriceResultMoney) {
+	fmt.Println(pr.String())
+	recordPricedUsage(r, usage, pr)
+
+	// accumulate cost toward spend limit (use the caller's hashed key for privacy;
+	// the Authorization header may already hold the upstream key)
+	id := identityFromRequest(r)
+
+	// Use AddCostWithMaskedKey with hashed and masked keys
+	mgr.AddCostWithMaskedKey(id.key, id.maskedKey, pr.TotalCost)
+
+	// Keep the request in the spend ledger for historical queries
+	if err := mgr.RecordSpend(pricing.NewLedgerEntry(id.key, usage, pr)); err != nil {
+		fmt.Println("[proxy] Warning: failed to record spend:", err)
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/goverture/goxy/pricing"
+)
+
+// maxRealtimeEventBytes caps the size of a realtime event kept for inspection. Larger events
+// (long audio deltas) are forwarded without being parsed; response.done events are far smaller.
+const maxRealtimeEventBytes = 4 << 20
+
+// WebSocket opcodes (RFC 6455)
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpClose        = 0x8
+)
+
+// wsClosePolicyViolation is the close code sent when a session is ended for exceeding the budget
+const wsClosePolicyViolation = 1008
+
+var errRealtimeSessionClosed = errors.New("realtime session closed: spend limit exceeded")
+
+// isRealtimeUpgrade reports whether the request opens a realtime API WebSocket session
+func isRealtimeUpgrade(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, "/realtime") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// realtimeMeter wraps the upstream connection of a realtime session. Upstream events are forwarded
+// untouched; response.done events are charged as they arrive. Once the key's budget is exhausted,
+// the client gets an error event and a close frame, and the upstream connection is closed.
+// Reads happen on a single goroutine; only closing is shared with the one writing upstream.
+type realtimeMeter struct {
+	conn   io.ReadWriteCloser
+	mgr    pricing.PersistentLimitManager
+	req    *http.Request
+	frames wsFrameReader
+	model  string // from the URL, then from session events
+
+	closing atomic.Bool
+	pending []byte // frames for the client, sent before the session ends
+}
+
+// newRealtimeMeter meters the upgraded upstream connection of a realtime request
+func newRealtimeMeter(mgr pricing.PersistentLimitManager, r *http.Request, conn io.ReadWriteCloser) *realtimeMeter {
+	m := &realtimeMeter{conn: conn, mgr: mgr, req: r, model: r.URL.Query().Get("model")}
+	m.frames.onMessage = m.handleEvent
+	return m
+}
+
+// Read forwards upstream bytes to the client, up to the end of the event that ended the session
+func (m *realtimeMeter) Read(p []byte) (int, error) {
+	if m.closing.Load() {
+		if len(m.pending) == 0 {
+			return 0, errRealtimeSessionClosed
+		}
+		n := copy(p, m.pending)
+		m.pending = m.pending[n:]
+		return n, nil
+	}
+	n, err := m.conn.Read(p)
+	if n > 0 {
+		n = m.frames.feed(p[:n])
+	}
+	if m.closing.Load() {
+		return n, nil // the rest of the upstream data is dropped
+	}
+	return n, err
+}
+
+// Write forwards client bytes upstream until the session is closed
+func (m *realtimeMeter) Write(p []byte) (int, error) {
+	if m.closing.Load() {
+		return 0, errRealtimeSessionClosed
+	}
+	return m.conn.Write(p)
+}
+
+func (m *realtimeMeter) Close() error {
+	return m.conn.Close()
+}
+
+// handleEvent inspects a complete upstream text message. It returns true to end the session.
+func (m *realtimeMeter) handleEvent(msg []byte) bool {
+	var event struct {
+		Type     string                 `json:"type"`
+		Session  struct{ Model string } `json:"session"`
+		Response map[string]interface{} `json:"response"`
+	}
+	if err := json.Unmarshal(msg, &event); err != nil {
+		return false
+	}
+
+	switch event.Type {
+	case "session.created", "session.updated":
+		if event.Session.Model != "" {
+			m.model = event.Session.Model
+		}
+	case "response.done":
+		if event.Response == nil {
+			return false
+		}
+		event.Response["model"] = m.model // not in realtime responses
+		chargeUsage(m.mgr, m.req, event.Response)
+
+		if allowed, budget := m.mgr.AllowBudget(identityFromRequest(m.req).key); !allowed {
+			m.close(budget)
+			return true
+		}
+	}
+	return false
+}
+
+// close queues an error event and a close frame for the client and closes the upstream connection
+func (m *realtimeMeter) close(budget pricing.BudgetStatus) {
+	message := fmt.Sprintf("%s spend limit of $%.2f exceeded; closing the session", budget.Period, budget.Limit.ToUSD())
+	event, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    "invalid_request_error",
+			"code":    "spend_limit_exceeded",
+			"message": message,
+		},
+	})
+	reason := binary.BigEndian.AppendUint16(nil, wsClosePolicyViolation)
+	reason = append(reason, "spend limit exceeded"...)
+	m.pending = append(wsFrame(wsOpText, event), wsFrame(wsOpClose, reason)...)
+	m.closing.Store(true)
+	m.conn.Close()
+	fmt.Println("[proxy] Realtime session closed:", message)
+}
+
+// wsFrame encodes an unmasked (server to client) WebSocket frame
+func wsFrame(opcode byte, payload []byte) []byte {
+	b := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, byte(n))
+	case n <= 0xFFFF:
+		b = append(b, 126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	return append(b, payload...)
+}
+
+// wsFrameReader reassembles the text messages of a WebSocket byte stream, fed in arbitrary chunks.
+// Control frames, binary messages and masked frames are skipped.
+type wsFrameReader struct {
+	onMessage func(msg []byte) (stop bool)
+
+	header    []byte
+	inPayload bool
+	remaining uint64
+	fin       bool
+	skip      bool // payload of the current frame isn't kept
+	text      bool // the current message is a text message
+	msg       []byte
+	overflow  bool
+}
+
+// feed consumes p and returns how many bytes were consumed: all of them, unless onMessage
+// asked to stop, in which case it's the end of the message that stopped it
+func (fr *wsFrameReader) feed(p []byte) int {
+	consumed := 0
+	for consumed < len(p) {
+		if !fr.inPayload {
+			fr.header = append(fr.header, p[consumed])
+			consumed++
+			if !fr.parseHeader() {
+				continue
+			}
+			if fr.remaining > 0 {
+				continue
+			}
+		} else {
+			take := uint64(len(p) - consumed)
+			if take > fr.remaining {
+				take = fr.remaining
+			}
+			chunk := p[consumed : consumed+int(take)]
+			consumed += int(take)
+			fr.remaining -= take
+			if !fr.skip && fr.text && !fr.overflow {
+				if len(fr.msg)+len(chunk) > maxRealtimeEventBytes {
+					fr.overflow, fr.msg = true, nil
+				} else {
+					fr.msg = append(fr.msg, chunk...)
+				}
+			}
+			if fr.remaining > 0 {
+				continue
+			}
+		}
+		if fr.endFrame() {
+			return consumed
+		}
+	}
+	return consumed
+}
+
+// parseHeader decodes the frame header once it is complete
+func (fr *wsFrameReader) parseHeader() bool {
+	h := fr.header
+	if len(h) < 2 {
+		return false
+	}
+	need := 2
+	switch h[1] & 0x7F {
+	case 126:
+		need += 2
+	case 127:
+		need += 8
+	}
+	masked := h[1]&0x80 != 0
+	if masked {
+		need += 4
+	}
+	if len(h) < need {
+		return false
+	}
+
+	switch n := h[1] & 0x7F; n {
+	case 126:
+		fr.remaining = uint64(binary.BigEndian.Uint16(h[2:4]))
+	case 127:
+		fr.remaining = binary.BigEndian.Uint64(h[2:10])
+	default:
+		fr.remaining = uint64(n)
+	}
+	fr.fin = h[0]&0x80 != 0
+	opcode := h[0] & 0x0F
+	fr.skip = opcode >= wsOpClose || masked
+	if opcode != wsOpContinuation && opcode < wsOpClose { // first frame of a new message
+		fr.text, fr.msg, fr.overflow = opcode == wsOpText, fr.msg[:0], false
+	}
+	fr.header = fr.header[:0]
+	fr.inPayload = true
+	return true
+}
+
+// endFrame finishes the current frame, handing complete text messages to onMessage
+func (fr *wsFrameReader) endFrame() bool {
+	fr.inPayload = false
+	if fr.skip || !fr.fin || !fr.text || fr.overflow {
+		return false
+	}
+	return fr.onMessage(fr.msg)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/goverture/goxy/pricing"
+	"github.com/goverture/goxy/tokenizer"
+)
+
+// CostEstimate is the pre-flight estimate of a request's cost
+type CostEstimate struct {
+	Model           string `json:"model"`
+	ServiceTier     string `json:"service_tier"`
+	Encoding        string `json:"encoding"`
+	Exact           bool   `json:"exact"`             // prompt counted with the real vocabulary, not the heuristic
+	PromptTokens    int    `json:"prompt_tokens"`     // approximate: message framing follows the chat format
+	MaxOutputTokens int    `json:"max_output_tokens"` // requested output cap, 0 when uncapped
+
+	PromptCost pricing.Money `json:"-"`
+	MaxCost    pricing.Money `json:"-"` // prompt + requested output cap; the prompt alone when uncapped
+	Hold       pricing.Money `json:"-"` // reserved while in flight; assumes DefaultReservedOutputTokens when uncapped
+}
+
+type estimateContextKey struct{}
+
+// withEstimate attaches the request's pre-flight estimate, to charge streams cut short by it
+func withEstimate(r *http.Request, est CostEstimate) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), estimateContextKey{}, est))
+}
+
+// estimateFrom returns the estimate attached by the proxy handler
+func estimateFrom(r *http.Request) (CostEstimate, bool) {
+	est, ok := r.Context().Value(estimateContextKey{}).(CostEstimate)
+	return est, ok
+}
+
+var (
+	errNoModel = errors.New("model is missing")
+	// errUnpricedModel is returned for models without pricing when no default pricing is configured
+	errUnpricedModel = errors.New("model has no pricing")
+)
+
+// estimateRequest estimates the cost of a request before it is forwarded. Requests that can't
+// be priced (no JSON body, no model) are not estimated. Requests for a model without pricing
+// return an error: they could not be charged.
+func estimateRequest(r *http.Request) (CostEstimate, bool, error) {
+	if r.Method != http.MethodPost {
+		return CostEstimate{}, false, nil
+	}
+	if ir, ok := imageRequestFrom(r); ok {
+		est, ok := estimateImageRequest(ir)
+		return est, ok, nil
+	}
+	if ar, ok := audioRequestFrom(r); ok {
+		est, ok := estimateAudioRequest(ar)
+		return est, ok, nil
+	}
+	payload, err := readJSONBody(r)
+	if err != nil || payload == nil {
+		return CostEstimate{}, false, nil
+	}
+	if model, ok := geminiPathModel(r); ok {
+		payload["model"] = model
+	}
+	if model, ok := payload["model"].(string); ok {
+		payload["model"] = pricingModel(r, model) // the payload isn't forwarded
+	}
+	est, err := estimatePayload(payload)
+	if errors.Is(err, errUnpricedModel) {
+		return CostEstimate{}, false, err
+	}
+	return est, err == nil, nil
+}
+
+// estimatePayload estimates the cost of a chat completions or responses payload
+func estimatePayload(payload map[string]interface{}) (CostEstimate, error) {
+	model, _ := payload["model"].(string)
+	if model == "" {
+		return CostEstimate{}, errNoModel
+	}
+	// Unknown models are priced at zero: without a pricing entry or default pricing, nothing
+	// would be held or charged
+	if res, err := pricing.ResolveModel(model); err != nil || res.Match == pricing.MatchNone {
+		return CostEstimate{}, fmt.Errorf("%w: %s", errUnpricedModel, model)
+	}
+	serviceTier, _ := payload["service_tier"].(string)
+	if serviceTier == "" || serviceTier == "auto" || serviceTier == "default" {
+		serviceTier = "standard"
+	}
+
+	maxOutput := 0
+	limits := payload
+	if genConfig, ok := payload["generationConfig"].(map[string]interface{}); ok {
+		limits = genConfig // Gemini
+	}
+	for _, field := range []string{"max_completion_tokens", "max_tokens", "max_output_tokens", "maxOutputTokens"} {
+		if n, ok := limits[field].(json.Number); ok {
+			if v, err := n.Int64(); err == nil && v > 0 {
+				maxOutput = int(v)
+				break
+			}
+		}
+	}
+
+	enc := tokenizer.ForModel(model)
+	est := CostEstimate{
+		Model:           model,
+		ServiceTier:     serviceTier,
+		Encoding:        enc.Name(),
+		Exact:           enc.Exact(),
+		PromptTokens:    countPromptTokens(enc, payload),
+		MaxOutputTokens: maxOutput,
+	}
+
+	prompt, err := pricing.ComputePriceMoneyWithTier(model, pricing.Usage{
+		PromptTokens: est.PromptTokens,
+		TotalTokens:  est.PromptTokens,
+	}, serviceTier)
+	if err != nil {
+		return CostEstimate{}, err
+	}
+	worst, err := pricing.ComputePriceMoneyWithTier(model, pricing.Usage{
+		PromptTokens:     est.PromptTokens,
+		CompletionTokens: maxOutput,
+		TotalTokens:      est.PromptTokens + maxOutput,
+	}, serviceTier)
+	if err != nil {
+		return CostEstimate{}, err
+	}
+	hold, err := pricing.EstimateMaxCost(model, est.PromptTokens, maxOutput, serviceTier)
+	if err != nil {
+		return CostEstimate{}, err
+	}
+	est.PromptCost, est.MaxCost, est.Hold = prompt.TotalCost, worst.TotalCost, hold
+	return est, nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/goverture/goxy/config"
+	"github.com/goverture/goxy/pricing"
+)
+
+// routedRequest is the upstream route a request was matched to, with the model it was matched on
+type routedRequest struct {
+	route *config.Route // nil for --openai-base-url
+	model string
+}
+
+type routeContextKey struct{}
+
+// matchRoute returns the index of the first route serving the request, or -1 for the default upstream.
+// Routes with both a path prefix and models need both to match; routes with neither are only fallbacks.
+func matchRoute(routes []config.Route, r *http.Request, model string) int {
+	for i := range routes {
+		rt := &routes[i]
+		if rt.FallbackOnly() {
+			continue
+		}
+		if rt.PathPrefix != "" && !rt.MatchesPath(r.URL.Path) {
+			continue
+		}
+		if len(rt.Models) > 0 && !rt.MatchesModel(model) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// requestModel returns the model a request is for: from the images or audio form fields
+// attached on the way in, the Gemini model path, the realtime model query, or the JSON body
+func requestModel(r *http.Request) string {
+	if ir, ok := imageRequestFrom(r); ok {
+		return ir.model
+	}
+	if ar, ok := audioRequestFrom(r); ok {
+		return ar.model
+	}
+	if model, ok := geminiPathModel(r); ok {
+		return model
+	}
+	if isRealtimeUpgrade(r) {
+		return r.URL.Query().Get("model")
+	}
+	if r.Method != http.MethodPost {
+		return ""
+	}
+	payload, err := readJSONBody(r)
+	if err != nil {
+		return ""
+	}
+	model, _ := payload["model"].(string)
+	return model
+}
+
+// withRoute attaches the request's route to its context
+func withRoute(r *http.Request, rt *config.Route, model string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), routeContextKey{}, routedRequest{route: rt, model: model}))
+}
+
+// routeFrom returns the route attached by the proxy handler
+func routeFrom(r *http.Request) (routedRequest, bool) {
+	rr, ok := r.Context().Value(routeContextKey{}).(routedRequest)
+	return rr, ok && rr.route != nil
+}
+
+// rewriteForRoute adapts an outbound request to its route, before the upstream URL is applied:
+// the route's path prefix is removed and Azure routes get deployment paths and an api-version
+func rewriteForRoute(r *http.Request) {
+	rr, ok := routeFrom(r)
+	if !ok {
+		return
+	}
+	rt := rr.route
+
+	path := r.URL.Path
+	if rt.PathPrefix != "" {
+		path = strings.TrimPrefix(path, rt.PathPrefix)
+	}
+	if rt.IsAzure() {
+		// /v1/chat/completions -> /openai/deployments/{deployment}/chat/completions; model-less
+		// paths (/v1/files, /v1/batches) -> /openai/files
+		rest := strings.TrimPrefix(path, "/v1")
+		if rr.model != "" {
+			path = "/openai/deployments/" + url.PathEscape(rt.Deployment(rr.model)) + rest
+		} else {
+			path = "/openai" + rest
+		}
+		q := r.URL.Query()
+		q.Set("api-version", rt.APIVersion)
+		r.URL.RawQuery = q.Encode()
+	}
+	r.URL.Path, r.URL.RawPath = path, ""
+}
+
+// injectRouteAuth sets the credentials the route's upstream expects. The route's api_key is only
+// sent for callers with a virtual key; other callers' own key is passed on, in the header the
+// route's scheme uses.
+func injectRouteAuth(r *http.Request) {
+	rr, ok := routeFrom(r)
+	if !ok {
+		return
+	}
+	rt := rr.route
+
+	routeKey := ""
+	if identityFromRequest(r).virtual {
+		routeKey = rt.APIKey
+	}
+	key := routeKey
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	switch rt.Auth {
+	case config.AuthNone:
+		r.Header.Del("Authorization")
+	case config.AuthAPIKey:
+		r.Header.Del("Authorization")
+		if key != "" {
+			r.Header.Set("api-key", key)
+		}
+	default:
+		if routeKey != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+}
+
+// pricingModel is the name model is priced as: prefixed with the pricing namespace of the
+// request's route when the pricing table knows the namespaced name
+func pricingModel(r *http.Request, model string) string {
+	rr, ok := routeFrom(r)
+	if !ok || rr.route.PricingNamespace == "" || model == "" {
+		return model
+	}
+	namespaced := rr.route.PricingNamespace + "/" + model
+	if res, err := pricing.ResolveModel(namespaced); err == nil && res.Resolved != "" {
+		return namespaced
+	}
+	return model
+}
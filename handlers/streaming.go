@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// injectStreamUsageOption makes sure streamed chat completions report their usage.
+// Without stream_options.include_usage the upstream never sends a usage chunk, so the
+// request could not be charged. The body is only rewritten when the option is missing.
+func injectStreamUsageOption(r *http.Request) error {
+	if r.Method != http.MethodPost || r.Body == nil || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		return nil
+	}
+
+	payload, err := readJSONBody(r)
+	if err != nil {
+		return err
+	}
+	if payload == nil {
+		return nil // not JSON we understand; forward untouched
+	}
+
+	if stream, _ := payload["stream"].(bool); !stream {
+		return nil
+	}
+
+	opts, _ := payload["stream_options"].(map[string]interface{})
+	if opts == nil {
+		opts = map[string]interface{}{}
+	}
+	if _, set := opts["include_usage"]; set {
+		return nil // respect an explicit client choice
+	}
+	opts["include_usage"] = true
+	payload["stream_options"] = opts
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	setRequestBody(r, rewritten)
+	return nil
+}
+
+// readJSONBody reads the request body, restores it for forwarding and decodes it.
+// A nil payload with a nil error means the body is not a JSON object.
+func readJSONBody(r *http.Request) (map[string]interface{}, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	bodyBytes, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// Restore the original body; callers replace it if they rewrite the payload
+	setRequestBody(r, bodyBytes)
+
+	// UseNumber keeps large integers (e.g. seed) intact when re-encoding
+	var payload map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(bodyBytes))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return nil, nil
+	}
+	return payload, nil
+}
+
+// setRequestBody replaces the request body and keeps the content length consistent.
+func setRequestBody(r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+}
+
+// sseUsageReader forwards a text/event-stream body untouched while watching its events
+// for the final usage payload. When the stream ends, onDone is called once with the last
+// payload that carried usage (nil if none did). When it is closed before the end (the client
+// went away), onAbort is called instead, with the text generated so far.
+type sseUsageReader struct {
+	body      io.ReadCloser
+	line      []byte
+	last      map[string]interface{}
+	generated strings.Builder
+	onDone    func(payload map[string]interface{})
+	onAbort   func(payload map[string]interface{}, generated string)
+	once      sync.Once
+}
+
+func (s *sseUsageReader) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	if n > 0 {
+		s.scan(p[:n])
+	}
+	if err == io.EOF {
+		s.finish(true)
+	}
+	return n, err
+}
+
+func (s *sseUsageReader) Close() error {
+	s.finish(false)
+	return s.body.Close()
+}
+
+func (s *sseUsageReader) finish(complete bool) {
+	s.once.Do(func() {
+		if len(s.line) > 0 { // stream ended without a trailing newline
+			s.handleLine(s.line)
+			s.line = nil
+		}
+		if !complete && s.onAbort != nil {
+			s.onAbort(s.last, s.generated.String())
+			return
+		}
+		s.onDone(s.last)
+	})
+}
+
+// scan splits the passing bytes into lines; partial lines are kept until completed.
+func (s *sseUsageReader) scan(chunk []byte) {
+	for len(chunk) > 0 {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			s.line = append(s.line, chunk...)
+			return
+		}
+		s.line = append(s.line, chunk[:i]...)
+		s.handleLine(s.line)
+		s.line = s.line[:0]
+		chunk = chunk[i+1:]
+	}
+}
+
+func (s *sseUsageReader) handleLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+	if s.onAbort != nil {
+		s.generated.WriteString(generatedText(event))
+	}
+	// Anthropic streams spread the usage over message_start and message_delta
+	if payload, ok := anthropicStreamPayload(s.last, event); ok {
+		s.last = payload
+		return
+	}
+	if payload := usagePayloadFromEvent(event); payload != nil {
+		s.last = payload
+	}
+}
+
+// usagePayloadFromEvent returns the object carrying billable usage in a streamed event, if any.
+func usagePayloadFromEvent(event map[string]interface{}) map[string]interface{} {
+	// Responses API: the terminal event wraps the full response object (with usage)
+	switch event["type"] {
+	case "response.completed", "response.incomplete":
+		if resp, ok := event["response"].(map[string]interface{}); ok {
+			return resp
+		}
+		return nil
+	}
+
+	// Gemini: every chunk has the usage so far, the last one the total
+	if _, ok := event["usageMetadata"].(map[string]interface{}); ok {
+		return event
+	}
+
+	// Chat completions: only the last chunk has a non-null usage (include_usage)
+	if _, ok := event["usage"].(map[string]interface{}); ok {
+		return event
+	}
+	return nil
+}
+
+// generatedText returns the output text a streamed event adds: content and tool call argument
+// deltas of chat completions, the Responses API and the Anthropic Messages API
+func generatedText(event map[string]interface{}) string {
+	switch event["type"] {
+	case "response.output_text.delta", "response.refusal.delta", "response.function_call_arguments.delta",
+		"response.reasoning_summary_text.delta":
+		text, _ := event["delta"].(string)
+		return text
+	case "content_block_delta":
+		delta, _ := event["delta"].(map[string]interface{})
+		for _, field := range []string{"text", "partial_json", "thinking"} {
+			if text, ok := delta[field].(string); ok {
+				return text
+			}
+		}
+		return ""
+	}
+
+	choices, _ := event["choices"].([]interface{})
+	var text strings.Builder
+	for _, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		delta, _ := choice["delta"].(map[string]interface{})
+		for _, field := range []string{"content", "refusal"} {
+			if s, ok := delta[field].(string); ok {
+				text.WriteString(s)
+			}
+		}
+		calls, _ := delta["tool_calls"].([]interface{})
+		for _, tc := range calls {
+			call, _ := tc.(map[string]interface{})
+			fn, _ := call["function"].(map[string]interface{})
+			if args, ok := fn["arguments"].(string); ok {
+				text.WriteString(args)
+			}
+		}
+	}
+	return text.String()
+}
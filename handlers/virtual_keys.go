@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goverture/goxy/config"
+	"github.com/goverture/goxy/pricing"
+	"github.com/goverture/goxy/utils"
+)
+
+// requestIdentity is who a proxied request is tracked and charged as. It is resolved once
+// on the way in, because the Authorization header may be replaced before going upstream.
+type requestIdentity struct {
+	key       string // hashed key used for spend tracking
+	maskedKey string // masked key for display
+	virtual   bool   // authenticated with a goxy-issued key
+}
+
+type identityContextKey struct{}
+
+// identityFromAuth derives the identity of a caller from its Authorization header
+func identityFromAuth(auth string) requestIdentity {
+	return requestIdentity{key: utils.HashAuthKey(auth), maskedKey: utils.MaskAPIKeyForStorage(auth)}
+}
+
+// withIdentity attaches the caller's identity to the request context
+func withIdentity(r *http.Request, id requestIdentity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityContextKey{}, id))
+}
+
+// identityFromRequest returns the identity attached by the proxy handler,
+// falling back to the request's own Authorization header.
+func identityFromRequest(r *http.Request) requestIdentity {
+	if id, ok := r.Context().Value(identityContextKey{}).(requestIdentity); ok {
+		return id
+	}
+	return identityFromAuth(r.Header.Get("Authorization"))
+}
+
+// virtualKeyToken extracts a goxy-issued key from an Authorization header
+func virtualKeyToken(auth string) (string, bool) {
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || !strings.HasPrefix(token, pricing.VirtualKeyPrefix) {
+		return "", false
+	}
+	return token, true
+}
+
+// authorizeVirtualKey checks a virtual key against the request. The upstream provider key is
+// swapped in once the upstream is picked. On failure it returns the HTTP status and message to
+// reply with. The images and audio form fields must already be attached, for the model of
+// multipart uploads.
+func authorizeVirtualKey(mgr pricing.PersistentLimitManager, r *http.Request, token string) (pricing.VirtualKey, int, string) {
+	vk, ok := mgr.LookupVirtualKey(token)
+	if !ok {
+		return vk, http.StatusUnauthorized, "invalid virtual key"
+	}
+	if !vk.Active(time.Now()) {
+		if vk.RevokedAt != nil {
+			return vk, http.StatusUnauthorized, "virtual key revoked"
+		}
+		return vk, http.StatusUnauthorized, "virtual key expired"
+	}
+
+	// Keys limited to some models can only make requests whose model is known
+	if len(vk.AllowedModels) > 0 {
+		model := requestModel(r)
+		if model == "" {
+			return vk, http.StatusForbidden, "this key is limited to allowed models and the request has no model"
+		}
+		if !vk.AllowsModel(model) {
+			return vk, http.StatusForbidden, "model " + model + " is not allowed for this key"
+		}
+	}
+
+	return vk, 0, ""
+}
+
+// injectUpstreamKey sends the OpenAI key of --upstream-api-key upstream in place of a virtual key.
+// It returns false when no key is configured.
+func injectUpstreamKey(r *http.Request) bool {
+	key := config.Cfg.UpstreamAPIKey
+	if key == "" {
+		return false
+	}
+	r.Header.Set("Authorization", "Bearer "+key)
+	return true
+}
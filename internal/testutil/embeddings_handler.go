@@ -0,0 +1,114 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EmbeddingRequest represents the incoming request for the embeddings API.
+// Input is a string or an array of strings.
+type EmbeddingRequest struct {
+	Model      string          `json:"model"`
+	Input      json.RawMessage `json:"input"`
+	Dimensions int             `json:"dimensions"`
+}
+
+// Embedding is a single vector of the embeddings response
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// EmbeddingsResponse represents the OpenAI embeddings API response
+type EmbeddingsResponse struct {
+	Object string      `json:"object"`
+	Data   []Embedding `json:"data"`
+	Model  string      `json:"model"`
+	Usage  struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// HandleEmbeddings handles the embeddings endpoint
+func HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Openai-Organization", "fake-org")
+	w.Header().Set("Openai-Processing-Ms", "50")
+	w.Header().Set("Openai-Version", "2020-10-01")
+	w.Header().Set("X-Request-Id", fmt.Sprintf("req_fake%d", time.Now().Unix()))
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	var inputs []string
+	var single string
+	if err := json.Unmarshal(req.Input, &single); err == nil {
+		inputs = []string{single}
+	} else if err := json.Unmarshal(req.Input, &inputs); err != nil || len(inputs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "input must be a string or an array of strings"})
+		return
+	}
+
+	dimensions := req.Dimensions
+	if dimensions <= 0 {
+		dimensions = 1536
+		if strings.HasSuffix(req.Model, "-large") {
+			dimensions = 3072
+		}
+	}
+
+	response := EmbeddingsResponse{Object: "list", Model: req.Model}
+	promptTokens := 0
+	for i, input := range inputs {
+		response.Data = append(response.Data, Embedding{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: fakeVector(input, dimensions),
+		})
+		promptTokens += estimateTokens(input)
+	}
+	response.Usage.PromptTokens = promptTokens
+	response.Usage.TotalTokens = promptTokens
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+
+	log.Printf("Served fake embeddings for model=%s, inputs=%d, prompt_tokens=%d",
+		req.Model, len(inputs), promptTokens)
+}
+
+// fakeVector returns a deterministic unit vector derived from the input text
+func fakeVector(text string, dimensions int) []float64 {
+	seed := 1.0
+	for _, c := range text {
+		seed += float64(c)
+	}
+	vector := make([]float64, dimensions)
+	var norm float64
+	for i := range vector {
+		vector[i] = math.Sin(seed * float64(i+1))
+		norm += vector[i] * vector[i]
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
@@ -0,0 +1,52 @@
+// Package testutil is the fake OpenAI server: the handlers served by fake-openai and used by the
+// proxy's tests.
+package testutil
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// FailFirst makes the first n requests of a handler fail with status, to exercise retries and
+// failover in front of the fake server. The counter is shared by the handlers it wraps.
+type FailFirst struct {
+	N      int64
+	Status int
+	served atomic.Int64
+}
+
+// FailFirstFromEnv configures failures from the environment: FAIL_TIMES=N answers the first N
+// requests with FAIL_STATUS (default 503)
+func FailFirstFromEnv() *FailFirst {
+	f := &FailFirst{Status: http.StatusServiceUnavailable}
+	if n, err := strconv.ParseInt(os.Getenv("FAIL_TIMES"), 10, 64); err == nil {
+		f.N = n
+	}
+	if status, err := strconv.Atoi(os.Getenv("FAIL_STATUS")); err == nil {
+		f.Status = status
+	}
+	return f
+}
+
+// Wrap returns next, failing while the first N requests haven't been answered
+func (f *FailFirst) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if n := f.served.Add(1); n <= f.N {
+			log.Printf("Failing request %d of %d with status %d", n, f.N, f.Status)
+			w.Header().Set("Content-Type", "application/json")
+			if f.Status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			w.WriteHeader(f.Status)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{"message": "fake failure", "type": "server_error"},
+			})
+			return
+		}
+		next(w, r)
+	}
+}
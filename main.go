@@ -13,6 +13,8 @@ import (
 	"github.com/goverture/goxy/config"
 	"github.com/goverture/goxy/handlers"
 	"github.com/goverture/goxy/persistence"
+	"github.com/goverture/goxy/pricing"
+	"github.com/goverture/goxy/tokenizer"
 )
 
 var (
@@ -32,9 +34,39 @@ func main() {
 	// Print the config
 	log.Printf("Config: %+v", config.Cfg)
 
+	// Load pricing (embedded defaults, optionally combined with --pricing-file)
+	if err := pricing.InitConfig(config.Cfg.PricingFile, config.Cfg.PricingMerge); err != nil {
+		log.Fatalf("Failed to load pricing configuration: %v", err)
+	}
+
+	// Load tokenizer vocabularies for pre-flight cost estimates: the bundled ones, replaced by
+	// those of --tokenizer-dir
+	loaded, err := tokenizer.LoadEmbedded()
+	if err != nil {
+		log.Fatalf("Failed to load bundled tokenizer: %v", err)
+	}
+	if config.Cfg.TokenizerDir != "" {
+		fromDir, err := tokenizer.LoadDir(config.Cfg.TokenizerDir)
+		if err != nil {
+			log.Fatalf("Failed to load tokenizer: %v", err)
+		}
+		log.Printf("Loaded tokenizer encodings %v from %s", fromDir, config.Cfg.TokenizerDir)
+		loaded = append(loaded, fromDir...)
+	}
+	if len(loaded) == 0 {
+		log.Printf("No tokenizer rank files bundled or in --tokenizer-dir: prompt tokens are estimated heuristically")
+	} else if !tokenizer.Get(tokenizer.O200kBase).Exact() || !tokenizer.Get(tokenizer.Cl100kBase).Exact() {
+		log.Printf("Some tokenizer encodings are missing: their prompt tokens are estimated heuristically")
+	}
+
 	// Create persistent limit manager with SQLite database
 	dbPath := "goxy_usage.db" // Store in current directory
-	limitMgr, err := persistence.NewPersistentLimitManager(config.Cfg.SpendLimitPerHour, dbPath)
+	budgets, budgetLoc, err := config.Cfg.Budgets()
+	if err != nil {
+		log.Fatalf("Invalid budget configuration: %v", err)
+	}
+	limitMgr, err := persistence.NewPersistentLimitManagerWithOptions(config.Cfg.SpendLimitPerHour, dbPath,
+		persistence.WithBudgets(budgets, budgetLoc))
 	if err != nil {
 		log.Fatalf("Failed to create persistent limit manager: %v", err)
 	}
@@ -45,7 +77,14 @@ func main() {
 	h := cors(proxyHandler)
 
 	// Create admin handler
-	adminHandler := handlers.NewAdminHandler(limitMgr)
+	adminCreds, err := config.Cfg.AdminCredentials()
+	if err != nil {
+		log.Fatalf("Invalid admin credentials: %v", err)
+	}
+	if len(adminCreds) == 0 {
+		log.Printf("Warning: admin API has no authentication; set --admin-token to protect it")
+	}
+	adminHandler := handlers.NewAdminHandlerWithAuth(limitMgr, adminCreds)
 
 	// Setup proxy server
 	addr := ":" + itoa(config.Cfg.Port)
@@ -68,12 +107,36 @@ func main() {
 	}
 
 	log.Printf("Proxying to %s on %s", config.Cfg.OpenAIBaseURL, srv.Addr)
+	for _, rt := range config.Cfg.Routes {
+		log.Printf("Route %s (path prefix %q, models %v) -> %s", rt.Name, rt.PathPrefix, rt.Models, rt.BaseURL)
+	}
+	for _, fb := range config.Cfg.Fallbacks {
+		log.Printf("Fallback of %s: route %s", config.Cfg.OpenAIBaseURL, fb.Route)
+	}
 	log.Printf("Admin API listening on %s", adminSrv.Addr)
 
 	// Set up graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	// Reload pricing on SIGHUP and whenever the pricing file changes
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go pricing.WatchConfigFile(config.Cfg.PricingWatch, stopWatch)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			info, err := pricing.ReloadConfig()
+			if err != nil {
+				log.Printf("Warning: pricing reload on SIGHUP failed, keeping current table: %v", err)
+				continue
+			}
+			log.Printf("Pricing reloaded on SIGHUP (version %d, hash %.12s)", info.Version, info.Hash)
+		}
+	}()
+
 	// Start admin server in background
 	go func() {
 		if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
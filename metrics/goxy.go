@@ -0,0 +1,29 @@
+package metrics
+
+// Default is the registry served on the admin /metrics endpoint
+var Default = NewRegistry()
+
+// Metrics recorded by the proxy. The key label holds the masked key (as shown by /usage),
+// never the raw Authorization header.
+var (
+	Requests = Default.NewCounterVec("goxy_requests_total",
+		"Proxied requests by endpoint, model, upstream status and key.",
+		"endpoint", "model", "status", "key")
+
+	Tokens = Default.NewCounterVec("goxy_tokens_total",
+		"Billed tokens by model, key and type (prompt, cached_prompt, completion, reasoning, audio_prompt, ...).",
+		"model", "key", "type")
+
+	SpendUSD = Default.NewCounterVec("goxy_spend_usd_total",
+		"Priced spend in USD by model and key.",
+		"model", "key")
+
+	Rejections = Default.NewCounterVec("goxy_limit_rejections_total",
+		"Requests rejected with 429 by key and the budget that tripped.",
+		"key", "budget")
+
+	UpstreamLatency = Default.NewHistogramVec("goxy_upstream_latency_seconds",
+		"Time from forwarding a request until upstream response headers arrive.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		"endpoint")
+)
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests by path.", "path", "status")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, 0.1}, "path")
+
+	requests.Inc("/a", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc("/b", "500")
+	requests.Add(-5, "/b", "500") // ignored, counters only go up
+	requests.Inc(`say "hi"`+"\n", "200")
+
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	want := `# HELP test_requests_total Requests by path.
+# TYPE test_requests_total counter
+test_requests_total{path="/a",status="200"} 3
+test_requests_total{path="/b",status="500"} 1
+test_requests_total{path="say \"hi\"\n",status="200"} 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{path="/a",le="0.1"} 1
+test_latency_seconds_bucket{path="/a",le="1"} 2
+test_latency_seconds_bucket{path="/a",le="+Inf"} 3
+test_latency_seconds_sum{path="/a"} 3.55
+test_latency_seconds_count{path="/a"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+
+	if v := requests.Value("/a", "200"); v != 3 {
+		t.Errorf("expected 3, got %v", v)
+	}
+	if v := requests.Value("/missing", "200"); v != 0 {
+		t.Errorf("expected 0 for unknown series, got %v", v)
+	}
+	if c := latency.Count("/a"); c != 3 {
+		t.Errorf("expected 3 observations, got %d", c)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test.").Inc()
+
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if !strings.Contains(rr.Body.String(), "test_total 1\n") {
+		t.Errorf("unexpected body: %s", rr.Body.String())
+	}
+}
+
+func TestCounterVec_WrongLabelCountPanics(t *testing.T) {
+	c := NewRegistry().NewCounterVec("test_total", "Test.", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for wrong number of label values")
+		}
+	}()
+	c.Inc("only-one")
+}
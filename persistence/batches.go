@@ -0,0 +1,205 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/goverture/goxy/pricing"
+)
+
+// loadBatches loads every tracked batch into memory so output downloads don't hit the database
+func (p *PersistentLimitManager) loadBatches() error {
+	rows, err := p.db.Query(`
+	SELECT id, key, masked_key, endpoint, input_file_id, output_file_id, status, requests,
+		estimated_cost, charged_cost, charged_at, created_at
+	FROM batches
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batches := make(map[string]*pricing.Batch)
+	for rows.Next() {
+		var b pricing.Batch
+		var estimated, charged, createdAt int64
+		var chargedAt sql.NullInt64
+
+		err := rows.Scan(&b.ID, &b.Key, &b.MaskedKey, &b.Endpoint, &b.InputFileID, &b.OutputFileID, &b.Status,
+			&b.Requests, &estimated, &charged, &chargedAt, &createdAt)
+		if err != nil {
+			log.Printf("Warning: failed to scan batch: %v", err)
+			continue
+		}
+		b.EstimatedCost, b.ChargedCost = pricing.Money(estimated), pricing.Money(charged)
+		b.ChargedAt = unixPtr(chargedAt)
+		b.CreatedAt = time.Unix(createdAt, 0)
+		batches[b.ID] = &b
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	p.batchMu.Lock()
+	p.batches = batches
+	p.batchMu.Unlock()
+
+	log.Printf("Loaded %d batches from database", len(batches))
+	return nil
+}
+
+// RecordBatchFile stores the estimate of a batch input file until a batch is created from it
+func (p *PersistentLimitManager) RecordBatchFile(file pricing.BatchFile) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.db.Exec(`
+		INSERT OR REPLACE INTO batch_files (id, requests, estimated_cost, created_at)
+		VALUES (?, ?, ?, ?)
+	`, file.ID, file.Requests, int64(file.EstimatedCost), file.CreatedAt.Unix())
+	return err
+}
+
+// RecordBatch tracks a new batch. The estimate comes from its input file, when that was uploaded
+// through the proxy. A batch that is already tracked keeps its creator; only its status and output
+// file are updated.
+func (p *PersistentLimitManager) RecordBatch(batch pricing.Batch) (pricing.Batch, error) {
+	p.batchMu.Lock()
+	defer p.batchMu.Unlock()
+
+	if existing, ok := p.batches[batch.ID]; ok {
+		if err := p.updateBatchLocked(existing, batch.Status, batch.OutputFileID); err != nil {
+			return pricing.Batch{}, err
+		}
+		return *existing, nil
+	}
+
+	batch.CreatedAt = time.Unix(time.Now().Unix(), 0) // stored with second precision
+	batch.ChargedCost, batch.ChargedAt = 0, nil
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var estimated int64
+	err := p.db.QueryRow(`SELECT requests, estimated_cost FROM batch_files WHERE id = ?`, batch.InputFileID).
+		Scan(&batch.Requests, &estimated)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return pricing.Batch{}, err
+	}
+	batch.EstimatedCost = pricing.Money(estimated)
+
+	_, err = p.db.Exec(`
+		INSERT INTO batches (id, key, masked_key, endpoint, input_file_id, output_file_id, status, requests,
+			estimated_cost, charged_cost, charged_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, NULL, ?)
+	`, batch.ID, batch.Key, batch.MaskedKey, batch.Endpoint, batch.InputFileID, batch.OutputFileID, batch.Status,
+		batch.Requests, estimated, batch.CreatedAt.Unix())
+	if err != nil {
+		return pricing.Batch{}, err
+	}
+
+	p.batches[batch.ID] = &batch
+	return batch, nil
+}
+
+// UpdateBatch records the status and output file reported for a tracked batch
+func (p *PersistentLimitManager) UpdateBatch(id, status, outputFileID string) error {
+	p.batchMu.Lock()
+	defer p.batchMu.Unlock()
+
+	b, ok := p.batches[id]
+	if !ok {
+		return nil
+	}
+	return p.updateBatchLocked(b, status, outputFileID)
+}
+
+// updateBatchLocked saves a changed status or output file; an empty output file keeps the known one
+func (p *PersistentLimitManager) updateBatchLocked(b *pricing.Batch, status, outputFileID string) error {
+	if outputFileID == "" {
+		outputFileID = b.OutputFileID
+	}
+	if status == "" {
+		status = b.Status
+	}
+	if status == b.Status && outputFileID == b.OutputFileID {
+		return nil
+	}
+
+	p.mu.Lock()
+	_, err := p.db.Exec(`UPDATE batches SET status = ?, output_file_id = ? WHERE id = ?`, status, outputFileID, b.ID)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	b.Status, b.OutputFileID = status, outputFileID
+	return nil
+}
+
+// ListBatches returns tracked batches, newest first
+func (p *PersistentLimitManager) ListBatches(pendingOnly bool) []pricing.Batch {
+	p.batchMu.RLock()
+	defer p.batchMu.RUnlock()
+
+	batches := make([]pricing.Batch, 0, len(p.batches))
+	for _, b := range p.batches {
+		if pendingOnly && !b.Pending() {
+			continue
+		}
+		batches = append(batches, *b)
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if !batches[i].CreatedAt.Equal(batches[j].CreatedAt) {
+			return batches[i].CreatedAt.After(batches[j].CreatedAt)
+		}
+		return batches[i].ID > batches[j].ID
+	})
+	return batches
+}
+
+// BatchForOutputFile finds the tracked batch whose output is the given file
+func (p *PersistentLimitManager) BatchForOutputFile(fileID string) (pricing.Batch, bool) {
+	if fileID == "" {
+		return pricing.Batch{}, false
+	}
+
+	p.batchMu.RLock()
+	defer p.batchMu.RUnlock()
+
+	for _, b := range p.batches {
+		if b.OutputFileID == fileID {
+			return *b, true
+		}
+	}
+	return pricing.Batch{}, false
+}
+
+// MarkBatchCharged records the cost of a batch's output. It returns false when the batch was
+// already charged, so downloading the output again doesn't charge it twice.
+func (p *PersistentLimitManager) MarkBatchCharged(id string, cost pricing.Money) (bool, error) {
+	p.batchMu.Lock()
+	defer p.batchMu.Unlock()
+
+	b, ok := p.batches[id]
+	if !ok {
+		return false, fmt.Errorf("unknown batch %q", id)
+	}
+	if !b.Pending() {
+		return false, nil
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	p.mu.Lock()
+	_, err := p.db.Exec(`UPDATE batches SET charged_cost = ?, charged_at = ? WHERE id = ?`, int64(cost), now.Unix(), id)
+	p.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	b.ChargedCost, b.ChargedAt = cost, &now
+	return true, nil
+}
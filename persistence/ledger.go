@@ -0,0 +1,103 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goverture/goxy/pricing"
+)
+
+// RecordSpend appends a priced request to the spend ledger. Unlike usage_tracking,
+// ledger rows are never cleaned up.
+func (p *PersistentLimitManager) RecordSpend(entry pricing.LedgerEntry) error {
+	// Check if manager is still open
+	select {
+	case <-p.stopChan:
+		return nil // Manager is closing/closed
+	default:
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.db.Exec(`
+		INSERT INTO spend_ledger (timestamp, key, model, service_tier, prompt_tokens, cached_prompt_tokens, completion_tokens, cost)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Timestamp.Unix(), entry.Key, entry.Model, entry.ServiceTier,
+		entry.PromptTokens, entry.CachedPromptTokens, entry.CompletionTokens, int64(entry.Cost))
+	return err
+}
+
+// UsageHistory aggregates ledger entries matching the query by hour, day (both UTC) or model
+func (p *PersistentLimitManager) UsageHistory(q pricing.HistoryQuery) ([]pricing.HistoryBucket, error) {
+	var bucketExpr, orderBy string
+	switch q.GroupBy {
+	case pricing.GroupByHour:
+		bucketExpr, orderBy = "timestamp - (timestamp % 3600)", "bucket"
+	case pricing.GroupByDay, "":
+		bucketExpr, orderBy = "timestamp - (timestamp % 86400)", "bucket"
+	case pricing.GroupByModel:
+		bucketExpr, orderBy = "model", "cost DESC, bucket"
+	default:
+		return nil, fmt.Errorf("invalid group_by %q", q.GroupBy)
+	}
+
+	var where []string
+	var args []interface{}
+	if q.Key != "" {
+		where = append(where, "key = ?")
+		args = append(args, q.Key)
+	}
+	if q.Model != "" {
+		where = append(where, "model = ?")
+		args = append(args, q.Model)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, q.From.Unix())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, q.To.Unix())
+	}
+
+	query := `SELECT ` + bucketExpr + ` AS bucket, COUNT(*), SUM(prompt_tokens), SUM(cached_prompt_tokens),
+		SUM(completion_tokens), SUM(cost) AS cost
+	FROM spend_ledger`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " GROUP BY bucket ORDER BY " + orderBy
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []pricing.HistoryBucket{}
+	for rows.Next() {
+		var bucket interface{}
+		var b pricing.HistoryBucket
+		var cost int64
+		if err := rows.Scan(&bucket, &b.Requests, &b.PromptTokens, &b.CachedPromptTokens, &b.CompletionTokens, &cost); err != nil {
+			return nil, err
+		}
+		switch v := bucket.(type) {
+		case int64:
+			b.Bucket = time.Unix(v, 0).UTC().Format(time.RFC3339)
+		case string:
+			b.Bucket = v
+		default:
+			b.Bucket = fmt.Sprint(v)
+		}
+		b.Cost = pricing.Money(cost)
+		b.CostUSD = b.Cost.ToUSD()
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
@@ -2,7 +2,10 @@ package persistence
 
 import (
 	"database/sql"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,6 +19,12 @@ type PersistentLimitManager struct {
 	db       *sql.DB
 	mu       sync.RWMutex
 	stopChan chan struct{}
+
+	vkMu        sync.RWMutex
+	virtualKeys map[string]*pricing.VirtualKey // by key hash
+
+	batchMu sync.RWMutex
+	batches map[string]*pricing.Batch // by batch ID
 }
 
 // UsageRecord represents a usage record in the database
@@ -27,13 +36,23 @@ type UsageRecord struct {
 	LastUpdated time.Time
 }
 
+// Option configures a PersistentLimitManager
+type Option func(*PersistentLimitManager)
+
+// WithBudgets enables calendar budgets (day/week/month) aligned in loc, checked together with the hourly limit
+func WithBudgets(budgets []pricing.Budget, loc *time.Location) Option {
+	return func(p *PersistentLimitManager) {
+		p.ManagerMoney.SetBudgets(budgets, loc)
+	}
+}
+
 // NewPersistentLimitManager creates a new persistent limit manager
 func NewPersistentLimitManager(limitUSD float64, dbPath string) (*PersistentLimitManager, error) {
 	return NewPersistentLimitManagerWithOptions(limitUSD, dbPath)
 }
 
 // NewPersistentLimitManagerWithOptions creates a new persistent limit manager with configuration options
-func NewPersistentLimitManagerWithOptions(limitUSD float64, dbPath string) (*PersistentLimitManager, error) {
+func NewPersistentLimitManagerWithOptions(limitUSD float64, dbPath string, opts ...Option) (*PersistentLimitManager, error) {
 	// Create the underlying manager
 	mgr := pricing.NewLimitManager(limitUSD)
 
@@ -52,6 +71,11 @@ func NewPersistentLimitManagerWithOptions(limitUSD float64, dbPath string) (*Per
 		ManagerMoney: mgr,
 		db:           db,
 		stopChan:     make(chan struct{}),
+		virtualKeys:  make(map[string]*pricing.VirtualKey),
+		batches:      make(map[string]*pricing.Batch),
+	}
+	for _, opt := range opts {
+		opt(plm)
 	}
 
 	// Initialize database schema
@@ -64,6 +88,31 @@ func NewPersistentLimitManagerWithOptions(limitUSD float64, dbPath string) (*Per
 		log.Printf("Warning: failed to load usage data: %v", err)
 	}
 
+	// Restore calendar budget windows
+	if err := plm.loadBudgetData(); err != nil {
+		log.Printf("Warning: failed to load budget data: %v", err)
+	}
+
+	// Restore the global limit if it was changed at runtime (the constructor value is only the initial default)
+	if err := plm.loadLimitSetting(); err != nil {
+		log.Printf("Warning: failed to load spend limit setting: %v", err)
+	}
+
+	// Restore per-key limit overrides
+	if err := plm.loadKeyLimits(); err != nil {
+		log.Printf("Warning: failed to load key limits: %v", err)
+	}
+
+	// Load issued virtual keys
+	if err := plm.loadVirtualKeys(); err != nil {
+		log.Printf("Warning: failed to load virtual keys: %v", err)
+	}
+
+	// Load tracked batch jobs
+	if err := plm.loadBatches(); err != nil {
+		log.Printf("Warning: failed to load batches: %v", err)
+	}
+
 	return plm, nil
 }
 
@@ -80,6 +129,76 @@ func (p *PersistentLimitManager) initSchema() error {
 	
 	CREATE INDEX IF NOT EXISTS idx_window_start ON usage_tracking(window_start);
 	CREATE INDEX IF NOT EXISTS idx_last_updated ON usage_tracking(last_updated);
+
+	CREATE TABLE IF NOT EXISTS budget_tracking (
+		key TEXT NOT NULL,
+		period TEXT NOT NULL,
+		window_start INTEGER NOT NULL,
+		spent INTEGER NOT NULL,
+		last_updated INTEGER NOT NULL,
+		PRIMARY KEY (key, period)
+	);
+
+	CREATE TABLE IF NOT EXISTS key_limits (
+		key TEXT PRIMARY KEY,
+		limit_amount INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS settings (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_by TEXT NOT NULL DEFAULT '',
+		updated_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS spend_ledger (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		model TEXT NOT NULL,
+		service_tier TEXT NOT NULL,
+		prompt_tokens INTEGER NOT NULL,
+		cached_prompt_tokens INTEGER NOT NULL,
+		completion_tokens INTEGER NOT NULL,
+		cost INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_ledger_timestamp ON spend_ledger(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_ledger_key ON spend_ledger(key, timestamp);
+
+	CREATE TABLE IF NOT EXISTS virtual_keys (
+		id TEXT PRIMARY KEY,
+		key_hash TEXT NOT NULL UNIQUE,
+		masked_key TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		allowed_models TEXT NOT NULL DEFAULT '',
+		expires_at INTEGER,
+		revoked_at INTEGER,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS batch_files (
+		id TEXT PRIMARY KEY,
+		requests INTEGER NOT NULL,
+		estimated_cost INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS batches (
+		id TEXT PRIMARY KEY,
+		key TEXT NOT NULL,
+		masked_key TEXT NOT NULL,
+		endpoint TEXT NOT NULL DEFAULT '',
+		input_file_id TEXT NOT NULL DEFAULT '',
+		output_file_id TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		requests INTEGER NOT NULL,
+		estimated_cost INTEGER NOT NULL,
+		charged_cost INTEGER NOT NULL DEFAULT 0,
+		charged_at INTEGER,
+		created_at INTEGER NOT NULL
+	);
 	`
 
 	_, err := p.db.Exec(query)
@@ -122,8 +241,8 @@ func (p *PersistentLimitManager) loadUsageData() error {
 
 		// Check if window is still active (within the last hour)
 		if now.Sub(record.WindowStart) < time.Hour {
-			// Restore this usage data by adding the cost
-			p.ManagerMoney.AddCost(record.Key, record.Spent)
+			// Restore this usage data (calendar budgets are restored separately)
+			p.ManagerMoney.RestoreSpend(record.Key, pricing.PeriodHour, record.WindowStart, record.Spent)
 			loadedCount++
 		}
 	}
@@ -137,6 +256,79 @@ func (p *PersistentLimitManager) loadUsageData() error {
 	return nil
 }
 
+// loadBudgetData restores the calendar budget windows that are still current
+func (p *PersistentLimitManager) loadBudgetData() error {
+	budgets, loc := p.ManagerMoney.Budgets()
+	if len(budgets) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rows, err := p.db.Query(`SELECT key, period, window_start, spent FROM budget_tracking`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	loadedCount := 0
+	for rows.Next() {
+		var key, period string
+		var windowStartUnix int64
+		var spent pricing.Money
+		if err := rows.Scan(&key, &period, &windowStartUnix, &spent); err != nil {
+			log.Printf("Warning: failed to scan budget record: %v", err)
+			continue
+		}
+
+		bp := pricing.BudgetPeriod(period)
+		windowStart := time.Unix(windowStartUnix, 0)
+		// Only restore windows that are still the current calendar window
+		if !windowStart.Equal(bp.Start(now, loc)) {
+			continue
+		}
+		p.ManagerMoney.RestoreSpend(key, bp, windowStart, spent)
+		loadedCount++
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d active budget records from database", loadedCount)
+	return nil
+}
+
+// loadKeyLimits restores per-key limit overrides from the database
+func (p *PersistentLimitManager) loadKeyLimits() error {
+	rows, err := p.db.Query(`SELECT key, limit_amount FROM key_limits`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	loadedCount := 0
+	for rows.Next() {
+		var key string
+		var limit pricing.Money
+		if err := rows.Scan(&key, &limit); err != nil {
+			log.Printf("Warning: failed to scan key limit: %v", err)
+			continue
+		}
+		p.ManagerMoney.SetKeyLimit(key, limit)
+		loadedCount++
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d key limit overrides from database", loadedCount)
+	return nil
+}
+
 // cleanupOldRecords removes old usage records from the database
 func (p *PersistentLimitManager) cleanupOldRecords() error {
 	p.mu.Lock()
@@ -155,6 +347,12 @@ func (p *PersistentLimitManager) cleanupOldRecords() error {
 		log.Printf("Cleaned up %d old usage records", affected)
 	}
 
+	// Budget windows last up to a month
+	budgetCutoff := time.Now().AddDate(0, -1, -1)
+	if _, err := p.db.Exec("DELETE FROM budget_tracking WHERE window_start < ?", budgetCutoff.Unix()); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -216,7 +414,7 @@ func (p *PersistentLimitManager) saveKeyUsageWithMasked(key string, maskedKey st
 	usage := p.ManagerMoney.GetUsage(key)
 
 	// Only save if there's actual spending
-	if usage.Spent.IsZero() {
+	if usage.Spent.IsZero() && len(usage.Budgets) == 0 {
 		return nil
 	}
 
@@ -237,6 +435,17 @@ func (p *PersistentLimitManager) saveKeyUsageWithMasked(key string, maskedKey st
 		return err
 	}
 
+	// Calendar budget windows
+	for _, budget := range usage.Budgets {
+		_, err = tx.Exec(`
+			INSERT OR REPLACE INTO budget_tracking (key, period, window_start, spent, last_updated)
+			VALUES (?, ?, ?, ?, ?)
+		`, key, string(budget.Period), budget.WindowStart.Unix(), int64(budget.Spent), time.Now().Unix())
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -290,3 +499,87 @@ func (p *PersistentLimitManager) GetAllUsageWithMaskedKeys() []pricing.UsageInfo
 
 	return result
 }
+
+// SetKeyLimit overrides the spending limit for a single key and saves it to the database
+func (p *PersistentLimitManager) SetKeyLimit(key string, limit pricing.Money) {
+	p.ManagerMoney.SetKeyLimit(key, limit)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.db.Exec(`
+		INSERT OR REPLACE INTO key_limits (key, limit_amount, updated_at)
+		VALUES (?, ?, ?)
+	`, key, int64(limit), time.Now().Unix())
+	if err != nil {
+		log.Printf("Warning: failed to save limit for key %s: %v", key, err)
+	}
+}
+
+// ClearKeyLimit removes a key's override from memory and the database
+func (p *PersistentLimitManager) ClearKeyLimit(key string) {
+	p.ManagerMoney.ClearKeyLimit(key)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.db.Exec(`DELETE FROM key_limits WHERE key = ?`, key); err != nil {
+		log.Printf("Warning: failed to delete limit for key %s: %v", key, err)
+	}
+}
+
+// ResolveKey maps a masked key or a key hash to the hashed key used for tracking.
+// Hashes are accepted even for keys that have not been seen yet, so limits can be set ahead of time.
+// Masked keys are matched with or without their "Bearer " prefix and must be unambiguous.
+func (p *PersistentLimitManager) ResolveKey(ident string) (string, string, error) {
+	if ident == "" {
+		return "", "", fmt.Errorf("empty key")
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if isKeyHash(ident) {
+		var maskedKey string
+		err := p.db.QueryRow(`SELECT masked_key FROM usage_tracking WHERE key = ?`, ident).Scan(&maskedKey)
+		if err != nil && err != sql.ErrNoRows {
+			return "", "", err
+		}
+		return ident, maskedKey, nil
+	}
+
+	rows, err := p.db.Query(`SELECT key, masked_key FROM usage_tracking WHERE masked_key = ? OR masked_key = ?`,
+		ident, "Bearer "+strings.TrimPrefix(ident, "Bearer "))
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+
+	var key, maskedKey string
+	matches := 0
+	for rows.Next() {
+		if err := rows.Scan(&key, &maskedKey); err != nil {
+			return "", "", err
+		}
+		matches++
+	}
+	if err := rows.Err(); err != nil {
+		return "", "", err
+	}
+
+	switch matches {
+	case 0:
+		return "", "", fmt.Errorf("unknown key %q", ident)
+	case 1:
+		return key, maskedKey, nil
+	default:
+		return "", "", fmt.Errorf("masked key %q is ambiguous (%d matches); use the key hash instead", ident, matches)
+	}
+}
+
+// isKeyHash reports whether s looks like a hashed key (hex-encoded SHA-256)
+func isKeyHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -464,3 +465,365 @@ func BenchmarkPersistentLimitManager_MultipleKeys(b *testing.B) {
 		}
 	})
 }
+
+func TestPersistentLimitManager_KeyLimitsPersist(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "key_limits_test.db")
+
+	keyHash := "5c0b1f2d1e2c3a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3"
+
+	mgr1, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	mgr1.SetKeyLimit(keyHash, pricing.NewMoneyFromUSD(50.00))
+	mgr1.SetKeyLimit("cleared-key", pricing.NewMoneyFromUSD(3.00))
+	mgr1.ClearKeyLimit("cleared-key")
+	mgr1.Close()
+
+	mgr2, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create second manager: %v", err)
+	}
+	defer mgr2.Close()
+
+	if limit, ok := mgr2.GetKeyLimit(keyHash); !ok || limit != pricing.NewMoneyFromUSD(50.00) {
+		t.Errorf("Expected restored $50 override, got %v (ok=%v)", limit, ok)
+	}
+	if _, ok := mgr2.GetKeyLimit("cleared-key"); ok {
+		t.Error("Cleared override should not be restored")
+	}
+	if usage := mgr2.GetUsage(keyHash); usage.Limit != pricing.NewMoneyFromUSD(50.00) {
+		t.Errorf("Expected effective limit $50, got %v", usage.Limit)
+	}
+}
+
+func TestPersistentLimitManager_ResolveKey(t *testing.T) {
+	mgr, err := NewPersistentLimitManager(1.00, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer mgr.Close()
+
+	hashA := "aaaa000000000000000000000000000000000000000000000000000000000000"
+	hashB := "bbbb000000000000000000000000000000000000000000000000000000000000"
+	hashC := "cccc000000000000000000000000000000000000000000000000000000000000"
+	mgr.AddCostWithMaskedKey(hashA, "Bearer sk-1...aaaa", pricing.NewMoneyFromUSD(0.1))
+	mgr.AddCostWithMaskedKey(hashB, "Bearer sk-2...dupe", pricing.NewMoneyFromUSD(0.1))
+	mgr.AddCostWithMaskedKey(hashC, "Bearer sk-2...dupe", pricing.NewMoneyFromUSD(0.1))
+
+	// Masked key, with or without the Bearer prefix
+	for _, ident := range []string{"Bearer sk-1...aaaa", "sk-1...aaaa"} {
+		key, masked, err := mgr.ResolveKey(ident)
+		if err != nil || key != hashA || masked != "Bearer sk-1...aaaa" {
+			t.Errorf("ResolveKey(%q) = %q, %q, %v", ident, key, masked, err)
+		}
+	}
+
+	// Hash, known or not
+	if key, masked, err := mgr.ResolveKey(hashA); err != nil || key != hashA || masked != "Bearer sk-1...aaaa" {
+		t.Errorf("ResolveKey(hash) = %q, %q, %v", key, masked, err)
+	}
+	unseen := "dddd000000000000000000000000000000000000000000000000000000000000"
+	if key, _, err := mgr.ResolveKey(unseen); err != nil || key != unseen {
+		t.Errorf("ResolveKey(unseen hash) = %q, %v", key, err)
+	}
+
+	// Unknown and ambiguous masked keys are rejected
+	if _, _, err := mgr.ResolveKey("sk-9...none"); err == nil {
+		t.Error("Expected error for unknown masked key")
+	}
+	if _, _, err := mgr.ResolveKey("sk-2...dupe"); err == nil {
+		t.Error("Expected error for ambiguous masked key")
+	}
+}
+
+func TestPersistentLimitManager_BudgetsPersist(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "budgets_test.db")
+	budgets := []pricing.Budget{
+		{Period: pricing.PeriodDay, Limit: pricing.NewMoneyFromUSD(30.00)},
+		{Period: pricing.PeriodMonth, Limit: pricing.NewMoneyFromUSD(500.00)},
+	}
+
+	testKey := "budget-key"
+	cost := pricing.NewMoneyFromUSD(0.40)
+
+	mgr1, err := NewPersistentLimitManagerWithOptions(1.00, dbPath, WithBudgets(budgets, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	mgr1.AddCost(testKey, cost)
+	mgr1.Close()
+
+	// Age the hourly window so only the calendar budgets can restore the spend
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := db.Exec("UPDATE usage_tracking SET window_start = ? WHERE key = ?",
+		time.Now().Add(-2*time.Hour).Unix(), testKey); err != nil {
+		db.Close()
+		t.Fatalf("Failed to update timestamp: %v", err)
+	}
+	db.Close()
+
+	mgr2, err := NewPersistentLimitManagerWithOptions(1.00, dbPath, WithBudgets(budgets, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create second manager: %v", err)
+	}
+	defer mgr2.Close()
+
+	usage := mgr2.GetUsage(testKey)
+	if len(usage.Budgets) != 2 {
+		t.Fatalf("Expected 2 budgets, got %d", len(usage.Budgets))
+	}
+	for _, budget := range usage.Budgets {
+		if budget.Spent != cost {
+			t.Errorf("Expected restored %s spend %v, got %v", budget.Period, cost, budget.Spent)
+		}
+	}
+}
+
+func TestPersistentLimitManager_VirtualKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "virtual_keys_test.db")
+
+	mgr1, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	expires := time.Now().Add(24 * time.Hour)
+	token, vk, err := mgr1.CreateVirtualKey("ci", []string{"gpt-4o-mini"}, &expires)
+	if err != nil {
+		t.Fatalf("Failed to create virtual key: %v", err)
+	}
+	if !strings.HasPrefix(token, pricing.VirtualKeyPrefix) {
+		t.Errorf("Expected token with prefix %q, got %q", pricing.VirtualKeyPrefix, token)
+	}
+	if vk.KeyHash == "" || strings.Contains(vk.MaskedKey, token) {
+		t.Errorf("Key must be stored hashed and masked, got %+v", vk)
+	}
+	revokeToken, revoked, err := mgr1.CreateVirtualKey("old", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create virtual key: %v", err)
+	}
+	if _, err := mgr1.RevokeVirtualKey(revoked.ID); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	if _, err := mgr1.RevokeVirtualKey("vk_unknown"); err == nil {
+		t.Error("Expected error revoking unknown key")
+	}
+	mgr1.Close()
+
+	// Keys survive a restart
+	mgr2, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create second manager: %v", err)
+	}
+	defer mgr2.Close()
+
+	if keys := mgr2.ListVirtualKeys(); len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(keys))
+	}
+	got, ok := mgr2.LookupVirtualKey(token)
+	if !ok || got.ID != vk.ID || got.Name != "ci" || !got.Active(time.Now()) {
+		t.Fatalf("Unexpected lookup result: %+v (ok=%v)", got, ok)
+	}
+	if !got.AllowsModel("gpt-4o-mini-2024-07-18") || got.AllowsModel("gpt-4o") {
+		t.Errorf("Allowed models not restored: %v", got.AllowedModels)
+	}
+	if got.ExpiresAt == nil || got.ExpiresAt.Unix() != expires.Unix() {
+		t.Errorf("Expiry not restored: %v", got.ExpiresAt)
+	}
+	if got, ok := mgr2.LookupVirtualKey(revokeToken); !ok || got.Active(time.Now()) {
+		t.Errorf("Expected revoked key to be inactive, got %+v", got)
+	}
+	if _, ok := mgr2.LookupVirtualKey(pricing.VirtualKeyPrefix + "unknown"); ok {
+		t.Error("Unknown token should not resolve")
+	}
+}
+
+func TestPersistentLimitManager_SpendLedger(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "ledger_test.db")
+
+	mgr1, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	base := time.Date(2025, 3, 10, 9, 15, 0, 0, time.UTC)
+	entries := []pricing.LedgerEntry{
+		{Timestamp: base, Key: "key-a", Model: "gpt-4o", ServiceTier: "standard", PromptTokens: 100, CompletionTokens: 10, Cost: pricing.NewMoneyFromUSD(0.01)},
+		{Timestamp: base.Add(10 * time.Minute), Key: "key-a", Model: "gpt-4o-mini", ServiceTier: "standard", PromptTokens: 200, CachedPromptTokens: 50, CompletionTokens: 20, Cost: pricing.NewMoneyFromUSD(0.002)},
+		{Timestamp: base.Add(2 * time.Hour), Key: "key-b", Model: "gpt-4o", ServiceTier: "flex", PromptTokens: 300, CompletionTokens: 30, Cost: pricing.NewMoneyFromUSD(0.03)},
+		{Timestamp: base.AddDate(0, 0, 1), Key: "key-a", Model: "gpt-4o", ServiceTier: "standard", PromptTokens: 400, CompletionTokens: 40, Cost: pricing.NewMoneyFromUSD(0.04)},
+	}
+	for _, e := range entries {
+		if err := mgr1.RecordSpend(e); err != nil {
+			t.Fatalf("Failed to record spend: %v", err)
+		}
+	}
+	// The ledger is not affected by cleanup of old usage windows
+	mgr1.Close()
+
+	mgr2, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create second manager: %v", err)
+	}
+	defer mgr2.Close()
+
+	byDay, err := mgr2.UsageHistory(pricing.HistoryQuery{GroupBy: pricing.GroupByDay})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	if len(byDay) != 2 || byDay[0].Bucket != "2025-03-10T00:00:00Z" || byDay[0].Requests != 3 || byDay[1].Requests != 1 {
+		t.Fatalf("Unexpected daily buckets: %+v", byDay)
+	}
+	if byDay[0].Cost != pricing.NewMoneyFromUSD(0.042) || byDay[0].CachedPromptTokens != 50 {
+		t.Errorf("Unexpected day totals: %+v", byDay[0])
+	}
+
+	byHour, err := mgr2.UsageHistory(pricing.HistoryQuery{Key: "key-a", To: base.AddDate(0, 0, 1), GroupBy: pricing.GroupByHour})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	if len(byHour) != 1 || byHour[0].Bucket != "2025-03-10T09:00:00Z" || byHour[0].Requests != 2 || byHour[0].PromptTokens != 300 {
+		t.Fatalf("Unexpected hourly buckets: %+v", byHour)
+	}
+
+	byModel, err := mgr2.UsageHistory(pricing.HistoryQuery{From: base, GroupBy: pricing.GroupByModel})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	if len(byModel) != 2 || byModel[0].Bucket != "gpt-4o" || byModel[0].Requests != 3 || byModel[1].Bucket != "gpt-4o-mini" {
+		t.Fatalf("Unexpected model buckets: %+v", byModel)
+	}
+
+	filtered, err := mgr2.UsageHistory(pricing.HistoryQuery{Model: "gpt-4o-mini"})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].Requests != 1 {
+		t.Fatalf("Unexpected filtered buckets: %+v", filtered)
+	}
+}
+
+func TestPersistentLimitManager_LimitPersists(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "limit_setting_test.db")
+
+	// The constructor limit applies until the limit is changed at runtime
+	mgr1, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	mgr1.Close()
+
+	mgr2, err := NewPersistentLimitManager(2.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if limit := mgr2.DefaultLimit(); limit != pricing.NewMoneyFromUSD(2.00) {
+		t.Fatalf("Expected the new default $2 before any change, got %v", limit)
+	}
+	if err := mgr2.UpdateLimitBy(pricing.NewMoneyFromUSD(7.50), "ops (127.0.0.1)"); err != nil {
+		t.Fatalf("Failed to update limit: %v", err)
+	}
+	mgr2.Close()
+
+	var updatedBy string
+	mgr3, err := NewPersistentLimitManager(2.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if limit := mgr3.DefaultLimit(); limit != pricing.NewMoneyFromUSD(7.50) {
+		t.Errorf("Expected restored $7.50 limit, got %v", limit)
+	}
+	if err := mgr3.db.QueryRow(`SELECT updated_by FROM settings WHERE name = ?`, settingDefaultLimit).Scan(&updatedBy); err != nil || updatedBy != "ops (127.0.0.1)" {
+		t.Errorf("Expected who metadata, got %q (err=%v)", updatedBy, err)
+	}
+
+	// Disabling the limit is persisted too
+	mgr3.UpdateLimitFromUSD(-1)
+	mgr3.Close()
+
+	mgr4, err := NewPersistentLimitManager(2.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer mgr4.Close()
+	if limit := mgr4.DefaultLimit(); !limit.IsNegative() {
+		t.Errorf("Expected disabled limit to be restored, got %v", limit)
+	}
+}
+
+func TestPersistentLimitManager_Batches(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "batches_test.db")
+
+	mgr1, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	err = mgr1.RecordBatchFile(pricing.BatchFile{ID: "file-in", Requests: 3, EstimatedCost: pricing.NewMoneyFromUSD(0.5), CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("RecordBatchFile failed: %v", err)
+	}
+
+	b, err := mgr1.RecordBatch(pricing.Batch{ID: "batch_1", Key: "creator", MaskedKey: "Bearer sk-1...aaaa", InputFileID: "file-in", Status: "validating"})
+	if err != nil || b.Requests != 3 || b.EstimatedCost != pricing.NewMoneyFromUSD(0.5) || !b.Pending() {
+		t.Fatalf("RecordBatch = %+v, %v", b, err)
+	}
+	// The input file of this one wasn't seen: no estimate
+	if b, err := mgr1.RecordBatch(pricing.Batch{ID: "batch_2", Key: "creator", InputFileID: "file-other"}); err != nil || b.Requests != 0 || !b.EstimatedCost.IsZero() {
+		t.Fatalf("RecordBatch = %+v, %v", b, err)
+	}
+	// Recording a known batch again doesn't change its creator
+	if b, err := mgr1.RecordBatch(pricing.Batch{ID: "batch_1", Key: "someone-else", Status: "in_progress"}); err != nil || b.Key != "creator" || b.Status != "in_progress" {
+		t.Fatalf("RecordBatch (known) = %+v, %v", b, err)
+	}
+
+	if err := mgr1.UpdateBatch("batch_1", "completed", "file-out"); err != nil {
+		t.Fatalf("UpdateBatch failed: %v", err)
+	}
+	if err := mgr1.UpdateBatch("batch_unknown", "completed", "file-x"); err != nil {
+		t.Fatalf("UpdateBatch should ignore unknown batches: %v", err)
+	}
+	if _, ok := mgr1.BatchForOutputFile("file-x"); ok {
+		t.Error("Unknown batches should not be tracked by updates")
+	}
+	if b, ok := mgr1.BatchForOutputFile("file-out"); !ok || b.ID != "batch_1" {
+		t.Fatalf("BatchForOutputFile = %+v, %v", b, ok)
+	}
+
+	if charged, err := mgr1.MarkBatchCharged("batch_1", pricing.NewMoneyFromUSD(0.2)); !charged || err != nil {
+		t.Fatalf("MarkBatchCharged = %v, %v", charged, err)
+	}
+	if charged, err := mgr1.MarkBatchCharged("batch_1", pricing.NewMoneyFromUSD(0.2)); charged || err != nil {
+		t.Errorf("Second MarkBatchCharged = %v, %v; want false", charged, err)
+	}
+	if _, err := mgr1.MarkBatchCharged("batch_unknown", 0); err == nil {
+		t.Error("Expected an error for an unknown batch")
+	}
+	mgr1.Close()
+
+	mgr2, err := NewPersistentLimitManager(1.00, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create second manager: %v", err)
+	}
+	defer mgr2.Close()
+
+	if all := mgr2.ListBatches(false); len(all) != 2 {
+		t.Fatalf("Expected 2 restored batches, got %+v", all)
+	}
+	pending := mgr2.ListBatches(true)
+	if len(pending) != 1 || pending[0].ID != "batch_2" {
+		t.Errorf("Expected only batch_2 to be pending, got %+v", pending)
+	}
+	b, ok := mgr2.BatchForOutputFile("file-out")
+	if !ok || b.Pending() || b.ChargedCost != pricing.NewMoneyFromUSD(0.2) || b.Status != "completed" || b.MaskedKey != "Bearer sk-1...aaaa" {
+		t.Errorf("Unexpected restored batch %+v", b)
+	}
+}
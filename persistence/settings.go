@@ -0,0 +1,77 @@
+package persistence
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/goverture/goxy/pricing"
+)
+
+// settingDefaultLimit stores the global hourly limit once it was changed at runtime
+const settingDefaultLimit = "default_limit"
+
+// loadLimitSetting restores a limit changed through the admin API. Once one is stored,
+// the limit passed to the constructor (the CLI flag) only applies to fresh databases.
+func (p *PersistentLimitManager) loadLimitSetting() error {
+	var value, updatedBy string
+	var updatedAt int64
+	err := p.db.QueryRow(`SELECT value, updated_by, updated_at FROM settings WHERE name = ?`, settingDefaultLimit).
+		Scan(&value, &updatedBy, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	p.ManagerMoney.UpdateLimit(pricing.Money(limit))
+	log.Printf("Restored spend limit %s (set by %s at %s)", limitString(pricing.Money(limit)),
+		updatedBy, time.Unix(updatedAt, 0).UTC().Format(time.RFC3339))
+	return nil
+}
+
+// UpdateLimit updates the global limit and persists it so it survives restarts
+func (p *PersistentLimitManager) UpdateLimit(newLimit pricing.Money) {
+	if err := p.UpdateLimitBy(newLimit, ""); err != nil {
+		log.Printf("Warning: failed to persist spend limit: %v", err)
+	}
+}
+
+// UpdateLimitFromUSD updates the global limit from USD (negative disables it) and persists it
+func (p *PersistentLimitManager) UpdateLimitFromUSD(newLimitUSD float64) {
+	limit := pricing.Money(-1) // disabled
+	if newLimitUSD >= 0 {
+		limit = pricing.NewMoneyFromUSD(newLimitUSD)
+	}
+	p.UpdateLimit(limit)
+}
+
+// UpdateLimitBy persists the global limit along with who changed it, then applies it.
+// If it cannot be stored the active limit is left unchanged.
+func (p *PersistentLimitManager) UpdateLimitBy(newLimit pricing.Money, updatedBy string) error {
+	p.mu.Lock()
+	_, err := p.db.Exec(`
+		INSERT OR REPLACE INTO settings (name, value, updated_by, updated_at)
+		VALUES (?, ?, ?, ?)
+	`, settingDefaultLimit, strconv.FormatInt(int64(newLimit), 10), updatedBy, time.Now().Unix())
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	p.ManagerMoney.UpdateLimit(newLimit)
+	return nil
+}
+
+func limitString(limit pricing.Money) string {
+	if limit.IsNegative() {
+		return "disabled"
+	}
+	return limit.String()
+}
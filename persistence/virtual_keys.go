@@ -0,0 +1,196 @@
+package persistence
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/goverture/goxy/pricing"
+	"github.com/goverture/goxy/utils"
+)
+
+// virtualKeyTokenBytes is the amount of randomness in an issued key
+const virtualKeyTokenBytes = 24
+
+// virtualKeyHash returns the tracking key for a virtual key token. It matches
+// utils.HashAuthKey of the Authorization header clients send ("Bearer <token>").
+func virtualKeyHash(token string) string {
+	return utils.HashAuthKey("Bearer " + token)
+}
+
+// loadVirtualKeys loads every issued key into memory so lookups don't hit the database
+func (p *PersistentLimitManager) loadVirtualKeys() error {
+	rows, err := p.db.Query(`
+	SELECT id, key_hash, masked_key, name, allowed_models, expires_at, revoked_at, created_at
+	FROM virtual_keys
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]*pricing.VirtualKey)
+	for rows.Next() {
+		var vk pricing.VirtualKey
+		var allowedModels string
+		var expiresAt, revokedAt sql.NullInt64
+		var createdAt int64
+
+		err := rows.Scan(&vk.ID, &vk.KeyHash, &vk.MaskedKey, &vk.Name, &allowedModels, &expiresAt, &revokedAt, &createdAt)
+		if err != nil {
+			log.Printf("Warning: failed to scan virtual key: %v", err)
+			continue
+		}
+		if allowedModels != "" {
+			if err := json.Unmarshal([]byte(allowedModels), &vk.AllowedModels); err != nil {
+				log.Printf("Warning: invalid allowed models for virtual key %s: %v", vk.ID, err)
+			}
+		}
+		vk.ExpiresAt = unixPtr(expiresAt)
+		vk.RevokedAt = unixPtr(revokedAt)
+		vk.CreatedAt = time.Unix(createdAt, 0)
+		keys[vk.KeyHash] = &vk
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	p.vkMu.Lock()
+	p.virtualKeys = keys
+	p.vkMu.Unlock()
+
+	log.Printf("Loaded %d virtual keys from database", len(keys))
+	return nil
+}
+
+// CreateVirtualKey issues a new key and stores its hash; the plain token is returned only here
+func (p *PersistentLimitManager) CreateVirtualKey(name string, allowedModels []string, expiresAt *time.Time) (string, pricing.VirtualKey, error) {
+	secret := make([]byte, virtualKeyTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", pricing.VirtualKey{}, err
+	}
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", pricing.VirtualKey{}, err
+	}
+
+	token := pricing.VirtualKeyPrefix + hex.EncodeToString(secret)
+	vk := pricing.VirtualKey{
+		ID:            "vk_" + hex.EncodeToString(idBytes),
+		Name:          name,
+		KeyHash:       virtualKeyHash(token),
+		MaskedKey:     utils.MaskAPIKeyForStorage("Bearer " + token),
+		AllowedModels: allowedModels,
+		ExpiresAt:     expiresAt,
+		CreatedAt:     time.Unix(time.Now().Unix(), 0), // stored with second precision
+	}
+
+	var allowedJSON string
+	if len(allowedModels) > 0 {
+		b, err := json.Marshal(allowedModels)
+		if err != nil {
+			return "", pricing.VirtualKey{}, err
+		}
+		allowedJSON = string(b)
+	}
+
+	p.mu.Lock()
+	_, err := p.db.Exec(`
+		INSERT INTO virtual_keys (id, key_hash, masked_key, name, allowed_models, expires_at, revoked_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NULL, ?)
+	`, vk.ID, vk.KeyHash, vk.MaskedKey, vk.Name, allowedJSON, timeToNullUnix(expiresAt), vk.CreatedAt.Unix())
+	p.mu.Unlock()
+	if err != nil {
+		return "", pricing.VirtualKey{}, err
+	}
+
+	p.vkMu.Lock()
+	p.virtualKeys[vk.KeyHash] = &vk
+	p.vkMu.Unlock()
+
+	return token, vk, nil
+}
+
+// ListVirtualKeys returns every issued key, oldest first
+func (p *PersistentLimitManager) ListVirtualKeys() []pricing.VirtualKey {
+	p.vkMu.RLock()
+	defer p.vkMu.RUnlock()
+
+	keys := make([]pricing.VirtualKey, 0, len(p.virtualKeys))
+	for _, vk := range p.virtualKeys {
+		keys = append(keys, *vk)
+	}
+	// Oldest first
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// RevokeVirtualKey marks a key as revoked; lookups fail from this point on
+func (p *PersistentLimitManager) RevokeVirtualKey(id string) (pricing.VirtualKey, error) {
+	p.vkMu.Lock()
+	defer p.vkMu.Unlock()
+
+	var found *pricing.VirtualKey
+	for _, vk := range p.virtualKeys {
+		if vk.ID == id {
+			found = vk
+			break
+		}
+	}
+	if found == nil {
+		return pricing.VirtualKey{}, fmt.Errorf("unknown virtual key %q", id)
+	}
+	if found.RevokedAt != nil {
+		return *found, nil // already revoked
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	p.mu.Lock()
+	_, err := p.db.Exec(`UPDATE virtual_keys SET revoked_at = ? WHERE id = ?`, now.Unix(), id)
+	p.mu.Unlock()
+	if err != nil {
+		return pricing.VirtualKey{}, err
+	}
+
+	found.RevokedAt = &now
+	return *found, nil
+}
+
+// LookupVirtualKey finds the key matching a presented token (revoked and expired keys included;
+// callers decide with VirtualKey.Active)
+func (p *PersistentLimitManager) LookupVirtualKey(token string) (pricing.VirtualKey, bool) {
+	p.vkMu.RLock()
+	defer p.vkMu.RUnlock()
+
+	vk, ok := p.virtualKeys[virtualKeyHash(token)]
+	if !ok {
+		return pricing.VirtualKey{}, false
+	}
+	return *vk, true
+}
+
+func unixPtr(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(v.Int64, 0)
+	return &t
+}
+
+func timeToNullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
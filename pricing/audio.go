@@ -0,0 +1,55 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+)
+
+// AudioUnits holds the rates of audio models not billed by tokens: transcription per minute
+// of input audio (whisper-1) and speech per input character (tts-1)
+type AudioUnits struct {
+	PerMinute            float64 `yaml:"per_minute,omitempty"`             // USD per minute of audio
+	PerMillionCharacters float64 `yaml:"per_million_characters,omitempty"` // USD per 1M input characters
+}
+
+// AudioUnitsMoney holds the per-minute and per-character rates using Money type
+type AudioUnitsMoney struct {
+	PerMinute    Money
+	PerCharacter Money
+}
+
+// ComputeAudioPriceMoney prices an audio request from the duration of its input audio and the
+// number of characters of its input text, at the model's per-minute and per-character rates.
+// The duration is rounded up to the second. An error is returned when the model has neither rate.
+func ComputeAudioPriceMoney(modelRaw string, duration time.Duration, characters int) (PriceResultMoney, error) {
+	cfg, err := GetConfig()
+	if err != nil {
+		return PriceResultMoney{}, fmt.Errorf("failed to load pricing config: %w", err)
+	}
+	modelName := resolveModelName(cfg, modelRaw)
+	cfgMoney := cfg.ToMoney()
+	mp, found := cfgMoney.FindModelPricingMoney(modelName)
+	if !found || (mp.PerMinute.IsZero() && mp.PerCharacter.IsZero()) {
+		return PriceResultMoney{}, fmt.Errorf("no per-minute or per-character pricing for model %s", modelRaw)
+	}
+
+	secs := int64((duration + time.Second - 1) / time.Second)
+	if secs < 0 {
+		secs = 0
+	}
+	if characters < 0 {
+		characters = 0
+	}
+	var b CostBreakdown
+	b.AudioDuration = mp.PerMinute.Multiply(secs) / 60
+	b.InputCharacters = mp.PerCharacter.Multiply(int64(characters))
+	cost := b.AudioDuration.Add(b.InputCharacters)
+	return PriceResultMoney{
+		Model:       Model(modelName),
+		ServiceTier: "standard",
+		PromptCost:  cost,
+		TotalCost:   cost,
+		Breakdown:   b,
+		Note:        fmt.Sprintf("%ds of audio, %d character(s) priced per minute/character", secs, characters),
+	}, nil
+}
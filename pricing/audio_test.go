@@ -0,0 +1,63 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeAudioPriceMoney(t *testing.T) {
+	SetConfig(&PricingConfig{
+		Models: map[string]ModelPricing{
+			"whisper-1": {AudioUnits: AudioUnits{PerMinute: 0.006}},
+			"tts-1":     {AudioUnits: AudioUnits{PerMillionCharacters: 15}},
+			"gpt-4o":    {Prompt: 5, Completion: 15},
+		},
+	})
+	defer ResetConfig()
+
+	cases := []struct {
+		name       string
+		model      string
+		duration   time.Duration
+		characters int
+		want       float64
+	}{
+		{"one minute", "whisper-1", time.Minute, 0, 0.006},
+		{"rounded up to the second", "whisper-1", 1500 * time.Millisecond, 0, 0.0002},
+		{"prefix match", "whisper-1-2024", 10 * time.Minute, 0, 0.06},
+		{"characters", "tts-1", 0, 1000, 0.015},
+		{"no input", "tts-1", 0, 0, 0},
+	}
+	for _, c := range cases {
+		res, err := ComputeAudioPriceMoney(c.model, c.duration, c.characters)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		b := res.Breakdown
+		if !almostEqual(res.TotalCost.ToUSD(), c.want) || res.PromptCost != res.TotalCost || b.AudioDuration.Add(b.InputCharacters) != res.TotalCost {
+			t.Errorf("%s: got %+v, want $%.4f", c.name, res, c.want)
+		}
+	}
+
+	if _, err := ComputeAudioPriceMoney("gpt-4o", time.Minute, 0); err == nil {
+		t.Error("expected an error for a model without per-minute or per-character rates")
+	}
+}
+
+func TestAudioUnits_Config(t *testing.T) {
+	cfg, err := DefaultConfig()
+	if err != nil {
+		t.Fatalf("failed to load the embedded config: %v", err)
+	}
+	if got := cfg.Models["whisper-1"].PerMinute; got != 0.006 {
+		t.Errorf("unexpected whisper-1 per-minute rate %v", got)
+	}
+	if got := cfg.Models["tts-1-hd"].PerMillionCharacters; got != 30 {
+		t.Errorf("unexpected tts-1-hd per-character rate %v", got)
+	}
+
+	cfg.Models["whisper-1"] = ModelPricing{AudioUnits: AudioUnits{PerMinute: -1}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected a negative per-minute rate to be rejected")
+	}
+}
@@ -0,0 +1,34 @@
+package pricing
+
+import "time"
+
+// BatchFile is a batch input file uploaded through the proxy, with the worst-case cost of its
+// requests at the batch tier
+type BatchFile struct {
+	ID            string    `json:"id"`
+	Requests      int       `json:"requests"`
+	EstimatedCost Money     `json:"estimated_cost"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Batch is a batch job created through the proxy. Its cost is only known once the output file
+// is downloaded; it is then charged, at the batch tier, to the key that created it.
+type Batch struct {
+	ID            string     `json:"id"`
+	Key           string     `json:"key"` // hashed key of the creator
+	MaskedKey     string     `json:"masked_key"`
+	Endpoint      string     `json:"endpoint"`
+	InputFileID   string     `json:"input_file_id"`
+	OutputFileID  string     `json:"output_file_id,omitempty"`
+	Status        string     `json:"status"`   // as last reported upstream
+	Requests      int        `json:"requests"` // 0 when the input file wasn't uploaded through the proxy
+	EstimatedCost Money      `json:"estimated_cost"`
+	ChargedCost   Money      `json:"charged_cost"`
+	ChargedAt     *time.Time `json:"charged_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Pending reports whether the batch output hasn't been charged yet
+func (b *Batch) Pending() bool {
+	return b.ChargedAt == nil
+}
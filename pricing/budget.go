@@ -0,0 +1,154 @@
+package pricing
+
+import "time"
+
+// BudgetPeriod identifies a budget window.
+// PeriodHour is the limiter's rolling hour (see ManagerMoney); the other periods are
+// calendar-aligned in the manager's timezone (weeks start on Monday).
+type BudgetPeriod string
+
+const (
+	PeriodHour  BudgetPeriod = "hour"
+	PeriodDay   BudgetPeriod = "day"
+	PeriodWeek  BudgetPeriod = "week"
+	PeriodMonth BudgetPeriod = "month"
+)
+
+// Budget is a spending cap over a calendar-aligned period, checked in addition to the hourly limit
+type Budget struct {
+	Period BudgetPeriod
+	Limit  Money
+}
+
+// BudgetStatus reports a key's spend within one budget window
+type BudgetStatus struct {
+	Period      BudgetPeriod `json:"period"`
+	Spent       Money        `json:"spent"`
+	Reserved    Money        `json:"reserved,omitempty"` // held by in-flight requests
+	Limit       Money        `json:"limit"`
+	WindowStart time.Time    `json:"window_start"`
+	WindowEnd   time.Time    `json:"window_end"`
+	Allowed     bool         `json:"allowed"`
+}
+
+// Start returns the beginning of the calendar window containing t in loc
+func (p BudgetPeriod) Start(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch p {
+	case PeriodWeek:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default: // PeriodDay
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// End returns the end of the calendar window beginning at start
+func (p BudgetPeriod) End(start time.Time) time.Time {
+	switch p {
+	case PeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default: // PeriodDay
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// periodWindow tracks spend in one calendar-aligned budget window
+type periodWindow struct {
+	start time.Time
+	spent Money
+}
+
+// period returns the key's current window for p, starting a new one when the calendar
+// window has moved on. Callers must hold kw.mu.
+func (kw *keyWindowMoney) period(p BudgetPeriod, now time.Time, loc *time.Location) *periodWindow {
+	if kw.periods == nil {
+		kw.periods = make(map[BudgetPeriod]*periodWindow)
+	}
+	start := p.Start(now, loc)
+	w, ok := kw.periods[p]
+	if !ok || !w.start.Equal(start) {
+		w = &periodWindow{start: start}
+		kw.periods[p] = w
+	}
+	return w
+}
+
+// SetBudgets configures the calendar budgets checked for every key in addition to the hourly
+// limit, with windows aligned in loc (nil means UTC). Passing no budgets disables them.
+func (m *ManagerMoney) SetBudgets(budgets []Budget, loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	m.budgetMu.Lock()
+	defer m.budgetMu.Unlock()
+	m.budgets = append([]Budget(nil), budgets...)
+	m.location = loc
+}
+
+// Budgets returns the configured calendar budgets and their timezone
+func (m *ManagerMoney) Budgets() ([]Budget, *time.Location) {
+	m.budgetMu.RLock()
+	defer m.budgetMu.RUnlock()
+	loc := m.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return m.budgets, loc
+}
+
+// budgetStatuses returns the key's status in each configured calendar budget
+func (m *ManagerMoney) budgetStatuses(key string) []BudgetStatus {
+	budgets, loc := m.Budgets()
+	if key == "" || len(budgets) == 0 {
+		return nil
+	}
+
+	kw := m.getKWMoney(key)
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	return kw.budgetStatusesLocked(budgets, time.Now(), loc)
+}
+
+// budgetStatusesLocked computes budget statuses. Callers must hold kw.mu.
+func (kw *keyWindowMoney) budgetStatusesLocked(budgets []Budget, now time.Time, loc *time.Location) []BudgetStatus {
+	statuses := make([]BudgetStatus, 0, len(budgets))
+	for _, b := range budgets {
+		w := kw.period(b.Period, now, loc)
+		statuses = append(statuses, BudgetStatus{
+			Period:      b.Period,
+			Spent:       w.spent,
+			Reserved:    kw.reserved,
+			Limit:       b.Limit,
+			WindowStart: w.start,
+			WindowEnd:   b.Period.End(w.start),
+			Allowed:     b.Limit.IsNegative() || w.spent.Add(kw.reserved).LessThan(b.Limit),
+		})
+	}
+	return statuses
+}
+
+// RestoreSpend sets a key's spend for a window, e.g. when loading persisted usage.
+// Windows that are no longer current are reset on their next use.
+func (m *ManagerMoney) RestoreSpend(key string, period BudgetPeriod, windowStart time.Time, spent Money) {
+	if key == "" {
+		return
+	}
+	kw := m.getKWMoney(key)
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+
+	if period == PeriodHour {
+		kw.windowStart = windowStart
+		kw.spent = spent
+		return
+	}
+	if kw.periods == nil {
+		kw.periods = make(map[BudgetPeriod]*periodWindow)
+	}
+	kw.periods[period] = &periodWindow{start: windowStart, spent: spent}
+}
@@ -0,0 +1,123 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetPeriod_CalendarAlignment(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	// Wednesday 2025-01-15 23:30 UTC is already Thursday 00:30 in Paris
+	now := time.Date(2025, 1, 15, 23, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		period    BudgetPeriod
+		loc       *time.Location
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{PeriodDay, time.UTC, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{PeriodDay, paris, time.Date(2025, 1, 16, 0, 0, 0, 0, paris), time.Date(2025, 1, 17, 0, 0, 0, 0, paris)},
+		{PeriodWeek, time.UTC, time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.UTC, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		start := tc.period.Start(now, tc.loc)
+		if !start.Equal(tc.wantStart) {
+			t.Errorf("%s/%s start: got %v, want %v", tc.period, tc.loc, start, tc.wantStart)
+		}
+		if end := tc.period.End(start); !end.Equal(tc.wantEnd) {
+			t.Errorf("%s/%s end: got %v, want %v", tc.period, tc.loc, end, tc.wantEnd)
+		}
+	}
+
+	// Sunday belongs to the week that started on the previous Monday
+	sunday := time.Date(2025, 1, 19, 12, 0, 0, 0, time.UTC)
+	if start := PeriodWeek.Start(sunday, time.UTC); !start.Equal(time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Sunday week start: got %v", start)
+	}
+}
+
+func TestManagerMoney_BudgetsCheckedTogether(t *testing.T) {
+	mgr := NewManagerMoneyFromUSD(2.0) // $2/hour
+	mgr.SetBudgets([]Budget{
+		{Period: PeriodDay, Limit: NewMoneyFromUSD(3.0)},
+		{Period: PeriodMonth, Limit: NewMoneyFromUSD(500.0)},
+	}, time.UTC)
+
+	key := "budget-key"
+	mgr.AddCost(key, NewMoneyFromUSD(1.5))
+
+	allowed, status := mgr.AllowBudget(key)
+	if !allowed || status.Period != PeriodHour {
+		t.Fatalf("expected allowed with hourly status, got allowed=%v status=%+v", allowed, status)
+	}
+
+	// Simulate an earlier hour of the same day having spent $2 already
+	kw := mgr.getKWMoney(key)
+	kw.mu.Lock()
+	kw.periods[PeriodDay].spent = kw.periods[PeriodDay].spent.Add(NewMoneyFromUSD(2.0))
+	kw.mu.Unlock()
+
+	// Hourly spend ($1.5) is under $2, but the day ($3.5) is over $3
+	allowed, status = mgr.AllowBudget(key)
+	if allowed {
+		t.Fatal("expected the daily budget to block the key")
+	}
+	if status.Period != PeriodDay || status.Limit != NewMoneyFromUSD(3.0) || status.Spent != NewMoneyFromUSD(3.5) {
+		t.Fatalf("unexpected tripped budget: %+v", status)
+	}
+	if !status.WindowEnd.Equal(PeriodDay.End(PeriodDay.Start(time.Now(), time.UTC))) {
+		t.Fatalf("expected window end at next midnight, got %v", status.WindowEnd)
+	}
+
+	// Allow reports the tripped budget's values
+	ok, windowEnd, spent, lim := mgr.Allow(key)
+	if ok || !windowEnd.Equal(status.WindowEnd) || spent != status.Spent || lim != status.Limit {
+		t.Fatalf("Allow should mirror the tripped budget, got %v %v %s %s", ok, windowEnd, spent, lim)
+	}
+
+	// Usage reports every budget and the blocked state
+	usage := mgr.GetUsage(key)
+	if usage.Allowed || len(usage.Budgets) != 2 {
+		t.Fatalf("expected blocked usage with 2 budgets, got %+v", usage)
+	}
+	if usage.Budgets[1].Period != PeriodMonth || usage.Budgets[1].Spent != NewMoneyFromUSD(1.5) {
+		t.Fatalf("unexpected month budget: %+v", usage.Budgets[1])
+	}
+}
+
+func TestManagerMoney_BudgetsWithDisabledHourlyLimit(t *testing.T) {
+	mgr := NewManagerMoneyFromUSD(-1) // hourly limit disabled
+	mgr.SetBudgets([]Budget{{Period: PeriodWeek, Limit: NewMoneyFromUSD(1.0)}}, time.UTC)
+
+	key := "weekly-key"
+	mgr.AddCost(key, NewMoneyFromUSD(1.0))
+
+	allowed, status := mgr.AllowBudget(key)
+	if allowed || status.Period != PeriodWeek {
+		t.Fatalf("expected weekly budget to block, got allowed=%v status=%+v", allowed, status)
+	}
+}
+
+func TestManagerMoney_RestoreSpendResetsStaleWindows(t *testing.T) {
+	mgr := NewManagerMoneyFromUSD(10.0)
+	mgr.SetBudgets([]Budget{{Period: PeriodDay, Limit: NewMoneyFromUSD(1.0)}}, time.UTC)
+
+	key := "restored-key"
+	today := PeriodDay.Start(time.Now(), time.UTC)
+	mgr.RestoreSpend(key, PeriodDay, today.AddDate(0, 0, -1), NewMoneyFromUSD(5.0)) // yesterday: stale
+	if allowed, _ := mgr.AllowBudget(key); !allowed {
+		t.Fatal("yesterday's spend should not count against today's budget")
+	}
+
+	mgr.RestoreSpend(key, PeriodDay, today, NewMoneyFromUSD(5.0))
+	if allowed, status := mgr.AllowBudget(key); allowed || status.Period != PeriodDay {
+		t.Fatalf("today's restored spend should block, got allowed=%v status=%+v", allowed, status)
+	}
+}
@@ -1,15 +1,21 @@
 package pricing
 
 import (
+	_ "embed"
 	"fmt"
 	"os"
-	"path/filepath"
-	"runtime"
 	"sync"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
 
+// defaultPricingYAML is the pricing table shipped with the binary, so pricing works
+// regardless of where (or whether) the source tree exists at runtime.
+//
+//go:embed pricing.yaml
+var defaultPricingYAML []byte
+
 // TierPricing represents pricing for a specific service tier
 type TierPricing struct {
 	Prompt       float64 `yaml:"prompt"`
@@ -24,15 +30,54 @@ type TierPricingMoney struct {
 	Completion   Money
 }
 
+// ContextTierPricing holds the standard tier rates of requests whose prompt is longer than a
+// threshold, e.g. Gemini 2.5 Pro above 200k tokens
+type ContextTierPricing struct {
+	AbovePromptTokens int `yaml:"above_prompt_tokens"`
+	TierPricing       `yaml:",inline"`
+}
+
+// ContextTierPricingMoney holds the rates of a context length tier using Money type
+type ContextTierPricingMoney struct {
+	AbovePromptTokens int
+	TierPricingMoney
+}
+
+// ModalityPricing holds a model's audio and image token rates, per 1M tokens, and the rate of
+// prompt tokens written to cache (Anthropic prompt caching). Zero (unset) rates fall back to the
+// text prompt/completion rate. Cached audio and image tokens are billed at the cached prompt rate.
+type ModalityPricing struct {
+	AudioPrompt      float64 `yaml:"audio_prompt,omitempty"`
+	AudioCompletion  float64 `yaml:"audio_completion,omitempty"`
+	ImagePrompt      float64 `yaml:"image_prompt,omitempty"`
+	ImageCompletion  float64 `yaml:"image_completion,omitempty"`
+	CacheWritePrompt float64 `yaml:"cache_write_prompt,omitempty"`
+}
+
+// ModalityPricingMoney holds a model's audio, image and cache write token rates using Money type
+type ModalityPricingMoney struct {
+	AudioPrompt      Money
+	AudioCompletion  Money
+	ImagePrompt      Money
+	ImageCompletion  Money
+	CacheWritePrompt Money
+}
+
 // ModelPricing represents pricing for a single model with different service tiers
 type ModelPricing struct {
-	Prompt       float64      `yaml:"prompt"`
-	CachedPrompt float64      `yaml:"cached_prompt"`
-	Completion   float64      `yaml:"completion"`
-	Flex         *TierPricing `yaml:"flex,omitempty"`
-	Priority     *TierPricing `yaml:"priority,omitempty"`
-	Batch        *TierPricing `yaml:"batch,omitempty"`
-	Aliases      []string     `yaml:"aliases,omitempty"`
+	Prompt          float64 `yaml:"prompt"`
+	CachedPrompt    float64 `yaml:"cached_prompt"`
+	Completion      float64 `yaml:"completion"`
+	ModalityPricing `yaml:",inline"`
+	Images          ImagePrices `yaml:"images,omitempty"` // per-image prices by quality and size
+	AudioUnits      `yaml:",inline"`
+	Flex            *TierPricing `yaml:"flex,omitempty"`
+	Priority        *TierPricing `yaml:"priority,omitempty"`
+	Batch           *TierPricing `yaml:"batch,omitempty"`
+	// ContextTiers replace the standard rates when the prompt exceeds their threshold
+	ContextTiers []ContextTierPricing `yaml:"context_tiers,omitempty"`
+	FineTuned    *ModelPricing        `yaml:"fine_tuned,omitempty"` // rates of the model's fine-tunes
+	Aliases      []string             `yaml:"aliases,omitempty"`
 }
 
 // ModelPricingMoney represents pricing for a single model using Money type
@@ -40,116 +85,322 @@ type ModelPricingMoney struct {
 	Prompt       Money
 	CachedPrompt Money
 	Completion   Money
+	ModalityPricingMoney
+	Images ImagePricesMoney
+	AudioUnitsMoney
 	Flex         *TierPricingMoney
 	Priority     *TierPricingMoney
 	Batch        *TierPricingMoney
+	ContextTiers []ContextTierPricingMoney
+	FineTuned    *ModelPricingMoney
 	Aliases      []string
 }
 
 // PricingConfig represents the entire pricing configuration
 type PricingConfig struct {
-	Models  map[string]ModelPricing `yaml:"models"`
-	Default *ModelPricing           `yaml:"default,omitempty"`
+	Models map[string]ModelPricing `yaml:"models"`
+	// FineTunes overrides the pricing of specific fine-tuned models, by full model name (ft:...)
+	FineTunes map[string]ModelPricing `yaml:"fine_tunes,omitempty"`
+	// Tools holds the per-call/per-session fees of the Responses API hosted tools, by tool
+	Tools   map[string]ToolPricing `yaml:"tools,omitempty"`
+	Default *ModelPricing          `yaml:"default,omitempty"`
 }
 
 // PricingConfigMoney represents the entire pricing configuration using Money type
 type PricingConfigMoney struct {
-	Models  map[string]ModelPricingMoney
-	Default *ModelPricingMoney
+	Models    map[string]ModelPricingMoney
+	FineTunes map[string]ModelPricingMoney
+	Tools     map[string]ToolPricingMoney
+	Default   *ModelPricingMoney
+
+	resolver *modelIndex // of the configuration it was converted from
+}
+
+// configState is an immutable snapshot of the active pricing configuration.
+// It is swapped atomically, so pricing that already started keeps using the table it read.
+type configState struct {
+	cfg   *PricingConfig
+	index *modelIndex // model name resolution, built once per load
+	info  ConfigInfo
+}
+
+// configSource remembers where the active configuration came from so it can be reloaded
+type configSource struct {
+	file   string
+	merge  bool
+	custom bool // set programmatically through SetConfig
 }
 
 var (
-	config     *PricingConfig
-	configOnce sync.Once
-	configErr  error
+	current       atomic.Pointer[configState]
+	loadMu        sync.Mutex // serializes (re)loads
+	source        configSource
+	configVersion int64
 )
 
+// parseConfigData parses a YAML pricing document
+func parseConfigData(data []byte) (*PricingConfig, error) {
+	var cfg PricingConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// readConfigFile reads and parses a YAML pricing file
+func readConfigFile(configPath string) (*PricingConfig, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", configPath, err)
+	}
+
+	cfg, err := parseConfigData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", configPath, err)
+	}
+	return cfg, nil
+}
+
+// DefaultConfig returns the pricing table embedded in the binary
+func DefaultConfig() (*PricingConfig, error) {
+	cfg, err := parseConfigData(defaultPricingYAML)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse embedded pricing config: %w", err)
+	}
+	return cfg, nil
+}
+
 // LoadConfig loads pricing configuration from a YAML file
 func LoadConfig(configPath string) error {
-	data, err := os.ReadFile(configPath)
+	cfg, err := readConfigFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read config file %s: %w", configPath, err)
+		return err
 	}
 
-	var cfg PricingConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return fmt.Errorf("failed to parse config file %s: %w", configPath, err)
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	source = configSource{file: configPath}
+	storeConfigLocked(cfg)
+	return nil
+}
+
+// InitConfig loads the embedded pricing table and, if pricingFile is set, applies the file on top.
+// With merge, models in the file override or extend the embedded ones (and its default, if any,
+// replaces the embedded default); without merge, the file replaces the embedded table entirely.
+// An error is returned when no usable pricing could be loaded.
+func InitConfig(pricingFile string, merge bool) error {
+	cfg, err := buildConfig(pricingFile, merge)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	source = configSource{file: pricingFile, merge: merge}
+	storeConfigLocked(cfg)
+	return nil
+}
+
+// buildConfig assembles the effective pricing configuration from the embedded table and an optional file
+func buildConfig(pricingFile string, merge bool) (*PricingConfig, error) {
+	if pricingFile == "" {
+		return DefaultConfig()
+	}
+
+	fileCfg, err := readConfigFile(pricingFile)
+	if err != nil {
+		return nil, err
+	}
+	if !merge {
+		return fileCfg, nil
+	}
+
+	base, err := DefaultConfig()
+	if err != nil {
+		return nil, err
+	}
+	return MergeConfig(base, fileCfg), nil
+}
+
+// MergeConfig returns a new configuration with the models, fine-tune overrides, tool fees and
+// default of override applied on top of base
+func MergeConfig(base, override *PricingConfig) *PricingConfig {
+	merged := &PricingConfig{
+		Models:  make(map[string]ModelPricing, len(base.Models)+len(override.Models)),
+		Default: base.Default,
+	}
+	for name, mp := range base.Models {
+		merged.Models[name] = mp
+	}
+	for name, mp := range override.Models {
+		merged.Models[name] = mp
+	}
+	if len(base.FineTunes)+len(override.FineTunes) > 0 {
+		merged.FineTunes = make(map[string]ModelPricing, len(base.FineTunes)+len(override.FineTunes))
+		for name, mp := range base.FineTunes {
+			merged.FineTunes[name] = mp
+		}
+		for name, mp := range override.FineTunes {
+			merged.FineTunes[name] = mp
+		}
+	}
+	if len(base.Tools)+len(override.Tools) > 0 {
+		merged.Tools = make(map[string]ToolPricing, len(base.Tools)+len(override.Tools))
+		for tool, tp := range base.Tools {
+			merged.Tools[tool] = tp
+		}
+		for tool, tp := range override.Tools {
+			merged.Tools[tool] = tp
+		}
+	}
+	if override.Default != nil {
+		merged.Default = override.Default
 	}
+	return merged
+}
 
-	config = &cfg
+// Validate checks that the configuration can actually price requests
+func (cfg *PricingConfig) Validate() error {
+	if len(cfg.Models) == 0 && cfg.Default == nil {
+		return fmt.Errorf("pricing config defines no models and no default pricing")
+	}
+	if _, err := newConfigIndex(cfg); err != nil {
+		return err
+	}
+	for name, mp := range cfg.Models {
+		if err := mp.validate(); err != nil {
+			return fmt.Errorf("model %q: %w", name, err)
+		}
+	}
+	for name, mp := range cfg.FineTunes {
+		if _, ok := FineTunedBaseModel(name); !ok {
+			return fmt.Errorf("fine_tunes: %q is not a fine-tuned model name (ft:<base>:...)", name)
+		}
+		if err := mp.validate(); err != nil {
+			return fmt.Errorf("fine-tune %q: %w", name, err)
+		}
+	}
+	for tool, tp := range cfg.Tools {
+		if tp.PerCall < 0 || tp.PerSession < 0 {
+			return fmt.Errorf("tool %q has a negative price", tool)
+		}
+	}
+	if cfg.Default != nil {
+		if err := cfg.Default.validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	return nil
+}
+
+// validate rejects negative prices in the standard rates and every configured tier
+func (mp *ModelPricing) validate() error {
+	tiers := map[string]*TierPricing{
+		"standard": {Prompt: mp.Prompt, CachedPrompt: mp.CachedPrompt, Completion: mp.Completion},
+		"flex":     mp.Flex,
+		"priority": mp.Priority,
+		"batch":    mp.Batch,
+	}
+	if mp.AudioPrompt < 0 || mp.AudioCompletion < 0 || mp.ImagePrompt < 0 || mp.ImageCompletion < 0 || mp.CacheWritePrompt < 0 {
+		return fmt.Errorf("audio/image/cache write rates can't be negative")
+	}
+	if mp.PerMinute < 0 || mp.PerMillionCharacters < 0 {
+		return fmt.Errorf("per-minute/per-character rates can't be negative")
+	}
+	if err := mp.Images.validate(); err != nil {
+		return err
+	}
+	thresholds := make(map[int]bool, len(mp.ContextTiers))
+	for _, ct := range mp.ContextTiers {
+		if ct.AbovePromptTokens <= 0 {
+			return fmt.Errorf("context tier threshold must be positive, got %d", ct.AbovePromptTokens)
+		}
+		if thresholds[ct.AbovePromptTokens] {
+			return fmt.Errorf("duplicate context tier above %d prompt tokens", ct.AbovePromptTokens)
+		}
+		thresholds[ct.AbovePromptTokens] = true
+		if ct.Prompt < 0 || ct.CachedPrompt < 0 || ct.Completion < 0 {
+			return fmt.Errorf("context tier above %d prompt tokens has a negative price", ct.AbovePromptTokens)
+		}
+	}
+	if mp.FineTuned != nil {
+		if err := mp.FineTuned.validate(); err != nil {
+			return fmt.Errorf("fine_tuned: %w", err)
+		}
+	}
+	for tier, tp := range tiers {
+		if tp == nil {
+			continue
+		}
+		if tp.Prompt < 0 || tp.CachedPrompt < 0 || tp.Completion < 0 {
+			return fmt.Errorf("%s tier has a negative price", tier)
+		}
+	}
 	return nil
 }
 
 // GetConfig returns the loaded pricing configuration
-// If no config has been loaded, it attempts to load from the default location
+// If no config has been loaded, it falls back to the pricing table embedded in the binary
 func GetConfig() (*PricingConfig, error) {
-	configOnce.Do(func() {
-		if config == nil {
-			// Try to load from default location (same directory as this file)
-			defaultPath := filepath.Join(filepath.Dir(getCurrentFilePath()), "pricing.yaml")
-			configErr = LoadConfig(defaultPath)
-		}
-	})
+	if st := current.Load(); st != nil {
+		return st.cfg, nil
+	}
 
-	if configErr != nil {
-		return nil, configErr
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if st := current.Load(); st != nil { // loaded while we were waiting
+		return st.cfg, nil
 	}
 
-	return config, nil
+	cfg, err := DefaultConfig()
+	if err != nil {
+		return nil, err
+	}
+	return storeConfigLocked(cfg).cfg, nil
 }
 
 // SetConfig allows setting the configuration directly (useful for testing)
 func SetConfig(cfg *PricingConfig) {
-	config = cfg
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	source = configSource{custom: true}
+	storeConfigLocked(cfg)
 }
 
 // ResetConfig clears the loaded configuration (useful for testing)
 func ResetConfig() {
-	config = nil
-	configOnce = sync.Once{}
-	configErr = nil
-}
-
-// getCurrentFilePath returns the path of this source file
-func getCurrentFilePath() string {
-	// Use runtime.Caller to get the actual file path
-	_, filename, _, ok := runtime.Caller(0)
-	if !ok {
-		// Fallback - try relative to working directory
-		if wd, err := os.Getwd(); err == nil {
-			return filepath.Join(wd, "pricing", "config.go")
-		}
-		return "config.go" // last resort
-	}
-	return filename
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	current.Store(nil)
+	source = configSource{}
 }
 
-// FindModelPricing looks up pricing for a model, checking for matching prefixes
+// FindModelPricing looks up pricing for a model: exact name, alias, dated snapshot, then the longest
+// matching prefix. Fine-tuned models use their fine_tunes entry, else their base model's fine_tuned
+// rates. Fine-tunes of a model without fine_tuned rates are not found: fine-tuned inference costs
+// more than the base model's.
 func (cfg *PricingConfig) FindModelPricing(modelName string) (*ModelPricing, bool) {
-	// Direct lookup first
-	if pricing, exists := cfg.Models[modelName]; exists {
+	res := cfg.index().resolve(modelName)
+	switch res.Match {
+	case MatchNone:
+		return nil, false
+	case MatchFineTune:
+		pricing := cfg.FineTunes[res.Resolved]
 		return &pricing, true
 	}
 
-	// Check for prefix matches - find the longest matching prefix
-	var bestMatch string
-	var bestPricing *ModelPricing
-
-	for configModel, pricing := range cfg.Models {
-		// Check if the input model name starts with this config model name
-		if len(configModel) > len(bestMatch) && len(modelName) >= len(configModel) &&
-			modelName[:len(configModel)] == configModel {
-			bestMatch = configModel
-			pricingCopy := pricing // Create a copy to avoid pointer issues
-			bestPricing = &pricingCopy
+	pricing := cfg.Models[res.Resolved]
+	if res.Match == MatchFineTuned {
+		if pricing.FineTuned == nil {
+			logMissingFineTuned(modelName, res.Resolved)
+			return nil, false
 		}
+		return pricing.FineTuned, true
 	}
-
-	if bestPricing != nil {
-		return bestPricing, true
-	}
-
-	return nil, false
+	return &pricing, true
 }
 
 // GetTierPricing returns pricing for a specific service tier, falling back to standard if tier not available
@@ -178,7 +429,19 @@ func (mp *ModelPricing) ToMoney() ModelPricingMoney {
 		Prompt:       NewMoneyFromUSD(mp.Prompt / 1000000.0),
 		CachedPrompt: NewMoneyFromUSD(mp.CachedPrompt / 1000000.0),
 		Completion:   NewMoneyFromUSD(mp.Completion / 1000000.0),
-		Aliases:      mp.Aliases,
+		ModalityPricingMoney: ModalityPricingMoney{
+			AudioPrompt:      NewMoneyFromUSD(mp.AudioPrompt / 1000000.0),
+			AudioCompletion:  NewMoneyFromUSD(mp.AudioCompletion / 1000000.0),
+			ImagePrompt:      NewMoneyFromUSD(mp.ImagePrompt / 1000000.0),
+			ImageCompletion:  NewMoneyFromUSD(mp.ImageCompletion / 1000000.0),
+			CacheWritePrompt: NewMoneyFromUSD(mp.CacheWritePrompt / 1000000.0),
+		},
+		Images: mp.Images.ToMoney(),
+		AudioUnitsMoney: AudioUnitsMoney{
+			PerMinute:    NewMoneyFromUSD(mp.PerMinute),
+			PerCharacter: NewMoneyFromUSD(mp.PerMillionCharacters / 1000000.0),
+		},
+		Aliases: mp.Aliases,
 	}
 
 	if mp.Flex != nil {
@@ -205,19 +468,50 @@ func (mp *ModelPricing) ToMoney() ModelPricingMoney {
 		}
 	}
 
+	for _, ct := range mp.ContextTiers {
+		result.ContextTiers = append(result.ContextTiers, ContextTierPricingMoney{
+			AbovePromptTokens: ct.AbovePromptTokens,
+			TierPricingMoney: TierPricingMoney{
+				Prompt:       NewMoneyFromUSD(ct.Prompt / 1000000.0),
+				CachedPrompt: NewMoneyFromUSD(ct.CachedPrompt / 1000000.0),
+				Completion:   NewMoneyFromUSD(ct.Completion / 1000000.0),
+			},
+		})
+	}
+
+	if mp.FineTuned != nil {
+		fineTuned := mp.FineTuned.ToMoney()
+		result.FineTuned = &fineTuned
+	}
+
 	return result
 }
 
 // ToMoney converts float64-based PricingConfig to Money-based PricingConfigMoney
 func (cfg *PricingConfig) ToMoney() PricingConfigMoney {
 	result := PricingConfigMoney{
-		Models: make(map[string]ModelPricingMoney),
+		Models:   make(map[string]ModelPricingMoney),
+		resolver: cfg.index(),
 	}
 
 	for name, pricing := range cfg.Models {
 		result.Models[name] = pricing.ToMoney()
 	}
 
+	if len(cfg.FineTunes) > 0 {
+		result.FineTunes = make(map[string]ModelPricingMoney, len(cfg.FineTunes))
+		for name, pricing := range cfg.FineTunes {
+			result.FineTunes[name] = pricing.ToMoney()
+		}
+	}
+
+	if len(cfg.Tools) > 0 {
+		result.Tools = make(map[string]ToolPricingMoney, len(cfg.Tools))
+		for tool, tp := range cfg.Tools {
+			result.Tools[tool] = tp.ToMoney()
+		}
+	}
+
 	if cfg.Default != nil {
 		defaultMoney := cfg.Default.ToMoney()
 		result.Default = &defaultMoney
@@ -246,30 +540,43 @@ func (mp *ModelPricingMoney) GetTierPricingMoney(serviceTier string) (prompt, ca
 	return mp.Prompt, mp.CachedPrompt, mp.Completion, "standard"
 }
 
-// FindModelPricingMoney looks up Money-based pricing for a model
-func (cfg *PricingConfigMoney) FindModelPricingMoney(modelName string) (*ModelPricingMoney, bool) {
-	// Direct lookup first
-	if pricing, exists := cfg.Models[modelName]; exists {
-		return &pricing, true
+// ContextTier returns the context length tier of a prompt: the one with the highest threshold
+// the prompt exceeds, or nil when the standard rates apply
+func (mp *ModelPricingMoney) ContextTier(promptTokens int) *ContextTierPricingMoney {
+	var tier *ContextTierPricingMoney
+	for i := range mp.ContextTiers {
+		ct := &mp.ContextTiers[i]
+		if promptTokens > ct.AbovePromptTokens && (tier == nil || ct.AbovePromptTokens > tier.AbovePromptTokens) {
+			tier = ct
+		}
 	}
+	return tier
+}
 
-	// Check for prefix matches - find the longest matching prefix
-	var bestMatch string
-	var bestPricing *ModelPricingMoney
+// logMissingFineTuned reports a fine-tune priced like an unknown model, because its base model has
+// no fine_tuned rates
+func logMissingFineTuned(model, base string) {
+	fmt.Printf("[pricing] No fine_tuned pricing for %q (base model %q): priced like an unknown model\n", model, base)
+}
 
-	for configModel, pricing := range cfg.Models {
-		// Check if the input model name starts with this config model name
-		if len(configModel) > len(bestMatch) && len(modelName) >= len(configModel) &&
-			modelName[:len(configModel)] == configModel {
-			bestMatch = configModel
-			pricingCopy := pricing // Create a copy to avoid pointer issues
-			bestPricing = &pricingCopy
-		}
+// FindModelPricingMoney looks up Money-based pricing for a model, resolving its name like FindModelPricing
+func (cfg *PricingConfigMoney) FindModelPricingMoney(modelName string) (*ModelPricingMoney, bool) {
+	res := cfg.index().resolve(modelName)
+	switch res.Match {
+	case MatchNone:
+		return nil, false
+	case MatchFineTune:
+		pricing := cfg.FineTunes[res.Resolved]
+		return &pricing, true
 	}
 
-	if bestPricing != nil {
-		return bestPricing, true
+	pricing := cfg.Models[res.Resolved]
+	if res.Match == MatchFineTuned {
+		if pricing.FineTuned == nil {
+			logMissingFineTuned(modelName, res.Resolved)
+			return nil, false
+		}
+		return pricing.FineTuned, true
 	}
-
-	return nil, false
+	return &pricing, true
 }
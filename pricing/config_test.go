@@ -0,0 +1,138 @@
+package pricing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePricingFile writes a YAML pricing file to a temp dir and returns its path
+func writePricingFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write pricing file: %v", err)
+	}
+	return path
+}
+
+func TestGetConfig_FallsBackToEmbeddedDefaults(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	cfg, err := GetConfig()
+	if err != nil {
+		t.Fatalf("failed to load embedded config: %v", err)
+	}
+	if _, found := cfg.FindModelPricing("gpt-5-nano"); !found {
+		t.Fatal("expected embedded config to contain gpt-5-nano")
+	}
+	if cfg.Default == nil {
+		t.Fatal("expected embedded config to define default pricing")
+	}
+}
+
+func TestInitConfig_MergesFileWithDefaults(t *testing.T) {
+	defer ResetConfig()
+
+	path := writePricingFile(t, `
+models:
+  gpt-5-nano:
+    prompt: 1.0
+    completion: 2.0
+  my-local-model:
+    prompt: 0.1
+    completion: 0.2
+fine_tunes:
+  ft:gpt-4o-mini-2024-07-18:acme::abc123:
+    prompt: 0.5
+    completion: 2.0
+`)
+
+	if err := InitConfig(path, true); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+	cfg, err := GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+
+	// Overridden model
+	if mp, _ := cfg.FindModelPricing("gpt-5-nano"); mp == nil || mp.Prompt != 1.0 {
+		t.Fatalf("expected gpt-5-nano to be overridden, got %+v", mp)
+	}
+	// Added model
+	if _, found := cfg.FindModelPricing("my-local-model"); !found {
+		t.Fatal("expected my-local-model from file")
+	}
+	// Untouched embedded model and default
+	if _, found := cfg.FindModelPricing("gpt-5-mini"); !found {
+		t.Fatal("expected gpt-5-mini from embedded defaults")
+	}
+	if cfg.Default == nil {
+		t.Fatal("expected embedded default to be kept")
+	}
+	// Fine-tune override from file, embedded fine-tuned rates for other fine-tunes
+	if mp, _ := cfg.FindModelPricing("ft:gpt-4o-mini-2024-07-18:acme::abc123"); mp == nil || mp.Prompt != 0.5 {
+		t.Fatalf("expected the fine-tune override from file, got %+v", mp)
+	}
+	if mp, _ := cfg.FindModelPricing("ft:gpt-4o-mini-2024-07-18:acme::other"); mp == nil || mp.Prompt != 0.3 {
+		t.Fatalf("expected the embedded fine-tuned rates of gpt-4o-mini, got %+v", mp)
+	}
+}
+
+func TestInitConfig_ReplacesDefaults(t *testing.T) {
+	defer ResetConfig()
+
+	path := writePricingFile(t, `
+models:
+  my-local-model:
+    prompt: 0.1
+    completion: 0.2
+`)
+
+	if err := InitConfig(path, false); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+	cfg, _ := GetConfig()
+
+	if len(cfg.Models) != 1 {
+		t.Fatalf("expected only the file's model, got %d models", len(cfg.Models))
+	}
+	if cfg.Default != nil {
+		t.Fatal("expected no default pricing when replacing")
+	}
+}
+
+func TestInitConfig_Errors(t *testing.T) {
+	defer ResetConfig()
+
+	if err := InitConfig(filepath.Join(t.TempDir(), "missing.yaml"), true); err == nil {
+		t.Error("expected error for missing pricing file")
+	}
+
+	invalid := writePricingFile(t, "models: [not, a, map]")
+	if err := InitConfig(invalid, true); err == nil {
+		t.Error("expected error for invalid pricing file")
+	}
+
+	empty := writePricingFile(t, "models: {}")
+	if err := InitConfig(empty, false); err == nil {
+		t.Error("expected error when no pricing can be loaded")
+	}
+
+	notFineTune := writePricingFile(t, "fine_tunes: {gpt-4o-mini: {prompt: 1, completion: 2}}")
+	if err := InitConfig(notFineTune, true); err == nil {
+		t.Error("expected error for a fine_tunes entry that isn't a fine-tuned model name")
+	}
+
+	negative := writePricingFile(t, "models: {gpt-4o-mini: {prompt: 1, fine_tuned: {prompt: -1}}}")
+	if err := InitConfig(negative, true); err == nil {
+		t.Error("expected error for negative fine-tuned rates")
+	}
+
+	badThreshold := writePricingFile(t, "models: {gemini-2.5-pro: {prompt: 1, context_tiers: [{above_prompt_tokens: 0, prompt: 2}]}}")
+	if err := InitConfig(badThreshold, true); err == nil {
+		t.Error("expected error for a context tier without threshold")
+	}
+}
@@ -0,0 +1,17 @@
+package pricing
+
+import "strings"
+
+// FineTunedBaseModel returns the base model of a fine-tuned model name,
+// ft:<base>:<org>:<suffix>:<id> (e.g. ft:gpt-4o-mini-2024-07-18:my-org::abc123)
+func FineTunedBaseModel(name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, "ft:")
+	if !ok {
+		return "", false
+	}
+	base, _, _ := strings.Cut(rest, ":")
+	if base == "" {
+		return "", false
+	}
+	return base, true
+}
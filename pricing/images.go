@@ -0,0 +1,105 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ImagePrices are per-image prices in USD by quality, then size
+// (e.g. images["hd"]["1024x1792"] for dall-e-3)
+type ImagePrices map[string]map[string]float64
+
+// ImagePricesMoney are per-image prices by quality, then size, using Money type
+type ImagePricesMoney map[string]map[string]Money
+
+// ToMoney converts per-image USD prices to Money
+func (ip ImagePrices) ToMoney() ImagePricesMoney {
+	if ip == nil {
+		return nil
+	}
+	result := make(ImagePricesMoney, len(ip))
+	for quality, sizes := range ip {
+		result[quality] = make(map[string]Money, len(sizes))
+		for size, usd := range sizes {
+			result[quality][size] = NewMoneyFromUSD(usd)
+		}
+	}
+	return result
+}
+
+func (ip ImagePrices) validate() error {
+	for quality, sizes := range ip {
+		for size, usd := range sizes {
+			if usd < 0 {
+				return fmt.Errorf("image price for %s %s is negative", quality, size)
+			}
+		}
+	}
+	return nil
+}
+
+// lookup returns the price of one image. An empty, "auto" or unknown quality or size
+// is priced at the most expensive matching entry, since the upstream picks it.
+func (ip ImagePricesMoney) lookup(size, quality string) (Money, string, string, bool) {
+	qualities := []string{quality}
+	if _, ok := ip[quality]; !ok {
+		qualities = sortedKeys(ip)
+	}
+	var best Money
+	var bestQuality, bestSize string
+	found := false
+	for _, q := range qualities {
+		sizes := []string{size}
+		if _, ok := ip[q][size]; !ok {
+			sizes = sortedKeys(ip[q])
+		}
+		for _, s := range sizes {
+			if price := ip[q][s]; !found || price.GreaterThan(best) {
+				best, bestQuality, bestSize, found = price, q, s, true
+			}
+		}
+	}
+	return best, bestQuality, bestSize, found
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ComputeImagePriceMoney prices n images of the given size and quality from the model's per-image
+// prices (dall-e-2/3; gpt-image-1 is normally priced by tokens, see ParseImageUsage).
+// An error is returned when the model has no per-image prices.
+func ComputeImagePriceMoney(modelRaw string, n int, size, quality string) (PriceResultMoney, error) {
+	cfg, err := GetConfig()
+	if err != nil {
+		return PriceResultMoney{}, fmt.Errorf("failed to load pricing config: %w", err)
+	}
+	modelName := resolveModelName(cfg, modelRaw)
+	cfgMoney := cfg.ToMoney()
+	mp, found := cfgMoney.FindModelPricingMoney(modelName)
+	if !found || len(mp.Images) == 0 {
+		return PriceResultMoney{}, fmt.Errorf("no per-image pricing for model %s", modelRaw)
+	}
+	price, pricedQuality, pricedSize, ok := mp.Images.lookup(size, quality)
+	if !ok {
+		return PriceResultMoney{}, fmt.Errorf("no per-image pricing for model %s", modelRaw)
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	cost := price.Multiply(int64(n))
+	return PriceResultMoney{
+		Model:          Model(modelName),
+		ServiceTier:    "standard",
+		CompletionCost: cost,
+		TotalCost:      cost,
+		Breakdown:      CostBreakdown{Images: cost},
+		Note:           fmt.Sprintf("%d image(s) priced as %s %s", n, pricedQuality, pricedSize),
+	}, nil
+}
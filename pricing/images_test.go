@@ -0,0 +1,97 @@
+package pricing
+
+import "testing"
+
+func TestComputeImagePriceMoney(t *testing.T) {
+	SetConfig(&PricingConfig{
+		Models: map[string]ModelPricing{
+			"dall-e-3": {Images: ImagePrices{
+				"standard": {"1024x1024": 0.04, "1024x1792": 0.08},
+				"hd":       {"1024x1024": 0.08, "1024x1792": 0.12},
+			}},
+			"gpt-4o": {Prompt: 5, Completion: 15},
+		},
+	})
+	defer ResetConfig()
+
+	cases := []struct {
+		name          string
+		n             int
+		size, quality string
+		want          float64
+	}{
+		{"exact entry", 2, "1024x1792", "hd", 0.24},
+		{"standard square", 1, "1024x1024", "standard", 0.04},
+		{"n defaults to one", 0, "1024x1024", "standard", 0.04},
+		{"auto quality is priced at the most expensive", 1, "1024x1024", "auto", 0.08},
+		{"unknown size is priced at the most expensive", 1, "", "standard", 0.08},
+		{"nothing specified", 3, "", "", 0.36},
+	}
+	for _, c := range cases {
+		res, err := ComputeImagePriceMoney("dall-e-3", c.n, c.size, c.quality)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if !almostEqual(res.TotalCost.ToUSD(), c.want) || res.Breakdown.Images != res.TotalCost || res.CompletionCost != res.TotalCost {
+			t.Errorf("%s: got %+v, want $%.2f", c.name, res, c.want)
+		}
+	}
+
+	if _, err := ComputeImagePriceMoney("gpt-4o", 1, "1024x1024", ""); err == nil {
+		t.Error("expected an error for a model without per-image prices")
+	}
+}
+
+func TestImagePrices_Config(t *testing.T) {
+	cfg, err := parseConfigData([]byte(`
+models:
+  dall-e-2:
+    images:
+      standard: {256x256: 0.016, 1024x1024: 0.02}
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if got := cfg.Models["dall-e-2"].Images["standard"]["256x256"]; got != 0.016 {
+		t.Errorf("unexpected image price %v", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	cfg.Models["dall-e-2"].Images["standard"]["512x512"] = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected negative image price to be rejected")
+	}
+
+	// The embedded table prices dall-e-3 per image
+	ResetConfig()
+	defer ResetConfig()
+	if res, err := ComputeImagePriceMoney("dall-e-3", 1, "1024x1024", "standard"); err != nil || !almostEqual(res.TotalCost.ToUSD(), 0.04) {
+		t.Errorf("unexpected embedded dall-e-3 price: %+v, %v", res, err)
+	}
+}
+
+func TestParseImageUsage(t *testing.T) {
+	usage, ok := ParseImageUsage(map[string]interface{}{
+		"created": float64(1713833628),
+		"data":    []interface{}{map[string]interface{}{"b64_json": "..."}},
+		"usage": map[string]interface{}{
+			"input_tokens":  float64(50),
+			"output_tokens": float64(4160),
+			"total_tokens":  float64(4210),
+			"input_tokens_details": map[string]interface{}{
+				"text_tokens":  float64(10),
+				"image_tokens": float64(40),
+			},
+		},
+	})
+	expected := Usage{PromptTokens: 50, PromptImageTokens: 40, CompletionTokens: 4160, CompletionImageTokens: 4160}
+	if !ok || usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+
+	// dall-e responses have no usage
+	if _, ok := ParseImageUsage(map[string]interface{}{"data": []interface{}{}}); ok {
+		t.Error("expected no usage")
+	}
+}
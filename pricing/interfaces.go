@@ -7,6 +7,15 @@ type LimitManager interface {
 	// Allow checks whether the given key is currently allowed to spend more
 	Allow(key string) (allowed bool, windowEnd time.Time, spentSoFar Money, limit Money)
 
+	// AllowBudget checks the hourly limit and calendar budgets, reporting the budget that tripped
+	AllowBudget(key string) (allowed bool, status BudgetStatus)
+
+	// Reserve checks the key like AllowBudget and holds estimate against it while a request is in flight
+	Reserve(key string, estimate Money) (reservation *Reservation, allowed bool, status BudgetStatus)
+
+	// ReserveWithin is Reserve that also rejects requests whose worst-case cost exceeds the key's remaining budget
+	ReserveWithin(key string, estimate, maxCost Money) (reservation *Reservation, allowed bool, status BudgetStatus)
+
 	// AddCost adds the provided spend to a key's current window
 	AddCost(key string, delta Money)
 
@@ -24,11 +33,74 @@ type LimitManager interface {
 
 	// UpdateLimitFromUSD updates the spending limit from USD
 	UpdateLimitFromUSD(newLimitUSD float64)
+
+	// DefaultLimit returns the global spending limit applied to keys without an override
+	DefaultLimit() Money
+
+	// SetKeyLimit overrides the spending limit for a single key
+	SetKeyLimit(key string, limit Money)
+
+	// ClearKeyLimit removes a key's override so the global limit applies again
+	ClearKeyLimit(key string)
+
+	// GetKeyLimit returns the override for a key, if one is set
+	GetKeyLimit(key string) (Money, bool)
+}
+
+// VirtualKeyStore manages API keys issued by goxy
+type VirtualKeyStore interface {
+	// CreateVirtualKey issues a new key; the returned token is the only time the plain key is available
+	CreateVirtualKey(name string, allowedModels []string, expiresAt *time.Time) (token string, key VirtualKey, err error)
+
+	// ListVirtualKeys returns every issued key, including revoked and expired ones
+	ListVirtualKeys() []VirtualKey
+
+	// RevokeVirtualKey revokes a key by ID; it stops working immediately
+	RevokeVirtualKey(id string) (VirtualKey, error)
+
+	// LookupVirtualKey finds the key matching a presented token
+	LookupVirtualKey(token string) (VirtualKey, bool)
+}
+
+// SpendLedger keeps an append-only history of priced requests
+type SpendLedger interface {
+	// RecordSpend appends a priced request to the ledger
+	RecordSpend(entry LedgerEntry) error
+
+	// UsageHistory aggregates ledger entries matching the query
+	UsageHistory(q HistoryQuery) ([]HistoryBucket, error)
+}
+
+// BatchStore tracks batch jobs created through the proxy until their output is charged
+type BatchStore interface {
+	// RecordBatchFile remembers the estimated cost of an uploaded batch input file
+	RecordBatchFile(file BatchFile) error
+
+	// RecordBatch tracks a newly created batch, taking its estimate from the input file
+	RecordBatch(batch Batch) (Batch, error)
+
+	// UpdateBatch records the status and output file reported for a tracked batch; unknown batches are ignored
+	UpdateBatch(id, status, outputFileID string) error
+
+	// ListBatches returns tracked batches, newest first; pendingOnly leaves out charged batches
+	ListBatches(pendingOnly bool) []Batch
+
+	// BatchForOutputFile finds the batch whose output is the given file
+	BatchForOutputFile(fileID string) (Batch, bool)
+
+	// MarkBatchCharged records what a batch cost; false when it was already charged
+	MarkBatchCharged(id string, cost Money) (bool, error)
 }
 
 // PersistentLimitManager extends LimitManager with persistence-specific functionality
 type PersistentLimitManager interface {
 	LimitManager
+	VirtualKeyStore
+	SpendLedger
+	BatchStore
+
+	// UpdateLimitBy updates and persists the global limit, recording who changed it
+	UpdateLimitBy(newLimit Money, updatedBy string) error
 
 	// AddCostWithMaskedKey adds cost with both hashed key (for tracking) and masked key (for display)
 	AddCostWithMaskedKey(key string, maskedKey string, delta Money)
@@ -36,6 +108,10 @@ type PersistentLimitManager interface {
 	// GetAllUsageWithMaskedKeys returns usage information with original masked keys from database
 	GetAllUsageWithMaskedKeys() []UsageInfoMoney
 
+	// ResolveKey maps a masked key (as shown by GetAllUsageWithMaskedKeys) or a key hash
+	// to the hashed key used for tracking, along with its masked form when known
+	ResolveKey(ident string) (key string, maskedKey string, err error)
+
 	// Close shuts down the persistent manager gracefully
 	Close() error
 }
@@ -0,0 +1,77 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+)
+
+// LedgerEntry records a single priced request
+type LedgerEntry struct {
+	Timestamp          time.Time `json:"timestamp"`
+	Key                string    `json:"key"` // hashed key
+	Model              string    `json:"model"`
+	ServiceTier        string    `json:"service_tier"`
+	PromptTokens       int       `json:"prompt_tokens"`
+	CachedPromptTokens int       `json:"cached_prompt_tokens"`
+	CompletionTokens   int       `json:"completion_tokens"`
+	Cost               Money     `json:"cost"`
+}
+
+// NewLedgerEntry builds the ledger entry for a priced request made by key
+func NewLedgerEntry(key string, usage Usage, pr PriceResultMoney) LedgerEntry {
+	cached := usage.PromptCachedTokens
+	if cached > usage.PromptTokens {
+		cached = usage.PromptTokens
+	}
+	return LedgerEntry{
+		Timestamp:          time.Now(),
+		Key:                key,
+		Model:              string(pr.Model),
+		ServiceTier:        pr.ServiceTier,
+		PromptTokens:       usage.PromptTokens,
+		CachedPromptTokens: cached,
+		CompletionTokens:   usage.CompletionTokens,
+		Cost:               pr.TotalCost,
+	}
+}
+
+// HistoryGroup selects how ledger entries are aggregated
+type HistoryGroup string
+
+const (
+	GroupByHour  HistoryGroup = "hour" // UTC hours
+	GroupByDay   HistoryGroup = "day"  // UTC days
+	GroupByModel HistoryGroup = "model"
+)
+
+// ParseHistoryGroup validates a grouping name, defaulting to GroupByDay
+func ParseHistoryGroup(s string) (HistoryGroup, error) {
+	switch g := HistoryGroup(s); g {
+	case "":
+		return GroupByDay, nil
+	case GroupByHour, GroupByDay, GroupByModel:
+		return g, nil
+	default:
+		return "", fmt.Errorf("invalid group_by %q (expected hour, day or model)", s)
+	}
+}
+
+// HistoryQuery filters ledger entries. Empty fields match everything; To is exclusive.
+type HistoryQuery struct {
+	Key     string
+	Model   string
+	From    time.Time
+	To      time.Time
+	GroupBy HistoryGroup
+}
+
+// HistoryBucket aggregates ledger entries for one hour, day or model
+type HistoryBucket struct {
+	Bucket             string  `json:"bucket"` // window start (RFC 3339) or model name
+	Requests           int     `json:"requests"`
+	PromptTokens       int     `json:"prompt_tokens"`
+	CachedPromptTokens int     `json:"cached_prompt_tokens"`
+	CompletionTokens   int     `json:"completion_tokens"`
+	Cost               Money   `json:"cost"`
+	CostUSD            float64 `json:"cost_usd"`
+}
@@ -13,15 +13,25 @@ import (
 //	limit < 0  => limiter disabled (all allowed, nothing tracked)
 //	limit == 0 => zero allowance (every non-anonymous key immediately blocked)
 //	limit > 0  => spend allowed until accumulated >= limit
+//
+// Individual keys may override the global limit (see SetKeyLimit); the same semantics apply.
+// Calendar budgets (see SetBudgets) are checked together with the hourly limit.
 type ManagerMoney struct {
-	limit  Money    // Money per hour (negative disables)
-	perKey sync.Map // map[string]*keyWindowMoney
+	limit     Money    // Money per hour (negative disables)
+	perKey    sync.Map // map[string]*keyWindowMoney
+	overrides sync.Map // map[string]Money, per-key limits replacing the global one
+
+	budgetMu sync.RWMutex
+	budgets  []Budget       // day/week/month budgets applied to every key
+	location *time.Location // timezone the budget windows are aligned in
 }
 
 type keyWindowMoney struct {
 	mu          sync.Mutex
 	windowStart time.Time
 	spent       Money
+	reserved    Money                          // held by in-flight requests (see Reserve), counted in every window
+	periods     map[BudgetPeriod]*periodWindow // calendar budget windows
 }
 
 // NewManagerMoney creates a spend limit manager with the given per-hour limit (Money).
@@ -47,17 +57,35 @@ func NewLimitManager(limitUSD float64) *ManagerMoney {
 }
 
 // Allow checks whether the given key is currently allowed to spend more using Money precision.
-// It returns allowed, windowEnd, spentSoFar, limit.
+// It returns allowed, windowEnd, spentSoFar, limit. When a calendar budget is exhausted, the
+// values describe that budget; use AllowBudget to also learn which budget tripped.
 func (m *ManagerMoney) Allow(key string) (bool, time.Time, Money, Money) {
-	lim := m.limit
+	allowed, status := m.AllowBudget(key)
+	return allowed, status.WindowEnd, status.Spent, status.Limit
+}
+
+// AllowBudget checks the hourly limit and every calendar budget for the key.
+// The returned status describes the first budget that is exhausted, or the hourly window when allowed.
+// Spend reserved by in-flight requests counts as spent.
+func (m *ManagerMoney) AllowBudget(key string) (bool, BudgetStatus) {
+	allowed, status, _ := m.admit(key, 0, 0)
+	return allowed, status
+}
+
+// admit implements AllowBudget. When need is positive, the key must also have at least need left in
+// every window. When the key is allowed and hold is positive, hold is added to the key's reservations
+// under the same lock and the key's window is returned (nil when untracked).
+func (m *ManagerMoney) admit(key string, hold, need Money) (bool, BudgetStatus, *keyWindowMoney) {
+	lim := m.limitFor(key)
+	budgets, loc := m.Budgets()
 	if key == "" { // anonymous bypasses but not tracked
-		return true, time.Time{}, Money(0), lim
+		return true, BudgetStatus{Period: PeriodHour, Limit: lim, Allowed: true}, nil
 	}
-	if lim.IsNegative() { // disabled limiter
-		return true, time.Time{}, Money(0), lim
+	if lim.IsNegative() && len(budgets) == 0 { // disabled limiter
+		return true, BudgetStatus{Period: PeriodHour, Limit: lim, Allowed: true}, nil
 	}
 	if lim.IsZero() { // immediate block for any spend
-		return false, time.Now().Add(time.Hour), Money(0), lim
+		return false, BudgetStatus{Period: PeriodHour, Limit: lim, WindowEnd: time.Now().Add(time.Hour)}, nil
 	}
 	kw := m.getKWMoney(key)
 	kw.mu.Lock()
@@ -67,16 +95,50 @@ func (m *ManagerMoney) Allow(key string) (bool, time.Time, Money, Money) {
 		kw.windowStart = now
 		kw.spent = Money(0)
 	}
-	windowEnd := kw.windowStart.Add(time.Hour)
-	return kw.spent.LessThan(lim), windowEnd, kw.spent, lim
+	hourly := BudgetStatus{
+		Period:      PeriodHour,
+		Spent:       kw.spent,
+		Reserved:    kw.reserved,
+		Limit:       lim,
+		WindowStart: kw.windowStart,
+		WindowEnd:   kw.windowStart.Add(time.Hour),
+		Allowed:     lim.IsNegative() || kw.spent.Add(kw.reserved).LessThan(lim),
+	}
+	if lim.IsNegative() { // hourly limit disabled; report it like the disabled limiter does
+		hourly.Spent, hourly.WindowEnd = Money(0), time.Time{}
+	}
+	if !hourly.Allowed {
+		return false, hourly, nil
+	}
+
+	statuses := kw.budgetStatusesLocked(budgets, now, loc)
+	for _, status := range statuses {
+		if !status.Allowed {
+			return false, status, nil
+		}
+	}
+	if need.GreaterThan(0) {
+		for _, status := range append([]BudgetStatus{hourly}, statuses...) {
+			if !status.Limit.IsNegative() && status.Spent.Add(status.Reserved).Add(need).GreaterThan(status.Limit) {
+				status.Allowed = false
+				return false, status, nil
+			}
+		}
+	}
+	if hold.IsNegative() || hold.IsZero() {
+		return true, hourly, nil
+	}
+	kw.reserved = kw.reserved.Add(hold)
+	return true, hourly, kw
 }
 
-// AddCost adds the provided Money spend to a key's current window.
+// AddCost adds the provided Money spend to a key's current window (and calendar budget windows).
 func (m *ManagerMoney) AddCost(key string, delta Money) {
 	if delta.IsZero() || delta.IsNegative() || key == "" {
 		return
 	}
-	if m.limit.IsNegative() {
+	budgets, loc := m.Budgets()
+	if m.limitFor(key).IsNegative() && len(budgets) == 0 {
 		return
 	} // disabled
 
@@ -88,6 +150,10 @@ func (m *ManagerMoney) AddCost(key string, delta Money) {
 		kw.spent = Money(0)
 	}
 	kw.spent = kw.spent.Add(delta)
+	for _, b := range budgets {
+		w := kw.period(b.Period, now, loc)
+		w.spent = w.spent.Add(delta)
+	}
 	kw.mu.Unlock()
 }
 
@@ -117,11 +183,34 @@ type UsageInfoMoney struct {
 	WindowEnd   time.Time `json:"window_end"`
 	Remaining   Money     `json:"remaining"`
 	Allowed     bool      `json:"allowed"`
+	// Reserved is the estimated cost of the key's in-flight requests (see Reserve)
+	Reserved Money `json:"reserved,omitempty"`
+	// Budgets holds the calendar budget windows, when configured
+	Budgets []BudgetStatus `json:"budgets,omitempty"`
 }
 
 // GetUsage returns usage information for a specific key using Money precision
 func (m *ManagerMoney) GetUsage(key string) UsageInfoMoney {
-	lim := m.limit
+	return m.withBudgets(m.getHourlyUsage(key))
+}
+
+// withBudgets adds the calendar budget windows to a key's usage; an exhausted budget blocks the key
+func (m *ManagerMoney) withBudgets(usage UsageInfoMoney) UsageInfoMoney {
+	if usage.Key == "anonymous" {
+		return usage
+	}
+	usage.Budgets = m.budgetStatuses(usage.Key)
+	for _, status := range usage.Budgets {
+		if !status.Allowed {
+			usage.Allowed = false
+		}
+	}
+	return usage
+}
+
+// getHourlyUsage returns usage information for the key's hourly window
+func (m *ManagerMoney) getHourlyUsage(key string) UsageInfoMoney {
+	lim := m.limitFor(key)
 	now := time.Now()
 
 	if key == "" {
@@ -173,7 +262,7 @@ func (m *ManagerMoney) GetUsage(key string) UsageInfoMoney {
 		kw.spent = Money(0)
 	}
 	windowEnd := kw.windowStart.Add(time.Hour)
-	spent := kw.spent
+	spent, reserved := kw.spent, kw.reserved
 	kw.mu.Unlock()
 
 	remaining := Money(0)
@@ -189,6 +278,7 @@ func (m *ManagerMoney) GetUsage(key string) UsageInfoMoney {
 		WindowEnd:   windowEnd,
 		Remaining:   remaining,
 		Allowed:     spent.LessThan(lim),
+		Reserved:    reserved,
 	}
 }
 
@@ -200,6 +290,7 @@ func (m *ManagerMoney) GetAllUsage() []UsageInfoMoney {
 	m.perKey.Range(func(key, value interface{}) bool {
 		keyStr := key.(string)
 		kw := value.(*keyWindowMoney)
+		lim := m.limitFor(keyStr)
 
 		kw.mu.Lock()
 		if now.Sub(kw.windowStart) >= time.Hour {
@@ -207,23 +298,24 @@ func (m *ManagerMoney) GetAllUsage() []UsageInfoMoney {
 			kw.spent = Money(0)
 		}
 		windowEnd := kw.windowStart.Add(time.Hour)
-		spent := kw.spent
+		spent, reserved := kw.spent, kw.reserved
 		kw.mu.Unlock()
 
 		remaining := Money(0)
-		if m.limit.GreaterThan(spent) {
-			remaining = Money(int64(m.limit) - int64(spent))
+		if lim.GreaterThan(spent) {
+			remaining = Money(int64(lim) - int64(spent))
 		}
 
-		usage = append(usage, UsageInfoMoney{
+		usage = append(usage, m.withBudgets(UsageInfoMoney{
 			Key:         keyStr,
 			Spent:       spent,
-			Limit:       m.limit,
+			Limit:       lim,
 			WindowStart: kw.windowStart,
 			WindowEnd:   windowEnd,
 			Remaining:   remaining,
-			Allowed:     m.limit.IsNegative() || spent.LessThan(m.limit),
-		})
+			Allowed:     lim.IsNegative() || spent.LessThan(lim),
+			Reserved:    reserved,
+		}))
 		return true
 	})
 
@@ -243,3 +335,34 @@ func (m *ManagerMoney) UpdateLimitFromUSD(newLimitUSD float64) {
 		m.limit = NewMoneyFromUSD(newLimitUSD)
 	}
 }
+
+// DefaultLimit returns the global spending limit applied to keys without an override
+func (m *ManagerMoney) DefaultLimit() Money {
+	return m.limit
+}
+
+// SetKeyLimit overrides the spending limit for a single key (same semantics as the global limit)
+func (m *ManagerMoney) SetKeyLimit(key string, limit Money) {
+	m.overrides.Store(key, limit)
+}
+
+// ClearKeyLimit removes a key's override so the global limit applies again
+func (m *ManagerMoney) ClearKeyLimit(key string) {
+	m.overrides.Delete(key)
+}
+
+// GetKeyLimit returns the override for a key, if one is set
+func (m *ManagerMoney) GetKeyLimit(key string) (Money, bool) {
+	if v, ok := m.overrides.Load(key); ok {
+		return v.(Money), true
+	}
+	return Money(0), false
+}
+
+// limitFor returns the effective limit for a key: its override, or the global limit
+func (m *ManagerMoney) limitFor(key string) Money {
+	if lim, ok := m.GetKeyLimit(key); ok {
+		return lim
+	}
+	return m.limit
+}
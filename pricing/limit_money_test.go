@@ -189,3 +189,62 @@ func abs(x float64) float64 {
 	}
 	return x
 }
+
+func TestManagerMoney_PerKeyLimitOverrides(t *testing.T) {
+	mgr := NewManagerMoneyFromUSD(1.0) // $1 global limit
+
+	batchKey := "batch-key"
+	devKey := "dev-key"
+	mgr.SetKeyLimit(batchKey, NewMoneyFromUSD(50.0))
+
+	// $5 spend blocks the default key but not the overridden one
+	mgr.AddCost(batchKey, NewMoneyFromUSD(5.0))
+	mgr.AddCost(devKey, NewMoneyFromUSD(5.0))
+
+	allowed, _, _, lim := mgr.Allow(batchKey)
+	if !allowed || lim != NewMoneyFromUSD(50.0) {
+		t.Errorf("batch key should be allowed under its $50 override, allowed=%v limit=%s", allowed, lim)
+	}
+	allowed, _, _, lim = mgr.Allow(devKey)
+	if allowed || lim != NewMoneyFromUSD(1.0) {
+		t.Errorf("dev key should be blocked by the $1 global limit, allowed=%v limit=%s", allowed, lim)
+	}
+
+	// Usage reports the effective limit per key
+	for _, usage := range mgr.GetAllUsage() {
+		want := mgr.DefaultLimit()
+		if usage.Key == batchKey {
+			want = NewMoneyFromUSD(50.0)
+		}
+		if usage.Limit != want {
+			t.Errorf("key %s: expected limit %s, got %s", usage.Key, want, usage.Limit)
+		}
+	}
+
+	// Clearing the override falls back to the global limit
+	mgr.ClearKeyLimit(batchKey)
+	if _, ok := mgr.GetKeyLimit(batchKey); ok {
+		t.Error("override should be cleared")
+	}
+	if allowed, _, _, _ := mgr.Allow(batchKey); allowed {
+		t.Error("batch key should be blocked by the global limit once its override is cleared")
+	}
+}
+
+func TestManagerMoney_PerKeyOverrideWithDisabledGlobalLimit(t *testing.T) {
+	mgr := NewManagerMoneyFromUSD(-1) // globally disabled
+	key := "capped-key"
+	mgr.SetKeyLimit(key, NewMoneyFromUSD(1.0))
+
+	// Spend is tracked for the capped key even though limiting is globally disabled
+	mgr.AddCost(key, NewMoneyFromUSD(2.0))
+	if allowed, _, spent, _ := mgr.Allow(key); allowed || spent != NewMoneyFromUSD(2.0) {
+		t.Errorf("capped key should be blocked, allowed=%v spent=%s", allowed, spent)
+	}
+
+	// Other keys stay unlimited
+	mgr.AddCost("other-key", NewMoneyFromUSD(2.0))
+	if allowed, _, spent, _ := mgr.Allow("other-key"); !allowed || !spent.IsZero() {
+		t.Errorf("other key should be untracked and allowed, allowed=%v spent=%s", allowed, spent)
+	}
+}
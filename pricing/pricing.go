@@ -12,8 +12,39 @@ type Usage struct {
 	// (i.e. they cost 10% of a normal prompt token). If this exceeds PromptTokens it will
 	// be clamped to PromptTokens.
 	PromptCachedTokens int `json:"cached_prompt_tokens"`
-	CompletionTokens   int `json:"completion_tokens"`
-	TotalTokens        int `json:"total_tokens"`
+	// PromptCacheWriteTokens are prompt tokens written to cache (Anthropic cache_creation_input_tokens),
+	// billed at the model's cache write rate
+	PromptCacheWriteTokens int `json:"cache_write_prompt_tokens,omitempty"`
+	CompletionTokens       int `json:"completion_tokens"`
+	TotalTokens            int `json:"total_tokens"`
+
+	// Token classes billed at their own rates. They are part of PromptTokens / CompletionTokens,
+	// not in addition to them. Prompt audio and image tokens exclude those served from cache,
+	// which are billed as cached prompt tokens.
+	PromptAudioTokens     int `json:"prompt_audio_tokens,omitempty"`
+	PromptImageTokens     int `json:"prompt_image_tokens,omitempty"`
+	CompletionAudioTokens int `json:"completion_audio_tokens,omitempty"`
+	CompletionImageTokens int `json:"completion_image_tokens,omitempty"`
+	// ReasoningTokens are billed as completion tokens; they are broken out for reporting
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
+// CostBreakdown splits a price by token class. The prompt classes add up to PromptCost and
+// the completion classes to CompletionCost.
+type CostBreakdown struct {
+	TextPrompt      Money `json:"text_prompt"`
+	CachedPrompt    Money `json:"cached_prompt"`
+	CacheWrite      Money `json:"cache_write_prompt"`
+	AudioPrompt     Money `json:"audio_prompt"`
+	ImagePrompt     Money `json:"image_prompt"`
+	TextCompletion  Money `json:"text_completion"` // excluding reasoning
+	Reasoning       Money `json:"reasoning"`
+	AudioCompletion Money `json:"audio_completion"`
+	ImageCompletion Money `json:"image_completion"`
+	Images          Money `json:"images"`           // priced per image, see ComputeImagePriceMoney
+	AudioDuration   Money `json:"audio_duration"`   // priced per minute, see ComputeAudioPriceMoney
+	InputCharacters Money `json:"input_characters"` // priced per character, see ComputeAudioPriceMoney
+	Tools           Money `json:"tools"`            // hosted tool call fees, see AddToolCosts
 }
 
 // PriceResultMoney holds the computed pricing info using Money type for precision.
@@ -25,65 +56,59 @@ type PriceResultMoney struct {
 	PromptCost       Money
 	CompletionCost   Money
 	TotalCost        Money
+	Breakdown        CostBreakdown
 	Note             string
 }
 
-// resolveModelName determines the canonical model name to use for pricing lookup.
-// This first checks if the model exists directly in config, then tries to find the longest matching prefix.
-// If found via prefix match, returns the canonical name; otherwise returns the original name.
-func resolveModelName(raw string) string {
-	cfg, err := GetConfig()
-	if err != nil {
+// resolveModelName determines the canonical model name to use for pricing lookup: the models entry
+// the name resolves to (exact, alias, dated snapshot or prefix match), or the original name when
+// none matches. Fine-tuned model names are kept as-is: the lookups resolve them again.
+func resolveModelName(cfg *PricingConfig, raw string) string {
+	if cfg == nil {
 		return raw // fallback to original name if config can't be loaded
 	}
 
-	// Try direct lookup first
-	if _, exists := cfg.Models[raw]; exists {
-		fmt.Printf("[pricing] Model mapping: %q -> %q (exact match)\n", raw, raw)
+	res := cfg.index().resolve(raw)
+	switch res.Match {
+	case MatchNone:
+		// Not found in config, return as-is
+		return raw
+	case MatchFineTune, MatchFineTuned:
+		fmt.Printf("[pricing] Model mapping: %q -> %q (%s)\n", raw, res.Resolved, res.Match)
 		return raw
 	}
-
-	// Check for prefix matches - find the longest matching prefix
-	var bestMatch string
-
-	for configModel := range cfg.Models {
-		// Check if the input model name starts with this config model name
-		if len(configModel) > len(bestMatch) && len(raw) >= len(configModel) &&
-			raw[:len(configModel)] == configModel {
-			bestMatch = configModel
-		}
-	}
-
-	if bestMatch != "" {
-		fmt.Printf("[pricing] Model mapping: %q -> %q (prefix match)\n", raw, bestMatch)
-		return bestMatch
-	}
-
-	// Not found in config or via prefix, return as-is
-	return raw
+	fmt.Printf("[pricing] Model mapping: %q -> %q (%s match)\n", raw, res.Resolved, res.Match)
+	return res.Resolved
 }
 
-// getPricingMoney returns the Money-based pricing for a given model and service tier from configuration
-func getPricingMoney(model Model, serviceTier string) (prompt, cachedPrompt, completion Money, actualTier string, err error) {
-	cfg, configErr := GetConfig()
+// getPricingMoney returns the Money-based pricing for a given model and service tier from configuration,
+// and the model's audio/image rates (which don't vary by tier). Standard tier prompts longer than a
+// context tier's threshold get that tier's rates.
+func getPricingMoney(cfg *PricingConfig, configErr error, model Model, serviceTier string, promptTokens int) (prompt, cachedPrompt, completion Money, modality ModalityPricingMoney, actualTier string, contextTier *ContextTierPricingMoney, err error) {
 	if configErr != nil {
-		return Money(0), Money(0), Money(0), "standard", fmt.Errorf("failed to load pricing config: %w", configErr)
+		return Money(0), Money(0), Money(0), modality, "standard", nil, fmt.Errorf("failed to load pricing config: %w", configErr)
 	}
 
 	cfgMoney := cfg.ToMoney()
 	pricing, found := cfgMoney.FindModelPricingMoney(string(model))
-	if found {
-		prompt, cachedPrompt, completion, actualTier := pricing.GetTierPricingMoney(serviceTier)
-		return prompt, cachedPrompt, completion, actualTier, nil
+	if !found {
+		// Fallback to default if configured
+		if cfgMoney.Default == nil {
+			return Money(0), Money(0), Money(0), modality, "standard", nil, fmt.Errorf("no pricing found for model %s", model)
+		}
+		pricing = cfgMoney.Default
 	}
 
-	// Fallback to default if configured
-	if cfgMoney.Default != nil {
-		prompt, cachedPrompt, completion, _ := cfgMoney.Default.GetTierPricingMoney(serviceTier)
-		return prompt, cachedPrompt, completion, "standard", nil
+	prompt, cachedPrompt, completion, actualTier = pricing.GetTierPricingMoney(serviceTier)
+	if actualTier == "standard" {
+		if ct := pricing.ContextTier(promptTokens); ct != nil {
+			prompt, cachedPrompt, completion, contextTier = ct.Prompt, ct.CachedPrompt, ct.Completion, ct
+		}
 	}
-
-	return Money(0), Money(0), Money(0), "standard", fmt.Errorf("no pricing found for model %s", model)
+	if !found {
+		actualTier = "standard"
+	}
+	return prompt, cachedPrompt, completion, pricing.ModalityPricingMoney, actualTier, contextTier, nil
 }
 
 // ComputePriceMoney calculates cost given usage and model (using standard pricing) with Money precision.
@@ -104,9 +129,11 @@ func CalculatePriceWithTier(modelRaw string, u Usage, serviceTier string) (Price
 
 // ComputePriceMoneyWithTier calculates cost given usage, model, and service tier using Money precision.
 func ComputePriceMoneyWithTier(modelRaw string, u Usage, serviceTier string) (PriceResultMoney, error) {
-	modelName := resolveModelName(modelRaw)
+	// Read the configuration once so a concurrent reload can't mix two tables in one price
+	cfg, configErr := GetConfig()
+	modelName := resolveModelName(cfg, modelRaw)
 	m := Model(modelName)
-	promptPrice, cachedPromptPrice, completionPrice, actualTier, err := getPricingMoney(m, serviceTier)
+	promptPrice, cachedPromptPrice, completionPrice, modality, actualTier, contextTier, err := getPricingMoney(cfg, configErr, m, serviceTier, u.PromptTokens)
 	if err != nil {
 		return PriceResultMoney{
 			Model:            m,
@@ -122,34 +149,47 @@ func ComputePriceMoneyWithTier(modelRaw string, u Usage, serviceTier string) (Pr
 		fmt.Printf("[pricing] Service tier fallback: %q -> %q for model %q\n", serviceTier, actualTier, modelName)
 	}
 
-	// Calculate prompt cost: split between cached and non-cached tokens
-	var ptCost Money
-	if u.PromptCachedTokens > 0 {
-		cached := u.PromptCachedTokens
-		if cached > u.PromptTokens {
-			cached = u.PromptTokens
-		}
-		nonCachedTokens := u.PromptTokens - cached
-
-		// Use precise Money arithmetic
-		nonCachedCost := promptPrice.Multiply(int64(nonCachedTokens))
-		cachedCost := cachedPromptPrice.Multiply(int64(cached))
-		ptCost = nonCachedCost.Add(cachedCost)
-	} else {
-		// All prompt tokens are regular (non-cached)
-		ptCost = promptPrice.Multiply(int64(u.PromptTokens))
-	}
-
-	ctCost := completionPrice.Multiply(int64(u.CompletionTokens))
+	// Calculate prompt cost: cached tokens, then cache writes, audio and image tokens at their own
+	// rates (the text rate when the model has none), the rest as text
+	var b CostBreakdown
+	cached := clampTokens(u.PromptCachedTokens, u.PromptTokens)
+	cacheWrite := clampTokens(u.PromptCacheWriteTokens, u.PromptTokens-cached)
+	audioIn := clampTokens(u.PromptAudioTokens, u.PromptTokens-cached-cacheWrite)
+	imageIn := clampTokens(u.PromptImageTokens, u.PromptTokens-cached-cacheWrite-audioIn)
+	b.CachedPrompt = cachedPromptPrice.Multiply(int64(cached))
+	b.CacheWrite = orRate(modality.CacheWritePrompt, promptPrice).Multiply(int64(cacheWrite))
+	b.AudioPrompt = orRate(modality.AudioPrompt, promptPrice).Multiply(int64(audioIn))
+	b.ImagePrompt = orRate(modality.ImagePrompt, promptPrice).Multiply(int64(imageIn))
+	b.TextPrompt = promptPrice.Multiply(int64(u.PromptTokens - cached - cacheWrite - audioIn - imageIn))
+	ptCost := b.TextPrompt.Add(b.CachedPrompt).Add(b.CacheWrite).Add(b.AudioPrompt).Add(b.ImagePrompt)
+
+	// Completion cost: audio and image output at their own rates, reasoning and text at the completion rate
+	audioOut := clampTokens(u.CompletionAudioTokens, u.CompletionTokens)
+	imageOut := clampTokens(u.CompletionImageTokens, u.CompletionTokens-audioOut)
+	reasoning := clampTokens(u.ReasoningTokens, u.CompletionTokens-audioOut-imageOut)
+	b.AudioCompletion = orRate(modality.AudioCompletion, completionPrice).Multiply(int64(audioOut))
+	b.ImageCompletion = orRate(modality.ImageCompletion, completionPrice).Multiply(int64(imageOut))
+	b.Reasoning = completionPrice.Multiply(int64(reasoning))
+	b.TextCompletion = completionPrice.Multiply(int64(u.CompletionTokens - audioOut - imageOut - reasoning))
+	ctCost := b.TextCompletion.Add(b.Reasoning).Add(b.AudioCompletion).Add(b.ImageCompletion)
 	total := ptCost.Add(ctCost)
 
 	note := "prices loaded from config; verify against https://openai.com/api/pricing/"
 	if actualTier != "standard" {
 		note += fmt.Sprintf(" (using %s tier pricing)", actualTier)
 	}
+	if contextTier != nil {
+		note += fmt.Sprintf(" (using long context pricing above %d prompt tokens)", contextTier.AbovePromptTokens)
+	}
 	if u.PromptCachedTokens > 0 {
 		note += " (includes cached prompt token pricing)"
 	}
+	if cacheWrite > 0 {
+		note += " (includes cache write pricing)"
+	}
+	if audioIn+imageIn+audioOut+imageOut > 0 {
+		note += " (includes audio/image token pricing)"
+	}
 
 	return PriceResultMoney{
 		Model:            m,
@@ -159,10 +199,30 @@ func ComputePriceMoneyWithTier(modelRaw string, u Usage, serviceTier string) (Pr
 		PromptCost:       ptCost,
 		CompletionCost:   ctCost,
 		TotalCost:        total,
+		Breakdown:        b,
 		Note:             note,
 	}, nil
 }
 
+// clampTokens limits a token class to what is left of its total (and to zero)
+func clampTokens(n, left int) int {
+	if n > left {
+		n = left
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// orRate returns rate, or fallback when the model has no rate for that token class
+func orRate(rate, fallback Money) Money {
+	if rate.IsZero() {
+		return fallback
+	}
+	return rate
+}
+
 func (pr PriceResultMoney) String() string {
 	return fmt.Sprintf("[pricing] model=%s tier=%s prompt=%d completion=%d cost_prompt=%s cost_completion=%s total=%s",
 		pr.Model, pr.ServiceTier, pr.PromptTokens, pr.CompletionTokens,
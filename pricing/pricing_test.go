@@ -95,6 +95,83 @@ func TestComputePrice_WithCachedPromptTokens(t *testing.T) {
 	}
 }
 
+func TestComputePrice_WithCacheWriteTokens(t *testing.T) {
+	SetConfig(&PricingConfig{Models: map[string]ModelPricing{
+		"claude-sonnet-4-5": {Prompt: 3.0, CachedPrompt: 0.3, Completion: 15.0, ModalityPricing: ModalityPricing{CacheWritePrompt: 3.75}},
+		"no-write-rate":     {Prompt: 3.0, CachedPrompt: 0.3, Completion: 15.0},
+	}})
+	defer ResetConfig()
+
+	// 1000 prompt tokens: 200 read from cache, 500 written to it, 300 uncached
+	usage := Usage{PromptTokens: 1000, PromptCachedTokens: 200, PromptCacheWriteTokens: 500, CompletionTokens: 100}
+	res, err := ComputePriceMoney("claude-sonnet-4-5-20250929", usage)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Model != Model("claude-sonnet-4-5") {
+		t.Fatalf("expected dated snapshot to resolve to claude-sonnet-4-5, got %s", res.Model)
+	}
+	wantPrompt := (300*3.0 + 200*0.3 + 500*3.75) / 1e6
+	if !almostEqual(res.PromptCost.ToUSD(), wantPrompt) {
+		t.Fatalf("prompt cost mismatch: got %f want %f", res.PromptCost.ToUSD(), wantPrompt)
+	}
+	if !almostEqual(res.Breakdown.CacheWrite.ToUSD(), 500*3.75/1e6) {
+		t.Errorf("cache write breakdown mismatch: got %f", res.Breakdown.CacheWrite.ToUSD())
+	}
+	if !strings.Contains(res.Note, "cache write") {
+		t.Errorf("expected note to mention cache write pricing, got %q", res.Note)
+	}
+
+	// Without a cache write rate, writes cost the prompt rate
+	res, err = ComputePriceMoney("no-write-rate", usage)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (800*3.0 + 200*0.3) / 1e6; !almostEqual(res.PromptCost.ToUSD(), want) {
+		t.Errorf("prompt cost mismatch without write rate: got %f want %f", res.PromptCost.ToUSD(), want)
+	}
+}
+
+func TestComputePrice_ContextTiers(t *testing.T) {
+	SetConfig(&PricingConfig{Models: map[string]ModelPricing{
+		"gemini-2.5-pro": {
+			Prompt: 1.25, CachedPrompt: 0.125, Completion: 10,
+			Batch: &TierPricing{Prompt: 0.625, Completion: 5},
+			ContextTiers: []ContextTierPricing{
+				{AbovePromptTokens: 200000, TierPricing: TierPricing{Prompt: 2.5, CachedPrompt: 0.25, Completion: 15}},
+			},
+		},
+	}})
+	defer ResetConfig()
+
+	tests := []struct {
+		name  string
+		usage Usage
+		tier  string
+		want  float64
+		long  bool
+	}{
+		{"at threshold", Usage{PromptTokens: 200000, CompletionTokens: 1000}, "standard", (200000*1.25 + 1000*10) / 1e6, false},
+		{"above threshold", Usage{PromptTokens: 200001, PromptCachedTokens: 100000, CompletionTokens: 1000}, "standard",
+			(100001*2.5 + 100000*0.25 + 1000*15) / 1e6, true},
+		{"other service tier", Usage{PromptTokens: 300000, CompletionTokens: 1000}, "batch", (300000*0.625 + 1000*5) / 1e6, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ComputePriceMoneyWithTier("gemini-2.5-pro", tt.usage, tt.tier)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !almostEqual(res.TotalCost.ToUSD(), tt.want) {
+				t.Errorf("total cost mismatch: got %f want %f", res.TotalCost.ToUSD(), tt.want)
+			}
+			if got := strings.Contains(res.Note, "long context"); got != tt.long {
+				t.Errorf("expected long context note %v, got %q", tt.long, res.Note)
+			}
+		})
+	}
+}
+
 func TestFloat64PrecisionWithCheapestModel(t *testing.T) {
 	// Load the actual pricing config to test with real prices
 	_, err := GetConfig()
@@ -270,8 +347,9 @@ func TestResolveModelNamePrefixMatching(t *testing.T) {
 		"unknown-model": "unknown-model", // should return as-is
 		"claude-3":      "claude-3",      // should return as-is
 	}
+	cfg, _ := GetConfig()
 	for raw, want := range cases {
-		got := resolveModelName(raw)
+		got := resolveModelName(cfg, raw)
 		if got != want {
 			t.Fatalf("resolveModelName(%q) -> %q want %q", raw, got, want)
 		}
@@ -391,8 +469,9 @@ func TestPrefixMatchingRealWorld(t *testing.T) {
 		{"o1-mini-2024-09-12", "o1-mini", 1.1}, // Should match o1-mini, not o1
 	}
 
+	cfg, _ := GetConfig()
 	for _, tc := range cases {
-		resolved := resolveModelName(tc.input)
+		resolved := resolveModelName(cfg, tc.input)
 		if resolved != tc.expected {
 			t.Fatalf("resolveModelName(%q) -> %q, want %q", tc.input, resolved, tc.expected)
 		}
@@ -441,6 +520,118 @@ func TestLoadConfigFromYAML(t *testing.T) {
 	}
 }
 
+func TestComputePrice_TokenClassBreakdown(t *testing.T) {
+	SetConfig(&PricingConfig{
+		Models: map[string]ModelPricing{
+			"gpt-realtime": {
+				Prompt: 4, CachedPrompt: 0.4, Completion: 16,
+				ModalityPricing: ModalityPricing{AudioPrompt: 32, AudioCompletion: 64, ImagePrompt: 5},
+			},
+		},
+	})
+	defer ResetConfig()
+
+	res, err := ComputePriceMoney("gpt-realtime", Usage{
+		PromptTokens: 1000, PromptCachedTokens: 100, PromptAudioTokens: 500, PromptImageTokens: 200,
+		CompletionTokens: 1000, CompletionAudioTokens: 600, CompletionImageTokens: 100, ReasoningTokens: 50,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b := res.Breakdown
+	checks := []struct {
+		name string
+		got  Money
+		want float64
+	}{
+		{"text prompt", b.TextPrompt, 200 * 4 / 1e6},
+		{"cached prompt", b.CachedPrompt, 100 * 0.4 / 1e6},
+		{"audio prompt", b.AudioPrompt, 500 * 32 / 1e6},
+		{"image prompt", b.ImagePrompt, 200 * 5 / 1e6},
+		{"text completion", b.TextCompletion, 250 * 16 / 1e6},
+		{"reasoning", b.Reasoning, 50 * 16 / 1e6},
+		{"audio completion", b.AudioCompletion, 600 * 64 / 1e6},
+		// no image output rate: billed as text completion
+		{"image completion", b.ImageCompletion, 100 * 16 / 1e6},
+	}
+	for _, c := range checks {
+		if !almostEqual(c.got.ToUSD(), c.want) {
+			t.Errorf("%s cost: got %f want %f", c.name, c.got.ToUSD(), c.want)
+		}
+	}
+	if res.PromptCost != b.TextPrompt.Add(b.CachedPrompt).Add(b.AudioPrompt).Add(b.ImagePrompt) {
+		t.Errorf("prompt classes don't add up to the prompt cost: %+v", res)
+	}
+	if res.TotalCost != res.PromptCost.Add(res.CompletionCost) ||
+		res.CompletionCost != b.TextCompletion.Add(b.Reasoning).Add(b.AudioCompletion).Add(b.ImageCompletion) {
+		t.Errorf("completion classes don't add up: %+v", res)
+	}
+
+	// Token classes larger than what is left of the total are clamped
+	res, _ = ComputePriceMoney("gpt-realtime", Usage{PromptTokens: 100, PromptCachedTokens: 60, PromptAudioTokens: 100})
+	if !almostEqual(res.Breakdown.AudioPrompt.ToUSD(), 40*32/1e6) || !res.Breakdown.TextPrompt.IsZero() {
+		t.Errorf("expected 40 audio tokens and no text, got %+v", res.Breakdown)
+	}
+}
+
+func TestLoadConfig_ModalityRates(t *testing.T) {
+	cfg, err := parseConfigData([]byte(`
+models:
+  gpt-audio:
+    prompt: 2.5
+    completion: 10.0
+    audio_prompt: 40.0
+    audio_completion: 80.0
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	mp := cfg.Models["gpt-audio"]
+	if mp.AudioPrompt != 40 || mp.AudioCompletion != 80 || mp.ImagePrompt != 0 {
+		t.Errorf("unexpected modality rates: %+v", mp)
+	}
+
+	mp.ImagePrompt = -1
+	if err := mp.validate(); err == nil {
+		t.Error("expected negative image rate to be rejected")
+	}
+
+	// The embedded table prices realtime audio
+	def, err := DefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt := def.Models["gpt-realtime"]; rt.AudioPrompt <= rt.Prompt || rt.AudioCompletion <= rt.Completion {
+		t.Errorf("expected audio rates for gpt-realtime, got %+v", rt)
+	}
+}
+
+func TestComputePrice_EmbeddingModels(t *testing.T) {
+	ResetConfig() // embedded table
+	defer ResetConfig()
+
+	cases := map[string]float64{
+		"text-embedding-3-small": 0.02,
+		"text-embedding-3-large": 0.13,
+		"text-embedding-ada-002": 0.10,
+	}
+	for model, perMillion := range cases {
+		res, err := ComputePriceMoney(model, Usage{PromptTokens: 1000, TotalTokens: 1000})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", model, err)
+		}
+		if string(res.Model) != model || !almostEqual(res.TotalCost.ToUSD(), 1000*perMillion/1e6) {
+			t.Errorf("%s: got model %s cost %f", model, res.Model, res.TotalCost.ToUSD())
+		}
+	}
+
+	res, _ := ComputePriceMoneyWithTier("text-embedding-3-small", Usage{PromptTokens: 1000}, "batch")
+	if res.ServiceTier != "batch" || !almostEqual(res.TotalCost.ToUSD(), 1000*0.01/1e6) {
+		t.Errorf("unexpected batch price: %+v", res)
+	}
+}
+
 func TestComputePriceMoneyWithTier(t *testing.T) {
 	// Setup a test configuration with service tiers
 	testConfig := &PricingConfig{
@@ -631,3 +822,134 @@ func TestPricing_SmallestTokenAccumulation(t *testing.T) {
 
 	t.Logf("Single token cost: $%.15f (expected: $%.15f)", singleTokenCost, expectedSingleCost)
 }
+
+func TestComputePrice_FineTunedModel(t *testing.T) {
+	SetConfig(&PricingConfig{
+		Models: map[string]ModelPricing{
+			"gpt-4o-mini": {
+				Prompt: 0.15, Completion: 0.6,
+				FineTuned: &ModelPricing{Prompt: 0.3, Completion: 1.2, Batch: &TierPricing{Prompt: 0.15, Completion: 0.6}},
+			},
+			"gpt-4.1": {Prompt: 2.0, Completion: 8.0},
+		},
+		FineTunes: map[string]ModelPricing{
+			"ft:gpt-4o-mini-2024-07-18:acme::special": {Prompt: 1.0, Completion: 2.0},
+		},
+		Default: &ModelPricing{Prompt: 10.0, Completion: 20.0},
+	})
+	defer ResetConfig()
+
+	usage := Usage{PromptTokens: 1000000, CompletionTokens: 1000000}
+	cases := []struct {
+		model, tier string
+		want        float64
+	}{
+		{"ft:gpt-4o-mini-2024-07-18:acme::abc123", "standard", 1.5},      // base model's fine_tuned rates
+		{"ft:gpt-4o-mini-2024-07-18:acme:support:abc123", "batch", 0.75}, // fine_tuned batch tier
+		{"ft:gpt-4o-mini-2024-07-18:acme::special", "standard", 3.0},     // explicit override
+		{"ft:gpt-4.1-2025-04-14:acme::abc123", "standard", 30.0},         // no fine_tuned rates: default
+		{"ft:unknown-model:acme::abc123", "standard", 30.0},              // unknown base: default
+	}
+	for _, tc := range cases {
+		res, err := ComputePriceMoneyWithTier(tc.model, usage, tc.tier)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !almostEqual(res.TotalCost.ToUSD(), tc.want) {
+			t.Errorf("%s (%s): expected $%.2f, got %s", tc.model, tc.tier, tc.want, res.TotalCost)
+		}
+		if string(res.Model) != tc.model {
+			t.Errorf("expected the fine-tuned model name to be kept, got %q", res.Model)
+		}
+	}
+}
+
+func TestFineTunedBaseModel(t *testing.T) {
+	cases := map[string]string{
+		"ft:gpt-4o-mini-2024-07-18:acme::abc123":   "gpt-4o-mini-2024-07-18",
+		"ft:gpt-3.5-turbo:acme:custom-suffix:id42": "gpt-3.5-turbo",
+		"ft:gpt-4.1": "gpt-4.1",
+	}
+	for name, want := range cases {
+		if base, ok := FineTunedBaseModel(name); !ok || base != want {
+			t.Errorf("FineTunedBaseModel(%q) = %q, %v; want %q", name, base, ok, want)
+		}
+	}
+	for _, name := range []string{"gpt-4o-mini", "ft::acme::abc123", "curie:ft-acme-2023"} {
+		if _, ok := FineTunedBaseModel(name); ok {
+			t.Errorf("expected %q not to be a fine-tuned model name", name)
+		}
+	}
+}
+
+func TestResolveModel_Aliases(t *testing.T) {
+	cfg := &PricingConfig{
+		Models: map[string]ModelPricing{
+			"gpt-4o":                     {Prompt: 2.5, Completion: 10.0},
+			"gpt-4o-mini":                {Prompt: 0.15, Completion: 0.6, Aliases: []string{"mini", "gpt-4o-mini-latest"}, FineTuned: &ModelPricing{Prompt: 0.3}},
+			"gpt-4o-mini-search-preview": {Prompt: 0.3, Completion: 1.2, Aliases: []string{"search-mini"}},
+		},
+		Default: &ModelPricing{Prompt: 10.0, Completion: 20.0},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	SetConfig(cfg)
+	defer ResetConfig()
+
+	cases := []struct{ input, resolved, match string }{
+		{"gpt-4o-mini", "gpt-4o-mini", MatchExact},
+		{"mini", "gpt-4o-mini", MatchAlias},
+		{"search-mini", "gpt-4o-mini-search-preview", MatchAlias},
+		{"gpt-4o-mini-search-preview-2025-03-11", "gpt-4o-mini-search-preview", MatchSnapshot},
+		{"gpt-4o-mini-latest-2025-01-01", "gpt-4o-mini", MatchSnapshot},
+		{"gpt-4o-mini-0718", "gpt-4o-mini", MatchSnapshot},
+		{"gpt-4o-mini-search-preview-experimental", "gpt-4o-mini-search-preview", MatchPrefix},
+		{"gpt-4o-minimal", "gpt-4o", MatchPrefix}, // prefixes end at a dash
+		{"ft:mini:acme::abc123", "gpt-4o-mini", MatchFineTuned},
+		{"ft:gpt-4o:acme::abc123", "", MatchDefault}, // no fine_tuned rates
+		{"gpt-4oo", "", MatchDefault},
+	}
+	for _, tc := range cases {
+		res, err := ResolveModel(tc.input)
+		if err != nil {
+			t.Fatalf("ResolveModel(%q) failed: %v", tc.input, err)
+		}
+		if res.Resolved != tc.resolved || res.Match != tc.match {
+			t.Errorf("ResolveModel(%q) = %q (%s), want %q (%s)", tc.input, res.Resolved, res.Match, tc.resolved, tc.match)
+		}
+	}
+
+	res, _ := ComputePriceMoney("search-mini", Usage{PromptTokens: 1000000})
+	if res.Model != "gpt-4o-mini-search-preview" || !almostEqual(res.TotalCost.ToUSD(), 0.3) {
+		t.Errorf("expected the alias to be priced as gpt-4o-mini-search-preview, got %s at %s", res.Model, res.TotalCost)
+	}
+	if mp, found := cfg.FindModelPricing("mini"); !found || mp.Prompt != 0.15 {
+		t.Errorf("expected FindModelPricing to follow the alias, got %+v", mp)
+	}
+
+	// Money tables built without their configuration's index resolve the same way
+	converted := cfg.ToMoney()
+	money := &PricingConfigMoney{Models: converted.Models}
+	if mp, found := money.FindModelPricingMoney("search-mini-2025-03-11"); !found || mp.Prompt != converted.Models["gpt-4o-mini-search-preview"].Prompt {
+		t.Errorf("expected FindModelPricingMoney to follow the alias snapshot, got %+v", mp)
+	}
+}
+
+func TestValidate_AliasConflicts(t *testing.T) {
+	cases := map[string]map[string]ModelPricing{
+		"alias is a model name": {
+			"gpt-4o":      {Prompt: 1, Aliases: []string{"gpt-4o-mini"}},
+			"gpt-4o-mini": {Prompt: 1},
+		},
+		"alias of two models": {
+			"gpt-4o":      {Prompt: 1, Aliases: []string{"omni"}},
+			"gpt-4o-mini": {Prompt: 1, Aliases: []string{"omni"}},
+		},
+	}
+	for name, models := range cases {
+		if err := (&PricingConfig{Models: models}).Validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package pricing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigInfo describes the active pricing configuration
+type ConfigInfo struct {
+	Version  int64     `json:"version"` // increments on every successful load
+	Hash     string    `json:"hash"`    // SHA-256 of the effective configuration
+	Source   string    `json:"source"`  // "embedded", the pricing file path, or "custom" for SetConfig
+	Models   int       `json:"models"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// storeConfigLocked atomically swaps in cfg as the active configuration. Callers must hold loadMu.
+func storeConfigLocked(cfg *PricingConfig) *configState {
+	configVersion++
+	index, err := newConfigIndex(cfg)
+	if err != nil { // validated configurations have none; conflicting aliases are left out
+		fmt.Println("[pricing] Warning: invalid model aliases:", err)
+	}
+	st := &configState{
+		cfg:   cfg,
+		index: index,
+		info: ConfigInfo{
+			Version:  configVersion,
+			Hash:     configHash(cfg),
+			Source:   source.describe(),
+			Models:   len(cfg.Models),
+			LoadedAt: time.Now(),
+		},
+	}
+	current.Store(st)
+	return st
+}
+
+// configHash fingerprints a configuration (yaml.v3 sorts map keys, so this is deterministic)
+func configHash(cfg *PricingConfig) string {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s configSource) describe() string {
+	switch {
+	case s.custom:
+		return "custom"
+	case s.file == "":
+		return "embedded"
+	case s.merge:
+		return "embedded+" + s.file
+	default:
+		return s.file
+	}
+}
+
+// CurrentConfigInfo returns information about the active pricing configuration
+func CurrentConfigInfo() ConfigInfo {
+	if _, err := GetConfig(); err != nil {
+		return ConfigInfo{}
+	}
+	return current.Load().info
+}
+
+// ReloadConfig rebuilds the configuration from the sources it was last loaded from
+// (embedded defaults and optional pricing file), validates it and swaps it in atomically.
+// On any error the active configuration is left untouched.
+func ReloadConfig() (ConfigInfo, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	if source.custom {
+		return ConfigInfo{}, fmt.Errorf("pricing config was set programmatically; nothing to reload")
+	}
+	cfg, err := buildConfig(source.file, source.merge)
+	if err != nil {
+		return ConfigInfo{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return ConfigInfo{}, fmt.Errorf("invalid pricing config: %w", err)
+	}
+
+	// Skip the swap (and version bump) when nothing changed
+	if st := current.Load(); st != nil && st.info.Hash == configHash(cfg) {
+		return st.info, nil
+	}
+	return storeConfigLocked(cfg).info, nil
+}
+
+// WatchConfigFile polls the pricing file every interval and reloads the configuration
+// when its modification time or size changes. It returns when stop is closed.
+// Nothing is watched when the configuration does not come from a file.
+func WatchConfigFile(interval time.Duration, stop <-chan struct{}) {
+	loadMu.Lock()
+	path := source.file
+	loadMu.Unlock()
+	if path == "" || interval <= 0 {
+		return
+	}
+
+	// Start without a baseline: the first tick compares the file against the active
+	// table, which also catches edits made between loading and starting the watcher.
+	var last os.FileInfo
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fi, err := os.Stat(path)
+			if err != nil {
+				continue // file may be mid-replace; try again next tick
+			}
+			if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+				continue
+			}
+			last = fi
+
+			previous := CurrentConfigInfo()
+			info, err := ReloadConfig()
+			if err != nil {
+				log.Printf("Warning: pricing reload after change to %s failed, keeping current table: %v", path, err)
+				continue
+			}
+			if info.Version != previous.Version {
+				log.Printf("Pricing reloaded from %s (version %d, hash %.12s)", path, info.Version, info.Hash)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package pricing
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig_SwapsValidatedConfig(t *testing.T) {
+	defer ResetConfig()
+
+	path := writePricingFile(t, `
+models:
+  my-model:
+    prompt: 1.0
+    completion: 2.0
+`)
+	if err := InitConfig(path, false); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+	before, _ := GetConfig()
+	infoBefore := CurrentConfigInfo()
+
+	// Unchanged file: reload is a no-op
+	info, err := ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+	if info.Version != infoBefore.Version {
+		t.Fatalf("expected version to stay %d for unchanged file, got %d", infoBefore.Version, info.Version)
+	}
+
+	// Change the price and reload
+	if err := os.WriteFile(path, []byte("models:\n  my-model:\n    prompt: 3.0\n    completion: 2.0\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite pricing file: %v", err)
+	}
+	info, err = ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+	if info.Version <= infoBefore.Version || info.Hash == infoBefore.Hash {
+		t.Fatalf("expected new version and hash, got %+v (before %+v)", info, infoBefore)
+	}
+
+	after, _ := GetConfig()
+	if after.Models["my-model"].Prompt != 3.0 {
+		t.Fatalf("expected reloaded prompt price 3.0, got %v", after.Models["my-model"].Prompt)
+	}
+	// Holders of the previous snapshot (in-flight requests) still see the old table
+	if before.Models["my-model"].Prompt != 1.0 {
+		t.Fatalf("previous config snapshot was mutated: %v", before.Models["my-model"].Prompt)
+	}
+}
+
+func TestReloadConfig_InvalidConfigKeepsActive(t *testing.T) {
+	defer ResetConfig()
+
+	path := writePricingFile(t, "models:\n  my-model:\n    prompt: 1.0\n")
+	if err := InitConfig(path, false); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+	infoBefore := CurrentConfigInfo()
+
+	for _, bad := range []string{"models: [broken", "models:\n  my-model:\n    prompt: -1.0\n", "models: {}"} {
+		if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+			t.Fatalf("failed to rewrite pricing file: %v", err)
+		}
+		if _, err := ReloadConfig(); err == nil {
+			t.Errorf("expected reload of %q to fail", bad)
+		}
+	}
+
+	if info := CurrentConfigInfo(); info.Hash != infoBefore.Hash || info.Version != infoBefore.Version {
+		t.Fatalf("active config changed after failed reloads: %+v", info)
+	}
+}
+
+func TestReloadConfig_CustomConfigCannotReload(t *testing.T) {
+	defer ResetConfig()
+
+	SetConfig(&PricingConfig{Models: map[string]ModelPricing{"m": {Prompt: 1}}})
+	if _, err := ReloadConfig(); err == nil {
+		t.Fatal("expected reload of programmatic config to fail")
+	}
+	if info := CurrentConfigInfo(); info.Source != "custom" {
+		t.Fatalf("expected source custom, got %q", info.Source)
+	}
+}
+
+func TestWatchConfigFile_ReloadsOnChange(t *testing.T) {
+	defer ResetConfig()
+
+	path := writePricingFile(t, "models:\n  my-model:\n    prompt: 1.0\n")
+	if err := InitConfig(path, false); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		WatchConfigFile(10*time.Millisecond, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// Different size guarantees the change is seen even with coarse mtimes
+	if err := os.WriteFile(path, []byte("models:\n  my-model:\n    prompt: 42.0\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite pricing file: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cfg, _ := GetConfig(); cfg.Models["my-model"].Prompt == 42.0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("pricing file change was not picked up")
+}
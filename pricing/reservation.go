@@ -0,0 +1,72 @@
+package pricing
+
+import "sync"
+
+// DefaultReservedOutputTokens is the output size assumed for requests that don't cap it
+// (no max_tokens / max_output_tokens) when estimating what to reserve.
+const DefaultReservedOutputTokens = 4096
+
+// Reservation is spend held against a key while its request is in flight, so that parallel
+// requests see each other before any of them has been priced. Once the response is priced,
+// add the actual cost (AddCost) and then Release the reservation; release it as well when
+// the request fails. Releasing more than once is a no-op.
+type Reservation struct {
+	kw     *keyWindowMoney // nil when nothing was held
+	amount Money
+	once   sync.Once
+}
+
+// Reserve checks the key like AllowBudget and, when allowed, holds estimate against it until
+// the returned reservation is released. While held, the estimate counts as spent in the hourly
+// window and every calendar budget. The reservation is never nil, even when not allowed.
+func (m *ManagerMoney) Reserve(key string, estimate Money) (*Reservation, bool, BudgetStatus) {
+	return m.ReserveWithin(key, estimate, 0)
+}
+
+// ReserveWithin is Reserve for a request whose worst-case cost is known: it is also rejected when
+// maxCost exceeds what is left of the key's hourly limit or any calendar budget. The status then
+// describes that window, with Spent+Reserved still under its Limit. A zero maxCost skips the check.
+func (m *ManagerMoney) ReserveWithin(key string, estimate, maxCost Money) (*Reservation, bool, BudgetStatus) {
+	allowed, status, kw := m.admit(key, estimate, maxCost)
+	if kw == nil {
+		return &Reservation{}, allowed, status
+	}
+	return &Reservation{kw: kw, amount: estimate}, allowed, status
+}
+
+// Amount returns the spend held by the reservation
+func (r *Reservation) Amount() Money {
+	return r.amount
+}
+
+// Release returns the held spend to the key
+func (r *Reservation) Release() {
+	if r == nil || r.kw == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.kw.mu.Lock()
+		defer r.kw.mu.Unlock()
+		r.kw.reserved = Money(int64(r.kw.reserved) - int64(r.amount))
+		if r.kw.reserved.IsNegative() {
+			r.kw.reserved = Money(0)
+		}
+	})
+}
+
+// EstimateMaxCost returns an upper-bound cost for a request with the given prompt size and
+// output cap (DefaultReservedOutputTokens when maxOutputTokens <= 0), priced like a response.
+func EstimateMaxCost(model string, promptTokens, maxOutputTokens int, serviceTier string) (Money, error) {
+	if maxOutputTokens <= 0 {
+		maxOutputTokens = DefaultReservedOutputTokens
+	}
+	pr, err := CalculatePriceWithTier(model, Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: maxOutputTokens,
+		TotalTokens:      promptTokens + maxOutputTokens,
+	}, serviceTier)
+	if err != nil {
+		return 0, err
+	}
+	return pr.TotalCost, nil
+}
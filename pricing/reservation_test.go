@@ -0,0 +1,164 @@
+package pricing
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerMoney_Reserve(t *testing.T) {
+	m := NewManagerMoneyFromUSD(1.00)
+	key := "reserve-key"
+
+	r1, allowed, _ := m.Reserve(key, NewMoneyFromUSD(0.60))
+	if !allowed || r1.Amount() != NewMoneyFromUSD(0.60) {
+		t.Fatalf("expected first reservation to be allowed, got allowed=%v amount=%v", allowed, r1.Amount())
+	}
+	if usage := m.GetUsage(key); usage.Reserved != NewMoneyFromUSD(0.60) || !usage.Spent.IsZero() {
+		t.Fatalf("expected $0.60 reserved and nothing spent, got %+v", usage)
+	}
+
+	// Still under the limit counting the hold: allowed, and now over it
+	r2, allowed, _ := m.Reserve(key, NewMoneyFromUSD(0.60))
+	if !allowed {
+		t.Fatal("expected second reservation to be allowed")
+	}
+	r3, allowed, status := m.Reserve(key, NewMoneyFromUSD(0.60))
+	if allowed {
+		t.Fatal("expected third reservation to be rejected while $1.20 is held")
+	}
+	if status.Reserved != NewMoneyFromUSD(1.20) || status.Period != PeriodHour {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	r3.Release() // rejected reservations hold nothing
+
+	if allowed, _ := m.AllowBudget(key); allowed {
+		t.Error("AllowBudget should count reservations as spent")
+	}
+
+	// Settle the first request at its actual cost, release the second (failed request)
+	m.AddCost(key, NewMoneyFromUSD(0.10))
+	r1.Release()
+	r1.Release() // no-op
+	r2.Release()
+
+	usage := m.GetUsage(key)
+	if !usage.Reserved.IsZero() || usage.Spent != NewMoneyFromUSD(0.10) {
+		t.Fatalf("expected only the settled $0.10, got %+v", usage)
+	}
+	if allowed, _ := m.AllowBudget(key); !allowed {
+		t.Error("expected key to be allowed after release")
+	}
+}
+
+func TestManagerMoney_ReserveUntracked(t *testing.T) {
+	disabled := NewManagerMoneyFromUSD(-1)
+	r, allowed, _ := disabled.Reserve("key", NewMoneyFromUSD(5))
+	if !allowed || !r.Amount().IsZero() {
+		t.Errorf("disabled limiter should allow without holding, got allowed=%v amount=%v", allowed, r.Amount())
+	}
+	r.Release()
+
+	m := NewManagerMoneyFromUSD(1)
+	if r, allowed, _ := m.Reserve("", NewMoneyFromUSD(5)); !allowed || !r.Amount().IsZero() {
+		t.Errorf("anonymous requests should not hold spend, got allowed=%v amount=%v", allowed, r.Amount())
+	}
+	var nilReservation *Reservation
+	nilReservation.Release() // must not panic
+}
+
+func TestManagerMoney_ReserveCountsAgainstBudgets(t *testing.T) {
+	m := NewManagerMoneyFromUSD(-1) // hourly limit disabled
+	m.SetBudgets([]Budget{{Period: PeriodDay, Limit: NewMoneyFromUSD(1)}}, time.UTC)
+
+	r, allowed, _ := m.Reserve("key", NewMoneyFromUSD(1))
+	if !allowed {
+		t.Fatal("expected reservation to be allowed")
+	}
+	if allowed, status := m.AllowBudget("key"); allowed || status.Period != PeriodDay {
+		t.Errorf("expected the day budget to block while $1 is held, got allowed=%v status=%+v", allowed, status)
+	}
+	r.Release()
+	if allowed, _ := m.AllowBudget("key"); !allowed {
+		t.Error("expected key to be allowed after release")
+	}
+}
+
+func TestManagerMoney_ReserveConcurrent(t *testing.T) {
+	m := NewManagerMoneyFromUSD(1.00)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	admitted := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, allowed, _ := m.Reserve("key", NewMoneyFromUSD(0.30)); allowed {
+				mu.Lock()
+				admitted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// $0, $0.30, $0.60 and $0.90 held are under $1: exactly four requests get in
+	if admitted != 4 {
+		t.Errorf("expected 4 admitted requests, got %d", admitted)
+	}
+}
+
+func TestManagerMoney_ReserveWithin(t *testing.T) {
+	m := NewManagerMoneyFromUSD(1.00)
+	m.SetBudgets([]Budget{{Period: PeriodDay, Limit: NewMoneyFromUSD(0.50)}}, time.UTC)
+	m.AddCost("key", NewMoneyFromUSD(0.20))
+
+	r, allowed, _ := m.ReserveWithin("key", NewMoneyFromUSD(0.10), NewMoneyFromUSD(0.30))
+	if !allowed {
+		t.Fatal("expected a $0.30 worst case to fit in the $0.30 left today")
+	}
+	defer r.Release()
+
+	// $0.30 spent or held: $0.70 left this hour but only $0.20 today
+	r2, allowed, status := m.ReserveWithin("key", NewMoneyFromUSD(0.10), NewMoneyFromUSD(0.25))
+	r2.Release()
+	if allowed || status.Period != PeriodDay || status.Allowed {
+		t.Errorf("expected the day budget to reject a $0.25 worst case, got allowed=%v status=%+v", allowed, status)
+	}
+	if !status.Spent.Add(status.Reserved).LessThan(status.Limit) {
+		t.Errorf("the day budget is not exhausted, got %+v", status)
+	}
+	if usage := m.GetUsage("key"); usage.Reserved != NewMoneyFromUSD(0.10) {
+		t.Errorf("rejected requests must not hold spend, got %v reserved", usage.Reserved)
+	}
+
+	// Without a worst case it behaves like Reserve
+	if r3, allowed, _ := m.ReserveWithin("key", NewMoneyFromUSD(0.10), 0); !allowed {
+		t.Error("expected zero maxCost to skip the check")
+	} else {
+		r3.Release()
+	}
+}
+
+func TestEstimateMaxCost(t *testing.T) {
+	cfg := &PricingConfig{
+		Models: map[string]ModelPricing{"gpt-4o": {Prompt: 5, Completion: 15}},
+	}
+	SetConfig(cfg)
+	defer ResetConfig()
+
+	cost, err := EstimateMaxCost("gpt-4o", 1000, 100, "standard")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := NewMoneyFromUSD(0.005 + 0.0015); cost != want {
+		t.Errorf("expected %v, got %v", want, cost)
+	}
+
+	// Uncapped output uses the default
+	cost, _ = EstimateMaxCost("gpt-4o", 0, 0, "standard")
+	if want := NewMoneyFromUSD(float64(DefaultReservedOutputTokens) * 15 / 1e6); cost != want {
+		t.Errorf("expected %v, got %v", want, cost)
+	}
+}
@@ -0,0 +1,175 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// How a model name matched the pricing table, in the order the matches are tried
+const (
+	MatchExact     = "exact"
+	MatchAlias     = "alias"
+	MatchSnapshot  = "snapshot" // dated snapshot of a model or alias, e.g. gpt-4o-2024-08-06
+	MatchPrefix    = "prefix"
+	MatchFineTune  = "fine_tune"  // fine_tunes entry
+	MatchFineTuned = "fine_tuned" // fine-tune priced through its base model
+	MatchDefault   = "default"
+	MatchNone      = "none"
+)
+
+// ModelResolution describes how a model name maps to the pricing table
+type ModelResolution struct {
+	Model    string           `json:"model"`              // the name asked for
+	Resolved string           `json:"resolved,omitempty"` // models (or fine_tunes) entry used for pricing
+	Match    string           `json:"match"`
+	Base     *ModelResolution `json:"base,omitempty"` // how a fine-tune's base model resolved
+}
+
+// snapshotSuffix matches the date suffix of model snapshots: -2024-08-06, -20250514 or -0613
+var snapshotSuffix = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{8}|\d{4})$`)
+
+// modelIndex resolves model names against a pricing table. It is built once per configuration load.
+type modelIndex struct {
+	models    map[string]bool
+	aliases   map[string]string // alias -> model
+	prefixes  []string          // model names, longest first
+	fineTunes map[string]bool
+}
+
+// newModelIndex indexes the model names and aliases of a table and its fine-tune overrides. It is
+// shared by both forms of the table, PricingConfig and PricingConfigMoney, which only differ in
+// their rates. Aliases that are already a model name or another alias are reported and left out.
+func newModelIndex[P any](models map[string]P, aliases func(P) []string, fineTunes map[string]P) (*modelIndex, error) {
+	idx := &modelIndex{
+		models:    make(map[string]bool, len(models)),
+		aliases:   make(map[string]string),
+		fineTunes: make(map[string]bool, len(fineTunes)),
+	}
+	for name := range models {
+		idx.models[name] = true
+		idx.prefixes = append(idx.prefixes, name)
+	}
+	for name := range fineTunes {
+		idx.fineTunes[name] = true
+	}
+	sort.Slice(idx.prefixes, func(i, j int) bool {
+		a, b := idx.prefixes[i], idx.prefixes[j]
+		return len(a) > len(b) || len(a) == len(b) && a < b
+	})
+
+	// Models in a fixed order, so the same alias is always the one left out
+	var errs []error
+	for _, name := range idx.sortedModels() {
+		for _, alias := range aliases(models[name]) {
+			if idx.models[alias] {
+				errs = append(errs, fmt.Errorf("model %q: alias %q is already a model name", name, alias))
+			} else if owner, dup := idx.aliases[alias]; dup {
+				errs = append(errs, fmt.Errorf("model %q: alias %q is already an alias of %q", name, alias, owner))
+			} else {
+				idx.aliases[alias] = name
+			}
+		}
+	}
+	return idx, errors.Join(errs...)
+}
+
+// sortedModels returns the model names in alphabetical order
+func (idx *modelIndex) sortedModels() []string {
+	names := make([]string, 0, len(idx.models))
+	for name := range idx.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve finds the table entry for a model name: exact, alias, dated snapshot, then the longest
+// prefix ending at a dash. Fine-tuned names resolve to their fine_tunes entry or their base model.
+func (idx *modelIndex) resolve(name string) ModelResolution {
+	res := ModelResolution{Model: name, Match: MatchNone}
+	if base, ok := FineTunedBaseModel(name); ok && !idx.models[name] {
+		if idx.fineTunes[name] {
+			res.Resolved, res.Match = name, MatchFineTune
+			return res
+		}
+		if b := idx.resolve(base); b.Resolved != "" {
+			res.Resolved, res.Match, res.Base = b.Resolved, MatchFineTuned, &b
+		}
+		return res
+	}
+
+	if idx.models[name] {
+		res.Resolved, res.Match = name, MatchExact
+		return res
+	}
+	if model, ok := idx.aliases[name]; ok {
+		res.Resolved, res.Match = model, MatchAlias
+		return res
+	}
+	if stem := snapshotSuffix.ReplaceAllString(name, ""); stem != name {
+		model, ok := idx.aliases[stem]
+		if idx.models[stem] {
+			model, ok = stem, true
+		}
+		if ok {
+			res.Resolved, res.Match = model, MatchSnapshot
+			return res
+		}
+	}
+	for _, model := range idx.prefixes {
+		if strings.HasPrefix(name, model+"-") {
+			res.Resolved, res.Match = model, MatchPrefix
+			return res
+		}
+	}
+	return res
+}
+
+// newConfigIndex indexes the models, aliases and fine-tune overrides of cfg
+func newConfigIndex(cfg *PricingConfig) (*modelIndex, error) {
+	return newModelIndex(cfg.Models, func(mp ModelPricing) []string { return mp.Aliases }, cfg.FineTunes)
+}
+
+// index returns the resolution index of cfg: the one built when it was loaded if it is the
+// active configuration, otherwise a new one
+func (cfg *PricingConfig) index() *modelIndex {
+	if st := current.Load(); st != nil && st.cfg == cfg && st.index != nil {
+		return st.index
+	}
+	idx, _ := newConfigIndex(cfg)
+	return idx
+}
+
+// index returns the resolution index the table was converted with, or a new one
+func (cfg *PricingConfigMoney) index() *modelIndex {
+	if cfg.resolver != nil {
+		return cfg.resolver
+	}
+	idx, _ := newModelIndex(cfg.Models, func(mp ModelPricingMoney) []string { return mp.Aliases }, cfg.FineTunes)
+	return idx
+}
+
+// ResolveModel reports how a model name maps to the pricing table, including the fallback to
+// the default pricing. Fine-tunes of a model without fine_tuned rates fall back like unknown models.
+func (cfg *PricingConfig) ResolveModel(name string) ModelResolution {
+	res := cfg.index().resolve(name)
+	if res.Match == MatchFineTuned && cfg.Models[res.Resolved].FineTuned == nil {
+		res.Resolved, res.Match = "", MatchNone
+	}
+	if res.Resolved == "" && cfg.Default != nil {
+		res.Match = MatchDefault
+	}
+	return res
+}
+
+// ResolveModel reports how a model name maps to the active pricing table
+func ResolveModel(name string) (ModelResolution, error) {
+	cfg, err := GetConfig()
+	if err != nil {
+		return ModelResolution{}, err
+	}
+	return cfg.ResolveModel(name), nil
+}
@@ -0,0 +1,84 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToolPricing holds the fees of a hosted tool of the Responses API, in USD, charged on top of
+// the tokens. Keys of the tools section are the output item types without "_call" (web_search,
+// file_search, code_interpreter, computer, ...).
+type ToolPricing struct {
+	PerCall    float64 `yaml:"per_call,omitempty"`
+	PerSession float64 `yaml:"per_session,omitempty"` // per container (code interpreter)
+}
+
+// ToolPricingMoney holds the fees of a hosted tool using Money type
+type ToolPricingMoney struct {
+	PerCall    Money
+	PerSession Money
+}
+
+// ToMoney converts the fees to Money
+func (tp ToolPricing) ToMoney() ToolPricingMoney {
+	return ToolPricingMoney{PerCall: NewMoneyFromUSD(tp.PerCall), PerSession: NewMoneyFromUSD(tp.PerSession)}
+}
+
+// ToolUsage counts the invocations of a hosted tool in a response
+type ToolUsage struct {
+	Calls    int `json:"calls"`
+	Sessions int `json:"sessions"` // distinct containers; calls without one count as their own
+}
+
+// ParseToolUsage counts the hosted tool calls among the output items of a Responses API response,
+// by tool. Function and custom tool calls run on the client and are left out.
+func ParseToolUsage(parsed map[string]interface{}) map[string]ToolUsage {
+	output, _ := parsed["output"].([]interface{})
+	tools := make(map[string]ToolUsage)
+	containers := make(map[string]bool)
+	for _, raw := range output {
+		item, _ := raw.(map[string]interface{})
+		itemType, _ := item["type"].(string)
+		tool, ok := strings.CutSuffix(itemType, "_call")
+		if !ok || tool == "function" || tool == "custom_tool" {
+			continue
+		}
+
+		tu := tools[tool]
+		tu.Calls++
+		container, _ := item["container_id"].(string)
+		if container == "" {
+			tu.Sessions++
+		} else if key := tool + "/" + container; !containers[key] {
+			containers[key] = true
+			tu.Sessions++
+		}
+		tools[tool] = tu
+	}
+	return tools
+}
+
+// AddToolCosts adds the fees of hosted tool calls to a price. Tools without pricing are free
+// (computer use, for instance, is only billed by its tokens).
+func AddToolCosts(pr PriceResultMoney, tools map[string]ToolUsage) PriceResultMoney {
+	if len(tools) == 0 {
+		return pr
+	}
+	cfg, err := GetConfig()
+	if err != nil {
+		return pr
+	}
+	prices := cfg.ToMoney().Tools
+
+	var cost Money
+	calls := 0
+	for _, tool := range sortedKeys(tools) {
+		tp, tu := prices[tool], tools[tool]
+		cost = cost.Add(tp.PerCall.Multiply(int64(tu.Calls))).Add(tp.PerSession.Multiply(int64(tu.Sessions)))
+		calls += tu.Calls
+	}
+	pr.Breakdown.Tools = pr.Breakdown.Tools.Add(cost)
+	pr.TotalCost = pr.TotalCost.Add(cost)
+	pr.Note += fmt.Sprintf(" (includes %d hosted tool call(s))", calls)
+	return pr
+}
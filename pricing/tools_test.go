@@ -0,0 +1,82 @@
+package pricing
+
+import "testing"
+
+func TestParseToolUsage(t *testing.T) {
+	response := map[string]interface{}{
+		"object": "response",
+		"output": []interface{}{
+			map[string]interface{}{"type": "web_search_call", "status": "completed"},
+			map[string]interface{}{"type": "web_search_call", "status": "completed"},
+			map[string]interface{}{"type": "file_search_call", "queries": []interface{}{"q"}},
+			map[string]interface{}{"type": "code_interpreter_call", "container_id": "cntr_1"},
+			map[string]interface{}{"type": "code_interpreter_call", "container_id": "cntr_1"},
+			map[string]interface{}{"type": "code_interpreter_call", "container_id": "cntr_2"},
+			map[string]interface{}{"type": "computer_call"},
+			map[string]interface{}{"type": "function_call", "name": "get_weather"},
+			map[string]interface{}{"type": "message", "role": "assistant"},
+		},
+	}
+	got := ParseToolUsage(response)
+	want := map[string]ToolUsage{
+		"web_search":       {Calls: 2, Sessions: 2},
+		"file_search":      {Calls: 1, Sessions: 1},
+		"code_interpreter": {Calls: 3, Sessions: 2},
+		"computer":         {Calls: 1, Sessions: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	for tool, tu := range want {
+		if got[tool] != tu {
+			t.Errorf("%s: expected %+v, got %+v", tool, tu, got[tool])
+		}
+	}
+
+	if tools := ParseToolUsage(map[string]interface{}{"object": "chat.completion"}); len(tools) != 0 {
+		t.Errorf("expected no tool calls, got %+v", tools)
+	}
+}
+
+func TestAddToolCosts(t *testing.T) {
+	SetConfig(&PricingConfig{
+		Models: map[string]ModelPricing{"gpt-4o": {Prompt: 5, Completion: 15}},
+		Tools: map[string]ToolPricing{
+			"web_search":       {PerCall: 0.01},
+			"code_interpreter": {PerSession: 0.03},
+		},
+	})
+	defer ResetConfig()
+
+	pr, err := ComputePriceMoney("gpt-4o", Usage{PromptTokens: 1000000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pr = AddToolCosts(pr, map[string]ToolUsage{
+		"web_search":       {Calls: 3, Sessions: 3},
+		"code_interpreter": {Calls: 4, Sessions: 2},
+		"computer":         {Calls: 1, Sessions: 1}, // not priced
+	})
+	// $5 of tokens, 3 searches at $0.01 and 2 containers at $0.03
+	if !almostEqual(pr.Breakdown.Tools.ToUSD(), 0.09) || !almostEqual(pr.TotalCost.ToUSD(), 5.09) {
+		t.Errorf("unexpected tool costs: tools=%s total=%s", pr.Breakdown.Tools, pr.TotalCost)
+	}
+	if pr.PromptCost.ToUSD() != 5 || !pr.CompletionCost.IsZero() {
+		t.Errorf("expected tool fees outside the prompt/completion costs, got %+v", pr)
+	}
+}
+
+func TestToolPricing_Config(t *testing.T) {
+	cfg, err := DefaultConfig()
+	if err != nil {
+		t.Fatalf("failed to load embedded config: %v", err)
+	}
+	if cfg.Tools["web_search"].PerCall <= 0 || cfg.Tools["code_interpreter"].PerSession <= 0 {
+		t.Errorf("expected embedded hosted tool fees, got %+v", cfg.Tools)
+	}
+
+	cfg.Tools["web_search"] = ToolPricing{PerCall: -1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a negative tool fee")
+	}
+}
@@ -2,17 +2,29 @@ package pricing
 
 import (
 	"fmt"
+	"time"
 )
 
 // parseUsageFromResponse extracts usage information from API responses based on object type
 func ParseUsageFromResponse(parsed map[string]interface{}) (Usage, bool) {
+	// Anthropic messages have a type instead of an object, Gemini responses neither
+	if parsed["type"] == "message" {
+		return parseAnthropicUsage(parsed)
+	}
+	if _, ok := parsed["usageMetadata"]; ok {
+		return parseGeminiUsage(parsed)
+	}
 	objectType, _ := parsed["object"].(string)
 
 	switch objectType {
-	case "chat.completion":
+	case "chat.completion", "chat.completion.chunk":
 		return parseChatCompletionUsage(parsed)
 	case "response":
 		return parseResponseAPIUsage(parsed)
+	case "realtime.response": // response.done events of realtime sessions
+		return parseRealtimeUsage(parsed)
+	case "list": // embeddings; other lists (models, files, ...) carry no usage
+		return parseEmbeddingsUsage(parsed)
 	case "": // Missing object field - default to chat completion format for backward compatibility
 		return parseChatCompletionUsage(parsed)
 	default:
@@ -38,16 +50,68 @@ func parseChatCompletionUsage(parsed map[string]interface{}) (Usage, bool) {
 		u.CompletionTokens = int(v)
 	}
 
-	// nested prompt_tokens_details.cached_tokens
-	if detailsRaw, ok := usageRaw["prompt_tokens_details"].(map[string]interface{}); ok {
-		if v, ok := detailsRaw["cached_tokens"].(float64); ok {
-			u.PromptCachedTokens = int(v)
-		}
+	// nested prompt_tokens_details (cached, audio) and completion_tokens_details (reasoning, audio)
+	parseInputDetails(&u, usageRaw["prompt_tokens_details"])
+	parseOutputDetails(&u, usageRaw["completion_tokens_details"])
+
+	return u, true
+}
+
+// parseEmbeddingsUsage extracts usage from embeddings API responses: input tokens only
+func parseEmbeddingsUsage(parsed map[string]interface{}) (Usage, bool) {
+	usageRaw, ok := parsed["usage"].(map[string]interface{})
+	if !ok {
+		return Usage{}, false
+	}
+
+	u := Usage{}
+	if v, ok := usageRaw["prompt_tokens"].(float64); ok {
+		u.PromptTokens = int(v)
 	}
+	if v, ok := usageRaw["total_tokens"].(float64); ok {
+		u.TotalTokens = int(v)
+	}
+
+	return u, true
+}
 
+// ParseImageUsage extracts token usage from an images API response (gpt-image-1). Responses of
+// models billed per image (dall-e-2/3) have no usage and are not parsed. Output tokens are image
+// tokens unless output_tokens_details says otherwise.
+func ParseImageUsage(parsed map[string]interface{}) (Usage, bool) {
+	u, ok := parseResponseAPIUsage(parsed)
+	if !ok {
+		return Usage{}, false
+	}
+	if u.CompletionImageTokens == 0 && u.CompletionAudioTokens == 0 {
+		details, _ := parsed["usage"].(map[string]interface{})["output_tokens_details"].(map[string]interface{})
+		if detailTokens(details, "text_tokens") == 0 {
+			u.CompletionImageTokens = u.CompletionTokens
+		}
+	}
 	return u, true
 }
 
+// ParseAudioUsage extracts what an audio transcription or translation response is billed by:
+// token usage (gpt-4o-transcribe, gpt-4o-mini-tts streams) or the audio duration (whisper-1, usage
+// type "duration" or the duration of a verbose_json response). Token usage is returned with a
+// zero duration.
+func ParseAudioUsage(parsed map[string]interface{}) (Usage, time.Duration, bool) {
+	usageRaw, _ := parsed["usage"].(map[string]interface{})
+	if v, ok := usageRaw["seconds"].(float64); ok && usageRaw["type"] == "duration" {
+		return Usage{}, time.Duration(v * float64(time.Second)), true
+	}
+	if _, ok := usageRaw["input_tokens"].(float64); ok { // also streamed speech (speech.audio.done)
+		u, _ := parseResponseAPIUsage(parsed)
+		parseInputDetails(&u, usageRaw["input_token_details"]) // singular in transcription responses
+		return u, 0, true
+	}
+	if v, ok := parsed["duration"].(float64); ok {
+		return Usage{}, time.Duration(v * float64(time.Second)), true
+	}
+	return Usage{}, 0, false
+}
+
 // parseResponseAPIUsage extracts usage from responses API responses
 func parseResponseAPIUsage(parsed map[string]interface{}) (Usage, bool) {
 	usageRaw, ok := parsed["usage"].(map[string]interface{})
@@ -65,12 +129,107 @@ func parseResponseAPIUsage(parsed map[string]interface{}) (Usage, bool) {
 		u.CompletionTokens = int(v)
 	}
 
-	// nested input_tokens_details.cached_tokens
-	if detailsRaw, ok := usageRaw["input_tokens_details"].(map[string]interface{}); ok {
-		if v, ok := detailsRaw["cached_tokens"].(float64); ok {
-			u.PromptCachedTokens = int(v)
-		}
+	// nested input_tokens_details (cached) and output_tokens_details (reasoning)
+	parseInputDetails(&u, usageRaw["input_tokens_details"])
+	parseOutputDetails(&u, usageRaw["output_tokens_details"])
+
+	return u, true
+}
+
+// parseRealtimeUsage extracts usage from realtime API responses, whose token details are
+// input_token_details/output_token_details
+func parseRealtimeUsage(parsed map[string]interface{}) (Usage, bool) {
+	u, ok := parseResponseAPIUsage(parsed)
+	if !ok {
+		return Usage{}, false
+	}
+	usageRaw := parsed["usage"].(map[string]interface{})
+	parseInputDetails(&u, usageRaw["input_token_details"])
+	parseOutputDetails(&u, usageRaw["output_token_details"])
+	return u, true
+}
+
+// parseAnthropicUsage extracts usage from Anthropic Messages API responses. Their input_tokens
+// exclude the tokens read from and written to the prompt cache, which are counted here as
+// prompt tokens too.
+func parseAnthropicUsage(parsed map[string]interface{}) (Usage, bool) {
+	usageRaw, ok := parsed["usage"].(map[string]interface{})
+	if !ok {
+		return Usage{}, false
 	}
 
+	u := Usage{
+		PromptCachedTokens:     detailTokens(usageRaw, "cache_read_input_tokens"),
+		PromptCacheWriteTokens: detailTokens(usageRaw, "cache_creation_input_tokens"),
+		CompletionTokens:       detailTokens(usageRaw, "output_tokens"),
+	}
+	u.PromptTokens = detailTokens(usageRaw, "input_tokens") + u.PromptCachedTokens + u.PromptCacheWriteTokens
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
 	return u, true
 }
+
+// parseGeminiUsage extracts usage from Gemini generateContent responses. promptTokenCount includes
+// the cached content; thinking tokens (thoughtsTokenCount) are billed as output, on top of the
+// candidates.
+func parseGeminiUsage(parsed map[string]interface{}) (Usage, bool) {
+	meta, ok := parsed["usageMetadata"].(map[string]interface{})
+	if !ok {
+		return Usage{}, false
+	}
+
+	u := Usage{
+		PromptTokens:       detailTokens(meta, "promptTokenCount") + detailTokens(meta, "toolUsePromptTokenCount"),
+		PromptCachedTokens: detailTokens(meta, "cachedContentTokenCount"),
+		ReasoningTokens:    detailTokens(meta, "thoughtsTokenCount"),
+	}
+	u.CompletionTokens = detailTokens(meta, "candidatesTokenCount") + u.ReasoningTokens
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	// Audio input has its own rate; cached audio is left to the cached tokens
+	u.PromptAudioTokens = geminiModalityTokens(meta["promptTokensDetails"], "AUDIO") - geminiModalityTokens(meta["cacheTokensDetails"], "AUDIO")
+	return u, true
+}
+
+// geminiModalityTokens sums the token counts of a modality in a Gemini details list
+// ([{"modality": "AUDIO", "tokenCount": 120}, ...])
+func geminiModalityTokens(raw interface{}, modality string) int {
+	details, _ := raw.([]interface{})
+	n := 0
+	for _, d := range details {
+		if entry, ok := d.(map[string]interface{}); ok && entry["modality"] == modality {
+			n += detailTokens(entry, "tokenCount")
+		}
+	}
+	return n
+}
+
+// parseInputDetails reads cached, audio and image prompt token counts. Audio and image tokens
+// served from cache (cached_tokens_details) are left to the cached prompt tokens.
+func parseInputDetails(u *Usage, raw interface{}) {
+	details, ok := raw.(map[string]interface{})
+	if !ok {
+		return
+	}
+	u.PromptCachedTokens = detailTokens(details, "cached_tokens")
+	u.PromptAudioTokens = detailTokens(details, "audio_tokens")
+	u.PromptImageTokens = detailTokens(details, "image_tokens")
+	if cached, ok := details["cached_tokens_details"].(map[string]interface{}); ok {
+		u.PromptAudioTokens -= detailTokens(cached, "audio_tokens")
+		u.PromptImageTokens -= detailTokens(cached, "image_tokens")
+	}
+}
+
+// parseOutputDetails reads reasoning, audio and image completion token counts
+func parseOutputDetails(u *Usage, raw interface{}) {
+	details, ok := raw.(map[string]interface{})
+	if !ok {
+		return
+	}
+	u.ReasoningTokens = detailTokens(details, "reasoning_tokens")
+	u.CompletionAudioTokens = detailTokens(details, "audio_tokens")
+	u.CompletionImageTokens = detailTokens(details, "image_tokens")
+}
+
+func detailTokens(details map[string]interface{}, field string) int {
+	v, _ := details[field].(float64)
+	return int(v)
+}
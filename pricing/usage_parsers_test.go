@@ -2,6 +2,7 @@ package pricing
 
 import (
 	"testing"
+	"time"
 )
 
 func TestParseUsageFromResponse_ChatCompletion(t *testing.T) {
@@ -33,6 +34,77 @@ func TestParseUsageFromResponse_ChatCompletion(t *testing.T) {
 	}
 }
 
+func TestParseUsageFromResponse_AnthropicMessage(t *testing.T) {
+	response := map[string]interface{}{
+		"type":  "message",
+		"model": "claude-sonnet-4-5-20250929",
+		"usage": map[string]interface{}{
+			"input_tokens":                float64(20),
+			"cache_creation_input_tokens": float64(1500),
+			"cache_read_input_tokens":     float64(300),
+			"output_tokens":               float64(80),
+		},
+	}
+
+	usage, ok := ParseUsageFromResponse(response)
+	if !ok {
+		t.Fatal("Expected successful parsing")
+	}
+
+	// input_tokens leave out the cache reads and writes
+	expected := Usage{
+		PromptTokens:           1820,
+		PromptCachedTokens:     300,
+		PromptCacheWriteTokens: 1500,
+		CompletionTokens:       80,
+		TotalTokens:            1900,
+	}
+
+	if usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+}
+
+func TestParseUsageFromResponse_Gemini(t *testing.T) {
+	response := map[string]interface{}{
+		"modelVersion": "gemini-2.5-flash",
+		"usageMetadata": map[string]interface{}{
+			"promptTokenCount":        float64(1200),
+			"cachedContentTokenCount": float64(1000),
+			"candidatesTokenCount":    float64(50),
+			"thoughtsTokenCount":      float64(300),
+			"totalTokenCount":         float64(1550),
+			"promptTokensDetails": []interface{}{
+				map[string]interface{}{"modality": "TEXT", "tokenCount": float64(800)},
+				map[string]interface{}{"modality": "AUDIO", "tokenCount": float64(400)},
+			},
+			"cacheTokensDetails": []interface{}{
+				map[string]interface{}{"modality": "TEXT", "tokenCount": float64(700)},
+				map[string]interface{}{"modality": "AUDIO", "tokenCount": float64(300)},
+			},
+		},
+	}
+
+	usage, ok := ParseUsageFromResponse(response)
+	if !ok {
+		t.Fatal("Expected successful parsing")
+	}
+
+	// Thoughts are billed as output; cached audio is left to the cached tokens
+	expected := Usage{
+		PromptTokens:       1200,
+		PromptCachedTokens: 1000,
+		PromptAudioTokens:  100,
+		CompletionTokens:   350,
+		ReasoningTokens:    300,
+		TotalTokens:        1550,
+	}
+
+	if usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+}
+
 func TestParseUsageFromResponse_ResponseAPI(t *testing.T) {
 	response := map[string]interface{}{
 		"object": "response",
@@ -87,6 +159,33 @@ func TestParseUsageFromResponse_MissingObjectField(t *testing.T) {
 	}
 }
 
+func TestParseUsageFromResponse_Embeddings(t *testing.T) {
+	response := map[string]interface{}{
+		"object": "list",
+		"model":  "text-embedding-3-small",
+		"data": []interface{}{
+			map[string]interface{}{"object": "embedding", "index": float64(0), "embedding": []interface{}{0.1, -0.2}},
+		},
+		"usage": map[string]interface{}{
+			"prompt_tokens": float64(8),
+			"total_tokens":  float64(8),
+		},
+	}
+
+	usage, ok := ParseUsageFromResponse(response)
+	if !ok {
+		t.Fatal("Expected successful parsing")
+	}
+	if expected := (Usage{PromptTokens: 8, TotalTokens: 8}); usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+
+	// Other lists (e.g. GET /v1/models) have nothing to charge
+	if _, ok := ParseUsageFromResponse(map[string]interface{}{"object": "list", "data": []interface{}{}}); ok {
+		t.Error("Expected lists without usage to be skipped")
+	}
+}
+
 func TestParseUsageFromResponse_UnsupportedObjectType(t *testing.T) {
 	response := map[string]interface{}{
 		"object": "embedding",
@@ -256,3 +355,148 @@ func TestParseUsageFromResponse_InvalidTokenTypes(t *testing.T) {
 		t.Errorf("Expected %+v, got %+v", expected, usage)
 	}
 }
+
+func TestParseUsageFromResponse_ChatCompletionChunk(t *testing.T) {
+	// Final chunk of a streamed chat completion with stream_options.include_usage
+	response := map[string]interface{}{
+		"object":  "chat.completion.chunk",
+		"model":   "gpt-4o",
+		"choices": []interface{}{},
+		"usage": map[string]interface{}{
+			"prompt_tokens":     float64(12),
+			"completion_tokens": float64(34),
+		},
+	}
+
+	usage, ok := ParseUsageFromResponse(response)
+	if !ok {
+		t.Fatal("Expected successful parsing")
+	}
+
+	expected := Usage{
+		PromptTokens:     12,
+		CompletionTokens: 34,
+	}
+
+	if usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+}
+
+func TestParseUsage_TokenDetails(t *testing.T) {
+	// gpt-audio style chat completion with reasoning and audio tokens
+	chat := map[string]interface{}{
+		"object": "chat.completion",
+		"usage": map[string]interface{}{
+			"prompt_tokens":     float64(300),
+			"completion_tokens": float64(500),
+			"prompt_tokens_details": map[string]interface{}{
+				"cached_tokens": float64(100),
+				"audio_tokens":  float64(200),
+			},
+			"completion_tokens_details": map[string]interface{}{
+				"reasoning_tokens": float64(50),
+				"audio_tokens":     float64(400),
+			},
+		},
+	}
+	usage, ok := ParseUsageFromResponse(chat)
+	expected := Usage{PromptTokens: 300, PromptCachedTokens: 100, CompletionTokens: 500,
+		PromptAudioTokens: 200, ReasoningTokens: 50, CompletionAudioTokens: 400}
+	if !ok || usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+
+	// Responses API with output_tokens_details; cached audio/image tokens aren't counted twice
+	response := map[string]interface{}{
+		"object": "response",
+		"usage": map[string]interface{}{
+			"input_tokens":  float64(1000),
+			"output_tokens": float64(300),
+			"input_tokens_details": map[string]interface{}{
+				"cached_tokens": float64(400),
+				"audio_tokens":  float64(600),
+				"image_tokens":  float64(100),
+				"cached_tokens_details": map[string]interface{}{
+					"audio_tokens": float64(350),
+					"image_tokens": float64(50),
+				},
+			},
+			"output_tokens_details": map[string]interface{}{
+				"reasoning_tokens": float64(256),
+			},
+		},
+	}
+	usage, ok = ParseUsageFromResponse(response)
+	expected = Usage{PromptTokens: 1000, PromptCachedTokens: 400, CompletionTokens: 300,
+		PromptAudioTokens: 250, PromptImageTokens: 50, ReasoningTokens: 256}
+	if !ok || usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+}
+
+func TestParseAudioUsage(t *testing.T) {
+	// gpt-4o-transcribe: token usage, input_token_details is singular
+	usage, duration, ok := ParseAudioUsage(map[string]interface{}{
+		"text": "hello",
+		"usage": map[string]interface{}{
+			"type":          "tokens",
+			"input_tokens":  float64(120),
+			"output_tokens": float64(30),
+			"total_tokens":  float64(150),
+			"input_token_details": map[string]interface{}{
+				"text_tokens":  float64(20),
+				"audio_tokens": float64(100),
+			},
+		},
+	})
+	expected := Usage{PromptTokens: 120, CompletionTokens: 30, PromptAudioTokens: 100}
+	if !ok || duration != 0 || usage != expected {
+		t.Errorf("Expected %+v, got %+v (%v, %v)", expected, usage, duration, ok)
+	}
+
+	// whisper-1: usage of type duration, or the duration of a verbose_json response
+	for _, parsed := range []map[string]interface{}{
+		{"text": "hello", "usage": map[string]interface{}{"type": "duration", "seconds": float64(42)}},
+		{"task": "transcribe", "text": "hello", "duration": float64(42)},
+	} {
+		usage, duration, ok := ParseAudioUsage(parsed)
+		if !ok || duration != 42*time.Second || usage != (Usage{}) {
+			t.Errorf("Expected 42s for %v, got %+v (%v, %v)", parsed, usage, duration, ok)
+		}
+	}
+
+	if _, _, ok := ParseAudioUsage(map[string]interface{}{"text": "hello"}); ok {
+		t.Error("Expected a plain transcript not to be parsed")
+	}
+}
+
+func TestParseUsageFromResponse_Realtime(t *testing.T) {
+	// response.done event payload: token details are singular
+	response := map[string]interface{}{
+		"object": "realtime.response",
+		"usage": map[string]interface{}{
+			"total_tokens":  float64(1300),
+			"input_tokens":  float64(1000),
+			"output_tokens": float64(300),
+			"input_token_details": map[string]interface{}{
+				"cached_tokens": float64(200),
+				"text_tokens":   float64(400),
+				"audio_tokens":  float64(600),
+				"cached_tokens_details": map[string]interface{}{
+					"text_tokens":  float64(100),
+					"audio_tokens": float64(100),
+				},
+			},
+			"output_token_details": map[string]interface{}{
+				"text_tokens":  float64(50),
+				"audio_tokens": float64(250),
+			},
+		},
+	}
+	usage, ok := ParseUsageFromResponse(response)
+	expected := Usage{PromptTokens: 1000, PromptCachedTokens: 200, PromptAudioTokens: 500, CompletionTokens: 300, CompletionAudioTokens: 250}
+	if !ok || usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+}
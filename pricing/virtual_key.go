@@ -0,0 +1,42 @@
+package pricing
+
+import "time"
+
+// VirtualKeyPrefix starts every key issued by goxy, distinguishing it from provider keys
+const VirtualKeyPrefix = "gxy-"
+
+// VirtualKey is an API key issued by goxy. Callers present it instead of the real provider key,
+// which the proxy swaps in on the way upstream. Only a hash of the key itself is stored.
+type VirtualKey struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	KeyHash       string     `json:"key_hash"` // tracking key, same hashing as any Authorization header
+	MaskedKey     string     `json:"masked_key"`
+	AllowedModels []string   `json:"allowed_models,omitempty"` // empty allows every model
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key can currently be used
+func (vk *VirtualKey) Active(now time.Time) bool {
+	if vk.RevokedAt != nil {
+		return false
+	}
+	return vk.ExpiresAt == nil || now.Before(*vk.ExpiresAt)
+}
+
+// AllowsModel reports whether the key may call the given model. Allowed entries match exactly
+// or as their dated snapshots (e.g. "gpt-4o" allows "gpt-4o-2024-08-06" but not "gpt-4o-mini").
+func (vk *VirtualKey) AllowsModel(model string) bool {
+	if len(vk.AllowedModels) == 0 {
+		return true
+	}
+	stem := snapshotSuffix.ReplaceAllString(model, "")
+	for _, allowed := range vk.AllowedModels {
+		if model == allowed || stem == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package pricing
+
+import "testing"
+
+func TestVirtualKey_AllowsModel(t *testing.T) {
+	vk := VirtualKey{AllowedModels: []string{"gpt-4", "o3", "claude-sonnet-4"}}
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"gpt-4", true},
+		{"gpt-4-0613", true},
+		{"o3-2025-04-16", true},
+		{"claude-sonnet-4-20250514", true},
+		{"gpt-4o", false},
+		{"gpt-4-turbo", false},
+		{"o3-pro", false},
+		{"o3-mini-2025-01-31", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := vk.AllowsModel(tt.model); got != tt.want {
+			t.Errorf("AllowsModel(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+
+	if !(&VirtualKey{}).AllowsModel("anything") {
+		t.Error("a key without allowed models should allow every model")
+	}
+}
@@ -0,0 +1,91 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// BPE is a byte-level byte-pair encoding with tiktoken-style merge ranks
+type BPE struct {
+	name  string
+	ranks map[string]int
+}
+
+// NewBPE creates an encoding from token bytes to merge rank (lower merges first)
+func NewBPE(name string, ranks map[string]int) *BPE {
+	return &BPE{name: name, ranks: ranks}
+}
+
+// LoadTiktoken reads a tiktoken rank file: one "<base64 token> <rank>" pair per line
+func LoadTiktoken(name string, r io.Reader) (*BPE, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		token, rankStr, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"<base64 token> <rank>\"", lineNo)
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		rank, err := strconv.Atoi(rankStr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		ranks[string(b)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("no tokens")
+	}
+	return NewBPE(name, ranks), nil
+}
+
+func (e *BPE) Name() string { return e.name }
+func (e *BPE) Exact() bool  { return true }
+
+// Count returns the number of tokens the text encodes to
+func (e *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range split(text) {
+		n += e.countPiece(piece)
+	}
+	return n
+}
+
+// countPiece merges the piece's bytes pairwise, lowest rank first, until no pair is in the vocabulary
+func (e *BPE) countPiece(piece string) int {
+	if _, ok := e.ranks[piece]; ok {
+		return 1
+	}
+
+	// Boundaries of the current parts: parts[i] = piece[bounds[i]:bounds[i+1]]
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
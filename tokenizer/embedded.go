@@ -0,0 +1,45 @@
+package tokenizer
+
+import (
+	"compress/gzip"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+//go:generate go run gen_ranks.go
+
+// bundled holds the rank files compiled into the binary, gzipped: ranks/<name>.tiktoken.gz
+//
+//go:embed ranks
+var bundled embed.FS
+
+// LoadEmbedded loads the encodings bundled into the binary and returns the names loaded.
+// Encodings whose rank file was not generated are skipped.
+func LoadEmbedded() ([]string, error) {
+	var loaded []string
+	for _, name := range []string{O200kBase, Cl100kBase} {
+		path := "ranks/" + name + ".tiktoken.gz"
+		f, err := bundled.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return loaded, err
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return loaded, fmt.Errorf("%s: %w", path, err)
+		}
+		enc, err := LoadTiktoken(name, zr)
+		f.Close()
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", path, err)
+		}
+		Register(enc)
+		loaded = append(loaded, name)
+	}
+	return loaded, nil
+}
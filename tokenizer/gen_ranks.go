@@ -0,0 +1,74 @@
+//go:build ignore
+
+// gen_ranks downloads the OpenAI rank files, checks them against the hashes tiktoken pins and
+// writes them gzipped to ranks/, where they are embedded into the binary. Run with go generate.
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var rankFiles = []struct {
+	name   string
+	sha256 string
+}{
+	{"o200k_base", "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d"},
+	{"cl100k_base", "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7"},
+}
+
+const baseURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+func main() {
+	for _, rf := range rankFiles {
+		if err := generate(rf.name, rf.sha256); err != nil {
+			log.Fatalf("%s: %v", rf.name, err)
+		}
+		fmt.Println("wrote", filepath.Join("ranks", rf.name+".tiktoken.gz"))
+	}
+}
+
+func generate(name, wantHash string) error {
+	resp, err := http.Get(baseURL + name + ".tiktoken")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != wantHash {
+		return fmt.Errorf("sha256 %s, want %s", got, wantHash)
+	}
+
+	out, err := os.Create(filepath.Join("ranks", name+".tiktoken.gz"))
+	if err != nil {
+		return err
+	}
+	zw, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
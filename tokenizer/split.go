@@ -0,0 +1,99 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// split pre-tokenizes text the way the cl100k_base pattern does:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// Go's regexp has no lookahead, hence the hand-written scanner. o200k_base uses a close variant
+// (it also splits CamelCase words); the same split is used for both, so o200k counts can be off
+// by a token here and there.
+func split(text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		n := matchAt(text, i)
+		pieces = append(pieces, text[i:i+n])
+		i += n
+	}
+	return pieces
+}
+
+// matchAt returns the length of the piece starting at byte offset i
+func matchAt(s string, i int) int {
+	r, size := utf8.DecodeRuneInString(s[i:])
+
+	// Contractions
+	if r == '\'' {
+		rest := strings.ToLower(s[i+1:])
+		for _, c := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+			if strings.HasPrefix(rest, c) {
+				return 1 + len(c)
+			}
+		}
+	}
+
+	// Letters, with an optional leading non-letter/non-digit (e.g. " hello")
+	if unicode.IsLetter(r) {
+		return size + runLen(s[i+size:], unicode.IsLetter, -1)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		if next, _ := utf8.DecodeRuneInString(s[i+size:]); i+size < len(s) && unicode.IsLetter(next) {
+			return size + runLen(s[i+size:], unicode.IsLetter, -1)
+		}
+	}
+
+	// Up to three digits
+	if unicode.IsNumber(r) {
+		return size + runLen(s[i+size:], unicode.IsNumber, 2)
+	}
+
+	// Punctuation, with an optional leading space and trailing newlines
+	start := 0
+	if r == ' ' {
+		if next, _ := utf8.DecodeRuneInString(s[i+1:]); i+1 < len(s) && isPunct(next) {
+			start = 1
+		}
+	}
+	if first, firstSize := utf8.DecodeRuneInString(s[i+start:]); isPunct(first) {
+		n := start + firstSize + runLen(s[i+start+firstSize:], isPunct, -1)
+		return n + runLen(s[i+n:], isNewline, -1)
+	}
+
+	// Whitespace
+	ws := runLen(s[i:], unicode.IsSpace, -1)
+	if last := strings.LastIndexAny(s[i:i+ws], "\r\n"); last >= 0 {
+		return last + 1 // \s*[\r\n]+
+	}
+	if i+ws == len(s) || ws == size {
+		return ws // \s+ at the end of the text, or a single space before a word
+	}
+	// \s+(?!\S): leave the last whitespace character to prefix the next piece
+	_, lastSize := utf8.DecodeLastRuneInString(s[i : i+ws])
+	return ws - lastSize
+}
+
+// runLen returns the byte length of the leading runes of s matching f, up to max runes (-1 for no limit)
+func runLen(s string, f func(rune) bool, max int) int {
+	n := 0
+	for count := 0; n < len(s) && count != max; count++ {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !f(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
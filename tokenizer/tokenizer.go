@@ -0,0 +1,118 @@
+// Package tokenizer counts prompt tokens locally, before a request is sent upstream.
+//
+// Exact counts use byte-level BPE with the OpenAI rank files (o200k_base, cl100k_base) in the
+// tiktoken format. They are embedded gzipped into the binary by go generate (LoadEmbedded), and
+// can be replaced from a directory (LoadDir). Encodings without a rank file fall back to a
+// heuristic estimate.
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Encoding names
+const (
+	O200kBase  = "o200k_base"
+	Cl100kBase = "cl100k_base"
+)
+
+// Encoding counts the tokens of a text
+type Encoding interface {
+	// Name returns the encoding name (e.g. o200k_base)
+	Name() string
+	// Count returns the number of tokens in text
+	Count(text string) int
+	// Exact reports whether counts come from the real vocabulary rather than a heuristic
+	Exact() bool
+}
+
+var (
+	mu        sync.RWMutex
+	encodings = map[string]Encoding{}
+)
+
+// Register makes an encoding available to Get and ForModel, replacing one with the same name
+func Register(enc Encoding) {
+	mu.Lock()
+	defer mu.Unlock()
+	encodings[enc.Name()] = enc
+}
+
+// Get returns the registered encoding, or a heuristic stand-in when it was not loaded
+func Get(name string) Encoding {
+	mu.RLock()
+	defer mu.RUnlock()
+	if enc, ok := encodings[name]; ok {
+		return enc
+	}
+	return heuristic{name: name}
+}
+
+// ForModel returns the encoding used by a model: o200k_base for the gpt-4o generation and
+// later (gpt-4.1, gpt-5, o-series), cl100k_base for gpt-4, gpt-3.5 and embeddings.
+func ForModel(model string) Encoding {
+	return Get(EncodingNameForModel(model))
+}
+
+// EncodingNameForModel returns the encoding name used by a model
+func EncodingNameForModel(model string) string {
+	for _, prefix := range []string{"gpt-4-", "gpt-3.5", "text-embedding-"} {
+		if strings.HasPrefix(model, prefix) {
+			return Cl100kBase
+		}
+	}
+	if model == "gpt-4" {
+		return Cl100kBase
+	}
+	return O200kBase
+}
+
+// LoadDir loads every known encoding found in dir as <name>.tiktoken and returns the names loaded.
+// Missing files are skipped; invalid files are an error.
+func LoadDir(dir string) ([]string, error) {
+	var loaded []string
+	for _, name := range []string{O200kBase, Cl100kBase} {
+		path := filepath.Join(dir, name+".tiktoken")
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return loaded, err
+		}
+		enc, err := LoadTiktoken(name, f)
+		f.Close()
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", path, err)
+		}
+		Register(enc)
+		loaded = append(loaded, name)
+	}
+	return loaded, nil
+}
+
+// heuristic estimates tokens from the pre-tokenized pieces: common words (up to six bytes,
+// including the leading space) are one token, longer pieces take about one more per four bytes.
+// It errs slightly high for English prose.
+type heuristic struct {
+	name string
+}
+
+func (h heuristic) Name() string { return h.name }
+func (h heuristic) Exact() bool  { return false }
+
+func (h heuristic) Count(text string) int {
+	n := 0
+	for _, piece := range split(text) {
+		n++
+		if len(piece) > 6 {
+			n += (len(piece) - 6 + 3) / 4
+		}
+	}
+	return n
+}
@@ -0,0 +1,165 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	cases := map[string][]string{
+		"Hello world":           {"Hello", " world"},
+		"I'm here, aren't you?": {"I", "'m", " here", ",", " aren", "'t", " you", "?"},
+		"12345 apples":          {"123", "45", " apples"},
+		"a  b":                  {"a", " ", " b"},
+		"line\n\nnext":          {"line", "\n\n", "next"},
+		"end  ":                 {"end", "  "},
+		"x = {y};\n":            {"x", " =", " {", "y", "};\n"},
+		"héllo wörld":           {"héllo", " wörld"},
+		"":                      nil,
+	}
+	for text, want := range cases {
+		if got := split(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("split(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestSplitCoversInput(t *testing.T) {
+	text := "Mixed: CamelCase, 3.14159, emoji 🙂, tabs\t\tand\r\nwindows lines  \n"
+	if got := strings.Join(split(text), ""); got != text {
+		t.Errorf("pieces don't reassemble the input: %q", got)
+	}
+}
+
+func testRanks() map[string]int {
+	ranks := map[string]int{}
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for i, merge := range []string{"he", "ll", "hell", "hello", " w", "or", " wor", "ld"} {
+		ranks[merge] = 256 + i
+	}
+	return ranks
+}
+
+func TestBPE_Count(t *testing.T) {
+	enc := NewBPE("test", testRanks())
+	cases := map[string]int{
+		"hello":       1, // whole piece in the vocabulary
+		"hello world": 3, // "hello", " wor", "ld"
+		"help":        3, // "he", "l", "p"
+		"":            0,
+	}
+	for text, want := range cases {
+		if got := enc.Count(text); got != want {
+			t.Errorf("Count(%q) = %d, want %d", text, got, want)
+		}
+	}
+	if !enc.Exact() || enc.Name() != "test" {
+		t.Errorf("unexpected encoding metadata")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	for token, rank := range testRanks() {
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(token)))
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(rank))
+		b.WriteString("\n")
+	}
+	if err := os.WriteFile(filepath.Join(dir, Cl100kBase+".tiktoken"), []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		mu.Lock()
+		delete(encodings, Cl100kBase)
+		mu.Unlock()
+	}()
+
+	loaded, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, []string{Cl100kBase}) {
+		t.Fatalf("expected only cl100k_base to load, got %v", loaded)
+	}
+
+	enc := ForModel("gpt-4-turbo")
+	if enc.Name() != Cl100kBase || !enc.Exact() || enc.Count("hello world") != 3 {
+		t.Errorf("expected the loaded cl100k_base encoding, got %s exact=%v", enc.Name(), enc.Exact())
+	}
+	// o200k_base was not loaded: heuristic stand-in
+	if enc := ForModel("gpt-4o"); enc.Name() != O200kBase || enc.Exact() {
+		t.Errorf("expected heuristic o200k_base, got %s exact=%v", enc.Name(), enc.Exact())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, O200kBase+".tiktoken"), []byte("not base64! 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDir(dir); err == nil {
+		t.Error("expected error for invalid rank file")
+	}
+}
+
+func TestHeuristic(t *testing.T) {
+	enc := Get("unknown_encoding")
+	if enc.Exact() {
+		t.Error("heuristic must not claim to be exact")
+	}
+	// Nine short words, one token each (as in cl100k_base)
+	if got := enc.Count("The quick brown fox jumps over the lazy dog"); got != 9 {
+		t.Errorf("unexpected heuristic count %d", got)
+	}
+	// " internationalization" is 21 bytes: 1 + ceil(15/4)
+	if got := enc.Count(" internationalization"); got != 5 {
+		t.Errorf("unexpected heuristic count %d", got)
+	}
+}
+
+func TestEncodingNameForModel(t *testing.T) {
+	cases := map[string]string{
+		"gpt-4o":                 O200kBase,
+		"gpt-4o-mini":            O200kBase,
+		"gpt-4.1":                O200kBase,
+		"gpt-5":                  O200kBase,
+		"o3-mini":                O200kBase,
+		"gpt-4":                  Cl100kBase,
+		"gpt-4-turbo":            Cl100kBase,
+		"gpt-3.5-turbo":          Cl100kBase,
+		"text-embedding-3-small": Cl100kBase,
+	}
+	for model, want := range cases {
+		if got := EncodingNameForModel(model); got != want {
+			t.Errorf("EncodingNameForModel(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	defer func() {
+		mu.Lock()
+		delete(encodings, O200kBase)
+		delete(encodings, Cl100kBase)
+		mu.Unlock()
+	}()
+
+	loaded, err := LoadEmbedded()
+	if err != nil {
+		t.Fatalf("LoadEmbedded failed: %v", err)
+	}
+	if len(loaded) < 2 {
+		t.Skipf("only %v bundled: run go generate ./tokenizer and commit tokenizer/ranks", loaded)
+	}
+	for _, name := range loaded {
+		if enc := Get(name); !enc.Exact() || enc.Count("hello world") != 2 {
+			t.Errorf("expected the bundled %s encoding, got exact=%v count=%d", name, enc.Exact(), enc.Count("hello world"))
+		}
+	}
+}